@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"collision-backend/services"
+)
+
+// 命令行子命令，用于一次性的数据维护任务
+// 用法: ./collision-backend <command> [flags]
+var commands = map[string]func(args []string) error{
+	"normalize-tags":  runNormalizeTags,
+	"dedup-matches":   runDedupMatches,
+	"rematch":         runRematch,
+	"restore-archive": runRestoreArchive,
+}
+
+// runCommand 执行子命令，返回 false 表示不是子命令（正常启动服务）
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if err := command(args[1:]); err != nil {
+		log.Printf("❌ 命令 %s 执行失败: %v", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// runNormalizeTags 重新计算已有数据的标签规范形式并合并重复热门标签
+// 用法: ./collision-backend normalize-tags [-dry-run]
+func runNormalizeTags(args []string) error {
+	fs := flag.NewFlagSet("normalize-tags", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只统计需要修改的数据，不写入数据库")
+	fs.Parse(args)
+
+	stats, err := services.CanonicalizeTags(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	mode := "已更新"
+	if *dryRun {
+		mode = "待更新(dry-run)"
+	}
+	fmt.Printf("标签规范化完成 - %s: 碰撞码 %d, 碰撞列表 %d, 碰撞结果 %d, 热门标签 %d, 合并热门标签 %d\n",
+		mode, stats.CodesUpdated, stats.ListsUpdated, stats.ResultsUpdated, stats.HotTagsUpdated, stats.HotTagsMerged)
+	return nil
+}
+
+// runDedupMatches 合并重复的碰撞记录/碰撞结果并修正碰撞码、碰撞列表的匹配数量
+// 用法: ./collision-backend dedup-matches [-dry-run]
+func runDedupMatches(args []string) error {
+	fs := flag.NewFlagSet("dedup-matches", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只统计需要修改的数据，不写入数据库")
+	fs.Parse(args)
+
+	stats, err := services.DedupMatches(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	mode := "已处理"
+	if *dryRun {
+		mode = "待处理(dry-run)"
+	}
+	fmt.Printf("匹配去重完成 - %s: 删除重复碰撞记录 %d, 删除重复碰撞结果 %d, 补齐唯一键 %d, 修正碰撞码匹配数 %d, 修正碰撞列表匹配数 %d\n",
+		mode, stats.RecordsRemoved, stats.ResultsRemoved, stats.KeysFilled, stats.CodesRecounted, stats.ListsRecounted)
+	return nil
+}
+
+// runRematch 按当前匹配配置补算指定时间范围/标签下的匹配，列出会新增(+)、会撤销(-)和用户已处理而保留(=)的匹配
+// 用法: ./collision-backend rematch [-from 2024-01-01] [-to 2024-02-01] [-tags 猫,狗] [-apply] [-resume] [-batch 200]
+func runRematch(args []string) error {
+	fs := flag.NewFlagSet("rematch", flag.ExitOnError)
+	from := fs.String("from", "", "碰撞码/碰撞列表的创建日期下限（含），格式 2006-01-02")
+	to := fs.String("to", "", "碰撞码/碰撞列表的创建日期上限（不含），格式 2006-01-02")
+	tags := fs.String("tags", "", "只补算这些标签，逗号分隔")
+	apply := fs.Bool("apply", false, "写入新增的匹配并撤销不再满足规则的匹配（默认只列出变更）")
+	resume := fs.Bool("resume", false, "从上次中断的检查点继续（参数需与上次相同）")
+	batch := fs.Int("batch", 200, "每批处理的碰撞码/碰撞列表数量")
+	fs.Parse(args)
+
+	opts := services.RematchOptions{Apply: *apply, Resume: *resume, BatchSize: *batch}
+	var err error
+	if *from != "" {
+		if opts.From, err = time.ParseInLocation("2006-01-02", *from, time.Local); err != nil {
+			return fmt.Errorf("-from 日期格式错误: %v", err)
+		}
+	}
+	if *to != "" {
+		if opts.To, err = time.ParseInLocation("2006-01-02", *to, time.Local); err != nil {
+			return fmt.Errorf("-to 日期格式错误: %v", err)
+		}
+	}
+	if *tags != "" {
+		opts.Tags = strings.Split(*tags, ",")
+	}
+
+	stats, err := services.Rematch(opts, func(change services.RematchChange) {
+		if change.Action == services.RematchAdd {
+			fmt.Printf("+ %s User%d <-> User%d 关键词: %s 类型: %s 来源: %s\n",
+				change.PairKey, change.UserID1, change.UserID2, change.Keyword, change.MatchType, change.Source)
+			return
+		}
+		if change.Action == services.RematchKeep {
+			fmt.Printf("= %s User%d <-> User%d 关键词: %s 类型: %s 原因: %s（用户已处理，保留）\n",
+				change.PairKey, change.UserID1, change.UserID2, change.Keyword, change.MatchType, change.Reason)
+			return
+		}
+		fmt.Printf("- %s User%d <-> User%d 关键词: %s 类型: %s 原因: %s\n",
+			change.PairKey, change.UserID1, change.UserID2, change.Keyword, change.MatchType, change.Reason)
+	})
+	if err != nil {
+		return fmt.Errorf("%v（已处理的批次已保存检查点，可加 -resume 继续）", err)
+	}
+
+	mode := "已处理"
+	if !*apply {
+		mode = "待处理(dry-run)"
+	}
+	fmt.Printf("补算匹配完成 - %s: 碰撞码 %d, 碰撞列表 %d, 判断候选对 %d, 新增匹配 %d, 撤销匹配 %d, 未重新判断 %d, 错误 %d\n",
+		mode, stats.CodesScanned, stats.ListsScanned, stats.PairsEvaluated, stats.Added, stats.Retracted, stats.Unverified, stats.Errors)
+	return nil
+}
+
+// runRestoreArchive 把归档的数据恢复到原表，原表中已存在的行跳过
+// 用法: ./collision-backend restore-archive -table <表名> (-file <归档文件> | [-from 2024-01-01] [-to 2024-02-01])
+func runRestoreArchive(args []string) error {
+	fs := flag.NewFlagSet("restore-archive", flag.ExitOnError)
+	table := fs.String("table", "", "要恢复的表："+strings.Join(services.RetentionTables(), ", "))
+	file := fs.String("file", "", "从归档文件恢复（.ndjson.gz），不指定时从归档表恢复")
+	from := fs.String("from", "", "从归档表恢复时的时间下限（含），格式 2006-01-02")
+	to := fs.String("to", "", "从归档表恢复时的时间上限（不含），格式 2006-01-02")
+	fs.Parse(args)
+
+	if *table == "" {
+		return fmt.Errorf("需要指定 -table")
+	}
+	opts := services.RestoreOptions{File: *file}
+	var err error
+	if *from != "" {
+		if opts.From, err = time.ParseInLocation("2006-01-02", *from, time.Local); err != nil {
+			return fmt.Errorf("-from 日期格式错误: %v", err)
+		}
+	}
+	if *to != "" {
+		if opts.To, err = time.ParseInLocation("2006-01-02", *to, time.Local); err != nil {
+			return fmt.Errorf("-to 日期格式错误: %v", err)
+		}
+	}
+
+	restored, err := services.RestoreArchive(*table, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("恢复归档完成 - %s: 恢复 %d 行\n", *table, restored)
+	return nil
+}
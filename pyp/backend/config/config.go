@@ -47,6 +47,21 @@ type AppConfig struct {
 	SMTPReplyTo   string
 	// 审核配置
 	EnableCollisionAudit bool // 是否开启碰撞码审核
+	// 匹配配置
+	MatchIndexBackend string // 碰撞码倒排索引存储：auto, redis, memory
+	// 热门标签配置
+	HotTagsBackend string // 24小时热门标签小时桶存储：auto, redis, mysql
+	// 多实例部署配置
+	InstanceID            string // 实例标识，默认 主机名-进程号
+	LeaderElectionBackend string // 后台任务选主存储：auto, redis, mysql
+	LeaderLeaseSeconds    int    // 选主租约时长（秒）
+	// 归档配置
+	ArchiveDir string // 数据归档文件的本地目录
+	// 幂等键配置
+	IdempotencyBackend  string // 扣费接口幂等键存储：auto, redis, mysql
+	IdempotencyTTLHours int    // 幂等键保留时长（小时），期间重复请求直接返回首次的响应
+	// 关闭配置
+	ShutdownTimeoutSeconds int // 收到退出信号后等待处理中的请求和后台任务结束的最长时间（秒）
 }
 
 func GetConfig() *AppConfig {
@@ -87,6 +102,21 @@ func Init() {
 		SMTPReplyTo:   getEnv("SMTP_REPLY_TO", ""),
 		// 审核配置，默认关闭审核
 		EnableCollisionAudit: getEnvBool("ENABLE_COLLISION_AUDIT", false),
+		// 匹配配置，默认优先使用Redis
+		MatchIndexBackend: getEnv("MATCH_INDEX_BACKEND", "auto"),
+		// 热门标签配置，默认优先使用Redis
+		HotTagsBackend: getEnv("HOT_TAGS_BACKEND", "auto"),
+		// 多实例部署配置，默认优先使用Redis选主
+		InstanceID:            getEnv("INSTANCE_ID", defaultInstanceID()),
+		LeaderElectionBackend: getEnv("LEADER_ELECTION_BACKEND", "auto"),
+		LeaderLeaseSeconds:    getEnvInt("LEADER_LEASE_SECONDS", 30),
+		// 归档配置
+		ArchiveDir: getEnv("ARCHIVE_DIR", "archive"),
+		// 幂等键配置，默认优先使用Redis，保留24小时
+		IdempotencyBackend:  getEnv("IDEMPOTENCY_BACKEND", "auto"),
+		IdempotencyTTLHours: getEnvInt("IDEMPOTENCY_TTL_HOURS", 24),
+		// 关闭配置，默认最多等待30秒
+		ShutdownTimeoutSeconds: getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
 	}
 
 	// 初始化数据库
@@ -140,6 +170,15 @@ func initRedis() {
 	log.Println("Redis connected successfully")
 }
 
+// defaultInstanceID 默认实例标识：主机名-进程号
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/services"
+	"collision-backend/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BlockController struct{}
+
+// 获取我拉黑的用户
+func (bc *BlockController) GetBlockedUsers(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	blocks, err := services.ListBlockedUsers(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to get blocked users"))
+		return
+	}
+
+	result := make([]gin.H, 0, len(blocks))
+	for _, block := range blocks {
+		result = append(result, gin.H{
+			"user_id":    block.FriendID,
+			"nickname":   block.Friend.Nickname,
+			"avatar":     block.Friend.Avatar,
+			"blocked_at": block.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, utils.Success(result))
+}
+
+// 拉黑用户
+func (bc *BlockController) BlockUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid request"))
+		return
+	}
+
+	if req.UserID == userID.(uint) {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Cannot block yourself"))
+		return
+	}
+
+	var target models.User
+	if err := config.DB.First(&target, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, utils.Error(404, "User not found"))
+		return
+	}
+
+	if err := services.BlockUser(userID.(uint), target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to block user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "User blocked successfully"}))
+}
+
+// 取消拉黑
+func (bc *BlockController) UnblockUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid user ID"))
+		return
+	}
+
+	found, err := services.UnblockUser(userID.(uint), uint(targetID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to unblock user"))
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, utils.Error(404, "User is not blocked"))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "User unblocked successfully"}))
+}
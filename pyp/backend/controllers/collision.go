@@ -12,6 +12,7 @@ import (
 	"collision-backend/config"
 	"collision-backend/models"
 	"collision-backend/services"
+	"collision-backend/tagnorm"
 	"collision-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -121,9 +122,8 @@ func (cc *CollisionController) CreateCode(c *gin.Context) {
 		District: user.District,
 		Gender:   user.Gender,
 		Status:   "active",
-		// 直接设置为 pending 状态，确保首页显示需要审核
-		// 但状态为 active，确保立即参与匹配
-		AuditStatus: "pending",
+		// 开启审核时为待审核，审核通过后才参与匹配
+		AuditStatus: defaultAuditStatus(),
 		CostCoins:   req.CostCoins,
 	}
 
@@ -194,6 +194,17 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 		AgeMin    int    `json:"age_min"`                // æå°å¹´é¾ï¼é»è®¤20
 		AgeMax    int    `json:"age_max"`                // æå¤§å¹´é¾ï¼é»è®¤30
 		CostCoins int    `json:"cost_coins"`             // æ¶èéå¸æ°é?
+
+		// 按距离匹配（可选）：发布位置坐标，未填写时使用默认地址的坐标；radius_km 大于 0 时只匹配该距离内的碰撞码
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		RadiusKm  float64  `json:"radius_km"`
+
+		// 按已保存地址匹配（可选）：home/school/work/other，all 表示全部地址，设置后以这些地址作为搜索地区
+		TargetLabels []string `json:"target_labels"`
+
+		// 匹配模式（可选）：exact/region_reciprocal/fuzzy/geo，为空时为 region_reciprocal
+		MatchMode string `json:"match_mode"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -211,6 +222,32 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 	}
 	req.CostCoins = 10
 
+	if !validCoordinates(req.Latitude, req.Longitude) || req.RadiusKm < 0 || req.RadiusKm > services.MaxMatchRadiusKm {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid coordinates or radius"))
+		return
+	}
+	if req.Latitude == nil {
+		req.Latitude, req.Longitude = defaultCoordinates(userID.(uint))
+	}
+	if req.RadiusKm > 0 && req.Latitude == nil {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Coordinates are required for distance matching"))
+		return
+	}
+	labels, ok := targetLabels(req.TargetLabels)
+	if !ok {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid target labels"))
+		return
+	}
+	matchMode, err := services.ResolveMatchMode(req.MatchMode, &models.CollisionCode{
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		RadiusKm:  req.RadiusKm,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid match mode: "+err.Error()))
+		return
+	}
+
 	log.Printf("æ¶å°ç¢°æè¯·æ± - UserID: %v, Tag: %s, Location: %s/%s/%s/%s, Gender: %d, Age: %d-%d, CostCoins: %d",
 		userID, req.Tag, req.Country, req.Province, req.City, req.District, req.Gender, req.AgeMin, req.AgeMax, req.CostCoins)
 
@@ -230,27 +267,6 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 	// å¼å§äºå?
 	tx := config.DB.Begin()
 
-	// æ£é¤éå¸å¹¶è®°å½æ¶è´?
-	newCoins := currentUser.Coins - req.CostCoins
-	if err := tx.Model(&currentUser).Update("coins", newCoins).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-		return
-	}
-
-	// è®°å½æ¶è´¹è®°å½
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  req.CostCoins,
-		Type:   "collision",
-		Reason: "åå¸ç¢°æç ? " + req.Tag,
-	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
-		return
-	}
-
 	// åå»ºç¢°æç ï¼24å°æ¶åè¿æï¼
 	collisionCode := models.CollisionCode{
 		UserID:   userID.(uint),
@@ -263,11 +279,17 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 		AgeMin:   req.AgeMin,   // æå°å¹´é¾?
 		AgeMax:   req.AgeMax,   // æå¤§å¹´é¾?
 		Status:   "active",
-		// 直接设置为 pending 状态，确保首页显示需要审核
-		// 但状态为 active，确保立即参与匹配
-		AuditStatus: "pending",
+		// 开启审核时为待审核，审核通过后才参与匹配
+		AuditStatus: defaultAuditStatus(),
 		ExpiresAt:   time.Now().Add(24 * time.Hour), // 24å°æ¶åè¿æ?
 		CostCoins:   req.CostCoins,
+		// 发布位置（按距离匹配）
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		RadiusKm:  req.RadiusKm,
+		// 按已保存地址匹配
+		TargetLabels: labels,
+		MatchMode:    matchMode,
 	}
 
 	log.Printf("åå¤åå»ºç¢°æç ?- UserID: %d, Tag: %s, Gender: %d, Age: %d-%d, Location: %s/%s/%s/%s",
@@ -281,18 +303,30 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 		return
 	}
 
+	// 扣除金币，流水关联到新建的碰撞码
+	if _, err := services.Debit(tx, userID.(uint), req.CostCoins, services.LedgerEntry{
+		Type:    "collision",
+		Reason:  "发布碰撞码: " + req.Tag,
+		RefType: services.RefCollisionCode,
+		RefID:   uint64(collisionCode.ID),
+	}); err != nil {
+		tx.Rollback()
+		respondDebitError(c, err)
+		return
+	}
+
 	log.Printf("ç¢°æç åå»ºæå?- ID: %d, Tag: %s", collisionCode.ID, collisionCode.Tag)
 
 	// æäº¤äºå¡
 	tx.Commit()
 
 	matcher := services.NewCollisionMatcher()
-	matcher.MatchForCode(&collisionCode)
+	matcher.MatchForCode(&collisionCode, services.MatcherRunSourceSubmit)
 
 	// æ´æ°ç­é¨å³é®è¯ç»è®?å¦æææ ç­?
 	if req.Tag != "" {
 		var keyword models.HotTag
-		err := config.DB.Where("keyword = ?", req.Tag).First(&keyword).Error
+		err := config.DB.Where("keyword_canonical = ?", collisionCode.TagCanonical).First(&keyword).Error
 		if err == nil {
 			// å³é®è¯å·²å­å¨,å¢å è®¡æ°
 			config.DB.Model(&keyword).UpdateColumn("submit_count", gorm.Expr("submit_count + ?", 1))
@@ -313,9 +347,10 @@ func (cc *CollisionController) SubmitCode(c *gin.Context) {
 	// æ£æ¥æ¯å¦æåå²ç¢°æè®°å½å¯ä»¥æµ·åºæ?
 	var historicalUsersCount int64
 	config.DB.Model(&models.CollisionCode{}).
-		Where("tag = ? AND user_id != ? AND expires_at > ?", req.Tag, userID, time.Now()).
+		Where("tag_canonical = ? AND user_id != ? AND expires_at > ?", collisionCode.TagCanonical, userID, time.Now()).
 		Joins("LEFT JOIN users ON collision_codes.user_id = users.id").
 		Where("users.allow_haidilao = ?", true).
+		Scopes(services.ExcludeBlocked(userID.(uint), "collision_codes.user_id")).
 		Count(&historicalUsersCount)
 
 	canHaidilao := historicalUsersCount > 0
@@ -341,6 +376,8 @@ func (cc *CollisionController) GetMatches(c *gin.Context) {
 
 	var records []models.CollisionRecord
 	config.DB.Where("user_id1 = ? OR user_id2 = ?", userID, userID).
+		// 与自己存在拉黑关系的用户的匹配不再展示
+		Scopes(services.ExcludeBlocked(userID.(uint), "user_id1"), services.ExcludeBlocked(userID.(uint), "user_id2")).
 		Preload("User1").
 		Preload("User2").
 		Order("created_at DESC").
@@ -396,10 +433,12 @@ func (cc *CollisionController) GetMatches(c *gin.Context) {
 				"allow_passive_add": partner.AllowPassiveAdd,
 			},
 			"match_location": gin.H{
-				"country":  record.MatchCountry,
-				"province": record.MatchProvince,
-				"city":     record.MatchCity,
-				"district": record.MatchDistrict,
+				"country":     record.MatchCountry,
+				"province":    record.MatchProvince,
+				"city":        record.MatchCity,
+				"district":    record.MatchDistrict,
+				"distance_km": record.DistanceKm,    // 双方发布位置的距离，没有坐标时为 null
+				"label":       record.LocationLabel, // 产生匹配的地址标签（home/school/work/other），未按已保存地址匹配时为空
 			},
 		}
 
@@ -438,6 +477,12 @@ func (cc *CollisionController) GetMatchDetail(c *gin.Context) {
 		partner = record.User1
 	}
 
+	// 与自己存在拉黑关系的用户的匹配不再展示
+	if services.IsBlocked(userID.(uint), partner.ID) {
+		c.JSON(http.StatusNotFound, utils.Error(404, "Match record not found"))
+		return
+	}
+
 	// è®¡ç®æ¶é´ä¸ç¶æ?
 	now := time.Now()
 	timeLeft := record.AddFriendDeadline.Sub(now)
@@ -478,10 +523,12 @@ func (cc *CollisionController) GetMatchDetail(c *gin.Context) {
 			"allow_passive_add": partner.AllowPassiveAdd,
 		},
 		"match_location": gin.H{
-			"country":  record.MatchCountry,
-			"province": record.MatchProvince,
-			"city":     record.MatchCity,
-			"district": record.MatchDistrict,
+			"country":     record.MatchCountry,
+			"province":    record.MatchProvince,
+			"city":        record.MatchCity,
+			"district":    record.MatchDistrict,
+			"distance_km": record.DistanceKm,    // 双方发布位置的距离，没有坐标时为 null
+			"label":       record.LocationLabel, // 产生匹配的地址标签（home/school/work/other），未按已保存地址匹配时为空
 		},
 	}
 
@@ -553,6 +600,12 @@ func (cc *CollisionController) ForceAddFriend(c *gin.Context) {
 	}
 
 	// æ£æ¥å¯¹æ¹æ¯å¦åè®¸è¢«å¨æ·»å å¥½å?
+	// 任一方拉黑了对方时不能加好友
+	if services.IsBlocked(userID.(uint), targetUser.ID) {
+		c.JSON(http.StatusForbidden, utils.Error(403, "User is blocked"))
+		return
+	}
+
 	if !targetUser.AllowPassiveAdd {
 		c.JSON(http.StatusBadRequest, utils.Error(400, "Target user does not allow passive friend addition"))
 		return
@@ -561,23 +614,15 @@ func (cc *CollisionController) ForceAddFriend(c *gin.Context) {
 	// å¼å§äºå?
 	tx := config.DB.Begin()
 
-	// æ£é¤éå¸
-	if err := tx.Model(&currentUser).Update("coins", currentUser.Coins-req.CostCoins).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-		return
-	}
-
-	// è®°å½æ¶è´¹
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  req.CostCoins,
-		Type:   "force_add",
-		Reason: "å¼ºå¶æ·»å å¥½å: " + targetUser.Nickname,
-	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
+	// 扣除金币，流水关联到匹配记录
+	if _, err := services.Debit(tx, userID.(uint), req.CostCoins, services.LedgerEntry{
+		Type:    "force_add",
+		Reason:  "强制添加好友: " + targetUser.Nickname,
+		RefType: services.RefCollisionRecord,
+		RefID:   uint64(record.ID),
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+		respondDebitError(c, err)
 		return
 	}
 
@@ -694,6 +739,12 @@ func (cc *CollisionController) AddFriend(c *gin.Context) {
 	}
 
 	// äºå¡åå»ºå¥½åå³ç³»
+	// 任一方拉黑了对方时不能加好友
+	if services.IsBlocked(userID.(uint), targetUser.ID) {
+		c.JSON(http.StatusForbidden, utils.Error(403, "User is blocked"))
+		return
+	}
+
 	tx := config.DB.Begin()
 
 	var existingFriend models.Friend
@@ -806,7 +857,7 @@ func (cc *CollisionController) Haidilao(c *gin.Context) {
 
 	// æ¥æ¾åå²ä¸ä½¿ç¨è¿è¯¥æ ç­¾ä¸åè®¸è¢«æµ·åºæçç¨æ?
 	var historicalCodes []models.CollisionCode
-	err := config.DB.Where("tag = ? AND user_id != ?", req.Tag, userID).
+	err := config.DB.Where("tag_canonical = ? AND user_id != ?", tagnorm.Canonical(req.Tag), userID).
 		Joins("LEFT JOIN users ON collision_codes.user_id = users.id").
 		Where("users.allow_haidilao = ?", true).
 		Preload("User").
@@ -823,9 +874,14 @@ func (cc *CollisionController) Haidilao(c *gin.Context) {
 	}
 
 	// å»éç¨æ·IDï¼ä¸ä¸ªç¨æ·å¯è½æå¤ä¸ªç¢°æç ï¼
+	// 与自己存在拉黑关系的用户不会被捞到
+	blocked := make(map[uint]bool)
+	for _, id := range services.BlockedUserIDs(userID.(uint)) {
+		blocked[id] = true
+	}
 	userMap := make(map[uint]models.User)
 	for _, code := range historicalCodes {
-		if code.User.ID != 0 && code.User.AllowHaidilao {
+		if code.User.ID != 0 && code.User.AllowHaidilao && !blocked[code.User.ID] {
 			userMap[code.User.ID] = code.User
 		}
 	}
@@ -848,23 +904,15 @@ func (cc *CollisionController) Haidilao(c *gin.Context) {
 	// å¼å§äºå?
 	tx := config.DB.Begin()
 
-	// æ£é¤éå¸
-	if err := tx.Model(&currentUser).Update("coins", currentUser.Coins-req.CostCoins).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-		return
-	}
-
-	// è®°å½æ¶è´¹
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  req.CostCoins,
-		Type:   "haidilao",
-		Reason: "æµ·åºæç¨æ? " + selectedUser.Nickname + " (æ ç­¾: " + req.Tag + ")",
-	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
+	// 扣除金币，流水关联到捞到的用户
+	if _, err := services.Debit(tx, userID.(uint), req.CostCoins, services.LedgerEntry{
+		Type:    "haidilao",
+		Reason:  "海底捞用户: " + selectedUser.Nickname + " (标签: " + req.Tag + ")",
+		RefType: services.RefUser,
+		RefID:   uint64(selectedUser.ID),
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+		respondDebitError(c, err)
 		return
 	}
 
@@ -968,7 +1016,7 @@ func (cc *CollisionController) GetMyCollisionCode(c *gin.Context) {
 	var keyword models.HotTag
 	isBlackhole := false
 	if collisionCode.Tag != "" {
-		err = config.DB.Where("keyword = ?", collisionCode.Tag).First(&keyword).Error
+		err = config.DB.Where("keyword_canonical = ?", tagnorm.Canonical(collisionCode.Tag)).First(&keyword).Error
 		if err == nil && keyword.Status == "blackhole" {
 			isBlackhole = true
 		}
@@ -992,6 +1040,12 @@ func (cc *CollisionController) SearchCollisionCodes(c *gin.Context) {
 
 	var req struct {
 		Keyword string `json:"keyword" binding:"required"`
+
+		// 按距离搜索（可选）：radius_km 大于 0 时只返回该距离内的碰撞码，按距离由近到远排序
+		// 中心点未填写时使用默认地址的坐标
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		RadiusKm  float64  `json:"radius_km"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1001,28 +1055,51 @@ func (cc *CollisionController) SearchCollisionCodes(c *gin.Context) {
 
 	// æ¥æ¾å¹éçç¢°æç ï¼æé¤èªå·±ï¼
 	var collisionCodes []models.CollisionCode
-	err := config.DB.Where("tag = ? AND user_id != ? AND status != 'blackhole' AND status != 'invalid'",
-		req.Keyword, userID).
-		Preload("User").
-		Order("created_at DESC").
-		Limit(50). // éå¶è¿å50æ?
-		Find(&collisionCodes).Error
+	query := config.DB.Where("tag_canonical = ? AND user_id != ? AND status != 'blackhole' AND status != 'invalid'",
+		tagnorm.Canonical(req.Keyword), userID).
+		Scopes(services.ExcludeBlocked(userID.(uint), "user_id")) // 不返回与自己存在拉黑关系的用户
+	if req.RadiusKm > 0 {
+		if !validCoordinates(req.Latitude, req.Longitude) || req.RadiusKm > services.MaxMatchRadiusKm {
+			c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid coordinates or radius"))
+			return
+		}
+		if req.Latitude == nil {
+			req.Latitude, req.Longitude = defaultCoordinates(userID.(uint))
+		}
+		if req.Latitude == nil {
+			c.JSON(http.StatusBadRequest, utils.Error(400, "Coordinates are required for distance search"))
+			return
+		}
+		query = query.Scopes(services.NearbyScope(*req.Latitude, *req.Longitude, req.RadiusKm))
+	} else {
+		query = query.Limit(50)
+	}
+	err := query.Preload("User").Order("created_at DESC").Find(&collisionCodes).Error
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.Error(500, "æç´¢å¤±è´¥"))
 		return
 	}
 
+	// 按距离搜索时精确过滤并按距离排序，最多返回 50 条
+	var distances []float64
+	if req.RadiusKm > 0 {
+		collisionCodes, distances = services.WithinDistance(collisionCodes, *req.Latitude, *req.Longitude, req.RadiusKm)
+		if len(collisionCodes) > 50 {
+			collisionCodes, distances = collisionCodes[:50], distances[:50]
+		}
+	}
+
 	// æå»ºè¿åæ°æ®ï¼åå«ç¨æ·åºæ¬ä¿¡æ?
 	var results []gin.H
-	for _, code := range collisionCodes {
+	for i, code := range collisionCodes {
 		// éèå®æ´å¾®ä¿¡å·ï¼åªæ¾ç¤ºé¨å?
 		wechatNo := code.User.WechatNo
 		if len(wechatNo) > 4 {
 			wechatNo = wechatNo[:2] + "***" + wechatNo[len(wechatNo)-2:]
 		}
 
-		results = append(results, gin.H{
+		item := gin.H{
 			"id":        code.ID,
 			"user_id":   code.UserID,
 			"nickname":  code.User.Nickname,
@@ -1032,7 +1109,11 @@ func (cc *CollisionController) SearchCollisionCodes(c *gin.Context) {
 			"tag":       code.Tag,
 			"location":  fmt.Sprintf("%s %s %s", code.Province, code.City, code.District),
 			"wechat_no": wechatNo, // é¨åéèçå¾®ä¿¡å·
-		})
+		}
+		if distances != nil {
+			item["distance_km"] = distances[i]
+		}
+		results = append(results, item)
 	}
 
 	c.JSON(http.StatusOK, utils.Success(results))
@@ -1068,6 +1149,12 @@ func (cc *CollisionController) SendFriendRequest(c *gin.Context) {
 		return
 	}
 
+	// 任一方拉黑了对方时不能加好友
+	if services.IsBlocked(userID.(uint), targetUser.ID) {
+		c.JSON(http.StatusForbidden, utils.Error(403, "User is blocked"))
+		return
+	}
+
 	// æ£æ¥æ¯å¦å·²ç»æ¯å¥½å
 	var existingFriend models.Friend
 	err := config.DB.Where(
@@ -1139,6 +1226,9 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 			AgeMin    int    `json:"age_min"`
 			AgeMax    int    `json:"age_max"`
 			CostCoins int    `json:"cost_coins"`
+			// 组合碰撞码：多个标签作为一个碰撞码，至少 min_overlap 个标签与对方重合才匹配
+			Tags       []string `json:"tags"`
+			MinOverlap int      `json:"min_overlap"`
 		} `json:"codes" binding:"required,min=1"`
 	}
 
@@ -1178,16 +1268,11 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 	// å¼å§äºå?
 	tx := config.DB.Begin()
 
-	// æ£é¤ç¢°æå¸?
-	if err := tx.Model(&user).UpdateColumn("coins", gorm.Expr("coins - ?", totalCost)).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-		return
-	}
-
 	// æ¹éåå»ºç¢°æç ?
 	successCount := 0
 	failedCodes := []string{}
+	createdCodes := []models.CollisionCode{}
+	balance := user.Coins
 
 	for i, codeReq := range req.Codes {
 		collisionCode := models.CollisionCode{
@@ -1201,12 +1286,15 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 			AgeMin:   codeReq.AgeMin,
 			AgeMax:   codeReq.AgeMax,
 			Status:   "active",
-			// 直接设置为 pending 状态，确保首页显示需要审核
-			// 但状态为 active，确保立即参与匹配
-			AuditStatus: "pending",
+			// 开启审核时为待审核，审核通过后才参与匹配
+			AuditStatus: defaultAuditStatus(),
 			ExpiresAt:   time.Now().Add(24 * time.Hour), // 24å°æ¶åè¿æ?
 			CostCoins:   perCost,
 		}
+		if len(codeReq.Tags) > 0 {
+			collisionCode.MinOverlap = codeReq.MinOverlap
+			collisionCode.SetTags(append([]string{codeReq.Tag}, codeReq.Tags...))
+		}
 
 		if err := tx.Create(&collisionCode).Error; err != nil {
 			log.Printf("æ¹éåå»ºç¢°æç å¤±è´?- Index: %d, Error: %v", i, err)
@@ -1214,19 +1302,37 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 			continue
 		}
 
+		// 每个创建成功的碰撞码单独扣费，流水关联到该碰撞码
+		newBalance, err := services.Debit(tx, userID.(uint), perCost, services.LedgerEntry{
+			Type:    "collision",
+			Reason:  "批量发布碰撞码: " + collisionCode.Tag,
+			RefType: services.RefCollisionCode,
+			RefID:   uint64(collisionCode.ID),
+		})
+		if err != nil {
+			tx.Rollback()
+			respondDebitError(c, err)
+			return
+		}
+		balance = newBalance
+
 		successCount++
+		createdCodes = append(createdCodes, collisionCode)
 
 		// æ´æ°ç­é¨å³é®è¯ç»è®?å¦æææ ç­?
-		if codeReq.Tag != "" {
+		for _, tag := range collisionCode.TagList() {
+			if tag == "" {
+				continue
+			}
 			var keyword models.HotTag
-			err := tx.Where("keyword = ?", codeReq.Tag).First(&keyword).Error
+			err := tx.Where("keyword_canonical = ?", tagnorm.Canonical(tag)).First(&keyword).Error
 			if err == nil {
 				// å³é®è¯å·²å­å¨,å¢å è®¡æ°
 				tx.Model(&keyword).UpdateColumn("submit_count", gorm.Expr("submit_count + ?", 1))
 			} else {
 				// å³é®è¯ä¸å­å¨,åå»ºæ°ç
 				newKeyword := models.HotTag{
-					Keyword:     codeReq.Tag,
+					Keyword:     tag,
 					Status:      "hide",
 					SubmitCount: 1,
 				}
@@ -1245,6 +1351,12 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 	// æäº¤äºå¡
 	tx.Commit()
 
+	// 提交成功后逐个进入匹配
+	matcher := services.NewCollisionMatcher()
+	for i := range createdCodes {
+		matcher.MatchForCode(&createdCodes[i], services.MatcherRunSourceSubmit)
+	}
+
 	// æå»ºååºæ¶æ¯
 	message := fmt.Sprintf("æåæäº¤%dä¸ªç¢°æç ", successCount)
 	if len(failedCodes) > 0 {
@@ -1255,7 +1367,7 @@ func (cc *CollisionController) BatchSubmitCodes(c *gin.Context) {
 		"message":       message,
 		"success_count": successCount,
 		"failed_count":  len(failedCodes),
-		"total_cost":    totalCost,
-		"new_balance":   user.Coins - totalCost,
+		"total_cost":    perCost * successCount,
+		"new_balance":   balance,
 	}))
 }
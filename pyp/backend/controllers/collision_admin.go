@@ -7,6 +7,7 @@ import (
 
 	"collision-backend/config"
 	"collision-backend/models"
+	"collision-backend/services"
 	"collision-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -77,6 +78,10 @@ func (cc *CollisionController) ApproveCollisionCode(c *gin.Context) {
 		return
 	}
 
+	// 审核通过后才参与匹配，立即执行一次
+	code.AuditStatus = "approved"
+	services.NewCollisionMatcher().MatchForCode(&code, services.MatcherRunSourceSubmit)
+
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "approved"}))
 }
 
@@ -112,30 +117,11 @@ func (cc *CollisionController) RejectCollisionCode(c *gin.Context) {
 	}
 
 	if code.CostCoins > 0 {
-		var user models.User
-		if err := tx.First(&user, code.UserID).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to load user"))
-			return
-		}
-
-		if err := tx.Model(&user).Update("coins", user.Coins+code.CostCoins).Error; err != nil {
+		if _, err := services.Credit(tx, code.UserID, code.CostCoins, rejectRefundEntry(code)); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to refund coins"))
 			return
 		}
-
-		consumeRecord := models.ConsumeRecord{
-			UserID: code.UserID,
-			Coins:  code.CostCoins,
-			Type:   "refund",
-			Reason: "Collision code rejected: " + code.Tag,
-		}
-		if err := tx.Create(&consumeRecord).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create refund record"))
-			return
-		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -144,6 +130,9 @@ func (cc *CollisionController) RejectCollisionCode(c *gin.Context) {
 		return
 	}
 
+	// 审核拒绝的碰撞码不再参与匹配
+	services.NewCollisionMatcher().RemoveCode(code.CanonicalTags(), code.ID)
+
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "rejected"}))
 }
 
@@ -170,6 +159,14 @@ func (cc *CollisionController) BatchApproveCollisionCodes(c *gin.Context) {
 		return
 	}
 
+	// 审核通过后才参与匹配，立即执行一次
+	var codes []models.CollisionCode
+	config.DB.Where("id IN ?", req.IDs).Find(&codes)
+	matcher := services.NewCollisionMatcher()
+	for i := range codes {
+		matcher.MatchForCode(&codes[i], services.MatcherRunSourceSubmit)
+	}
+
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "approved"}))
 }
 
@@ -205,28 +202,11 @@ func (cc *CollisionController) BatchRejectCollisionCodes(c *gin.Context) {
 		}
 
 		if code.CostCoins > 0 {
-			var user models.User
-			if err := tx.First(&user, code.UserID).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to load user"))
-				return
-			}
-			if err := tx.Model(&user).Update("coins", user.Coins+code.CostCoins).Error; err != nil {
+			if _, err := services.Credit(tx, code.UserID, code.CostCoins, rejectRefundEntry(code)); err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to refund coins"))
 				return
 			}
-			consumeRecord := models.ConsumeRecord{
-				UserID: code.UserID,
-				Coins:  code.CostCoins,
-				Type:   "refund",
-				Reason: "Collision code rejected: " + code.Tag,
-			}
-			if err := tx.Create(&consumeRecord).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create refund record"))
-				return
-			}
 		}
 	}
 
@@ -236,6 +216,11 @@ func (cc *CollisionController) BatchRejectCollisionCodes(c *gin.Context) {
 		return
 	}
 
+	matcher := services.NewCollisionMatcher()
+	for _, code := range codes {
+		matcher.RemoveCode(code.CanonicalTags(), code.ID)
+	}
+
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "rejected"}))
 }
 
@@ -256,3 +241,13 @@ func (cc *CollisionController) BatchApproveAllCollisionCodes(c *gin.Context) {
 
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "approved"}))
 }
+
+// rejectRefundEntry 审核拒绝时退回发布碰撞码的金币
+func rejectRefundEntry(code models.CollisionCode) services.LedgerEntry {
+	return services.LedgerEntry{
+		Type:    "refund",
+		Reason:  "Collision code rejected: " + code.Tag,
+		RefType: services.RefCollisionCode,
+		RefID:   uint64(code.ID),
+	}
+}
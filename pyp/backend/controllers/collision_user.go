@@ -1,8 +1,10 @@
 ﻿package controllers
 
 import (
+	"errors"
 	"fmt"
 	"html"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"collision-backend/config"
 	"collision-backend/models"
 	"collision-backend/services"
+	"collision-backend/tagnorm"
 	"collision-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -82,6 +85,7 @@ func (cc *CollisionController) GetMyCollisionCodes(c *gin.Context) {
 			"collision_status": collisionStatus,
 			"time_left":        timeLeftText,
 			"time_left_seconds": timeLeftSeconds,
+			"match_mode":        code.MatchMode,
 		})
 	}
 c.JSON(http.StatusOK, utils.Success(gin.H{
@@ -133,7 +137,12 @@ func (cc *CollisionController) UpdateMyCollisionCode(c *gin.Context) {
 
 	updates := map[string]interface{}{}
 	if req.Tag != "" && req.Tag != code.Tag {
-		updates["tag"] = req.Tag
+		updates["tag"] = tagnorm.Display(req.Tag)
+		updates["tag_canonical"] = tagnorm.Canonical(req.Tag)
+		// 修改标签后组合碰撞码变为单标签碰撞码
+		updates["tags"] = ""
+		updates["tags_canonical"] = ""
+		updates["min_overlap"] = 1
 		updates["audit_status"] = defaultAuditStatus()
 		updates["reject_reason"] = ""
 		updates["audit_at"] = nil
@@ -151,31 +160,14 @@ func (cc *CollisionController) UpdateMyCollisionCode(c *gin.Context) {
 
 	tx := config.DB.Begin()
 	if req.CostCoins > 0 {
-		var user models.User
-		if err := tx.First(&user, userID).Error; err != nil {
+		if _, err := services.Debit(tx, userID.(uint), req.CostCoins, services.LedgerEntry{
+			Type:    "renew_collision",
+			Reason:  "Update collision code: " + code.Tag,
+			RefType: services.RefCollisionCode,
+			RefID:   uint64(code.ID),
+		}); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to load user"))
-			return
-		}
-		if user.Coins < req.CostCoins {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, utils.Error(400, "Insufficient coins"))
-			return
-		}
-		if err := tx.Model(&user).Update("coins", user.Coins-req.CostCoins).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-			return
-		}
-		consumeRecord := models.ConsumeRecord{
-			UserID: userID.(uint),
-			Coins:  req.CostCoins,
-			Type:   "renew_collision",
-			Reason: "Update collision code: " + code.Tag,
-		}
-		if err := tx.Create(&consumeRecord).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+			respondDebitError(c, err)
 			return
 		}
 	}
@@ -192,9 +184,16 @@ func (cc *CollisionController) UpdateMyCollisionCode(c *gin.Context) {
 		return
 	}
 
-	if _, ok := updates["tag"]; ok {
+	// 标签变更或续期后重新进入匹配
+	_, tagChanged := updates["tag"]
+	if tagChanged || req.Days > 0 {
+		oldTags := code.CanonicalTags()
+		config.DB.First(&code, code.ID)
 		matcher := services.NewCollisionMatcher()
-		matcher.MatchForCode(&code)
+		if tagChanged {
+			matcher.RemoveCode(oldTags, code.ID)
+		}
+		matcher.MatchForCode(&code, services.MatcherRunSourceResubmit)
 	}
 
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "updated"}))
@@ -214,58 +213,52 @@ func (cc *CollisionController) RenewCollisionCode(c *gin.Context) {
 		return
 	}
 
-	const costCoins = 10
-	var user models.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to load user"))
-		return
-	}
-	if user.Coins < costCoins {
-		c.JSON(http.StatusBadRequest, utils.Error(400, "Insufficient coins"))
+	if err := services.RenewCode(&code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInsufficientCoins):
+			c.JSON(http.StatusBadRequest, utils.Error(400, "Insufficient coins"))
+		case errors.Is(err, services.ErrRenewConflict):
+			c.JSON(http.StatusConflict, utils.Error(409, "Collision code was renewed by another request"))
+		default:
+			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to renew collision code"))
+		}
 		return
 	}
 
-	now := time.Now()
-	newExpire := now.Add(24 * time.Hour)
-	if code.ExpiresAt.After(now) {
-		newExpire = code.ExpiresAt.Add(24 * time.Hour)
-	}
+	config.DB.First(&code, code.ID)
+	matcher := services.NewCollisionMatcher()
+	matcher.MatchForCode(&code, services.MatcherRunSourceResubmit)
 
-	tx := config.DB.Begin()
-	if err := tx.Model(&user).Update("coins", user.Coins-costCoins).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
+	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "renewed"}))
+}
+
+// SetCollisionCodeAutoRenew 开启/关闭碰撞码到期前自动续期
+func (cc *CollisionController) SetCollisionCodeAutoRenew(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
 		return
 	}
 
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  costCoins,
-		Type:   "renew_collision",
-		Reason: "Renew collision code: " + code.Tag,
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
 	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid request data"))
 		return
 	}
 
-	if err := tx.Model(&code).Updates(map[string]interface{}{
-		"expires_at": newExpire,
-		"status":     "active",
-	}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to renew collision code"))
+	var code models.CollisionCode
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&code).Error; err != nil {
+		c.JSON(http.StatusNotFound, utils.Error(404, "Collision code not found"))
 		return
 	}
-
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to commit renewal"))
+	if err := config.DB.Model(&code).UpdateColumn("auto_renew", *req.Enabled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update auto renew"))
 		return
 	}
 
-	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "renewed"}))
+	c.JSON(http.StatusOK, utils.Success(gin.H{"auto_renew": *req.Enabled}))
 }
 
 func (cc *CollisionController) ResubmitCollisionCode(c *gin.Context) {
@@ -294,21 +287,14 @@ func (cc *CollisionController) ResubmitCollisionCode(c *gin.Context) {
 	}
 
 	tx := config.DB.Begin()
-	if err := tx.Model(&user).Update("coins", user.Coins-costCoins).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
-		return
-	}
-
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  costCoins,
-		Type:   "collision_submit",
-		Reason: "Resubmit collision code: " + code.Tag,
-	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
+	if _, err := services.Debit(tx, userID.(uint), costCoins, services.LedgerEntry{
+		Type:    "collision_submit",
+		Reason:  "Resubmit collision code: " + code.Tag,
+		RefType: services.RefCollisionCode,
+		RefID:   uint64(code.ID),
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+		respondDebitError(c, err)
 		return
 	}
 
@@ -331,8 +317,9 @@ func (cc *CollisionController) ResubmitCollisionCode(c *gin.Context) {
 		return
 	}
 
+	config.DB.First(&code, code.ID)
 	matcher := services.NewCollisionMatcher()
-	matcher.MatchForCode(&code)
+	matcher.MatchForCode(&code, services.MatcherRunSourceResubmit)
 
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "resubmitted"}))
 }
@@ -372,12 +359,16 @@ func (cc *CollisionController) SendEmailToMatchedUser(c *gin.Context) {
 	}
 
 	var collisionResult models.CollisionResult
-	if err := config.DB.Where("user_id = ? AND matched_user_id = ? AND keyword = ?", userID, req.MatchedUserID, req.Keyword).
+	if err := config.DB.Where("user_id = ? AND matched_user_id = ? AND keyword_canonical = ?", userID, req.MatchedUserID, tagnorm.Canonical(req.Keyword)).
 		Order("created_at DESC").
 		First(&collisionResult).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "碰撞记录不存在"})
 		return
 	}
+	if services.IsBlocked(userID, uint(collisionResult.MatchedUserID)) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "对方已被拉黑或已拉黑你"})
+		return
+	}
 
 	var user models.User
 	if err := config.DB.First(&user, userID).Error; err != nil {
@@ -409,18 +400,35 @@ func (cc *CollisionController) SendEmailToMatchedUser(c *gin.Context) {
 		return
 	}
 
+	// 先扣除积分再发送，发送失败时退回
+	entry := services.LedgerEntry{
+		Type:    "send_email",
+		Reason:  "Email to matched user: " + collisionResult.Keyword,
+		RefType: services.RefCollisionResult,
+		RefID:   collisionResult.ID,
+	}
+	balance, err := services.Debit(config.DB, userID, 1, entry)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientCoins) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "积分不足"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "积分扣除失败"})
+		return
+	}
+
 	htmlBody := "<p>小程序匹配成功，用户给你发信息啦：</p><p>" + html.EscapeString(content) + "</p>"
 	emailService := services.NewSMTPEmailService(config.DB)
 	if err := emailService.SendEmail(uint64(userID), matchedContact.Email, subject, htmlBody, "collision"); err != nil {
+		entry.Type = "refund"
+		entry.Reason = "Email failed: " + collisionResult.Keyword
+		if _, refundErr := services.Credit(config.DB, userID, 1, entry); refundErr != nil {
+			log.Printf("退回发送邮件积分失败: user_id=%d err=%v", userID, refundErr)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "邮件发送失败: " + err.Error()})
 		return
 	}
 
-	if err := config.DB.Model(&user).Update("coins", user.Coins-1).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "积分扣除失败"})
-		return
-	}
-
 	_ = config.DB.Model(&collisionResult).Updates(map[string]interface{}{
 		"email_sent":    true,
 		"email_sent_at": time.Now(),
@@ -430,7 +438,7 @@ func (cc *CollisionController) SendEmailToMatchedUser(c *gin.Context) {
 		"code":    200,
 		"message": "邮件发送成功",
 		"data": gin.H{
-			"remaining_coins": user.Coins - 1,
+			"remaining_coins": balance,
 		},
 	})
 }
@@ -1,8 +1,10 @@
 ﻿package controllers
 
 import (
+	"errors"
 	"fmt"
 	"html"
+	"log"
 	"net/http"
 	"sort"
 	"strconv"
@@ -12,8 +14,10 @@ import (
 	"collision-backend/config"
 	"collision-backend/models"
 	"collision-backend/services"
+	"collision-backend/tagnorm"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // maskKeyword 关键词脱敏处理：替换50%的字符为*
@@ -37,75 +41,42 @@ func maskKeyword(keyword string) string {
 	return string(runes)
 }
 
-// GetHotTags24h 获取24小时热门标签（只展示前三位）
-func GetHotTags24h(c *gin.Context) {
-	var tags []models.HotTag
-
-	// 先获取所有状态为show的标签
-	config.DB.Where("status = ?", "show").Find(&tags)
-
-	// 使用Go代码进行排序，确保按count_24h降序
-	// 注意：数据库中存在count_24h和count24h两个字段，我们需要确保使用正确的字段
-	for i := 0; i < len(tags); i++ {
-		for j := i + 1; j < len(tags); j++ {
-			// 比较两个标签的count_24h，将较大的放在前面
-			if tags[i].Count24h < tags[j].Count24h {
-				tags[i], tags[j] = tags[j], tags[i]
-			}
-		}
-	}
-
-	// 只取前3个
-	if len(tags) > 3 {
-		tags = tags[:3]
+// splitMatchedTags 碰撞结果中重合的标签列表，旧数据没有记录时退回关键词
+func splitMatchedTags(result models.CollisionResult) []string {
+	if result.MatchedTags == "" {
+		return []string{result.Keyword}
 	}
+	return strings.Split(result.MatchedTags, ",")
+}
 
-	// 添加排名
-	result := make([]gin.H, len(tags))
-	for i, tag := range tags {
-		result[i] = gin.H{
-			"rank":    i + 1,
-			"keyword": tag.Keyword,
-			"count":   tag.Count24h,
-		}
+// GetHotTags24h 获取24小时热门标签（只展示前三位）
+func GetHotTags24h(c *gin.Context) {
+	tags, err := services.HotTags24h(3)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "failed to get hot tags"})
+		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "success",
-		"data":    result,
-	})
+	respondHotTags(c, tags)
 }
 
-// GetHotTagsAll 获取总榜热门标签
+// GetHotTagsAll 获取总榜热门标签（只展示前三位）
 func GetHotTagsAll(c *gin.Context) {
-	var tags []models.HotTag
-
-	// 先获取所有状态为show的标签
-	config.DB.Where("status = ?", "show").Find(&tags)
-
-	// 使用Go代码进行排序，确保按count_total降序
-	for i := 0; i < len(tags); i++ {
-		for j := i + 1; j < len(tags); j++ {
-			// 比较两个标签的count_total，将较大的放在前面
-			if tags[i].CountTotal < tags[j].CountTotal {
-				tags[i], tags[j] = tags[j], tags[i]
-			}
-		}
-	}
-
-	// 只取前3个
-	if len(tags) > 3 {
-		tags = tags[:3]
+	tags, err := services.HotTagsAll(3)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "failed to get hot tags"})
+		return
 	}
+	respondHotTags(c, tags)
+}
 
-	// 添加排名
+// respondHotTags 返回带排名的热门标签
+func respondHotTags(c *gin.Context, tags []services.HotTagRank) {
 	result := make([]gin.H, len(tags))
 	for i, tag := range tags {
 		result[i] = gin.H{
 			"rank":    i + 1,
 			"keyword": tag.Keyword,
-			"count":   tag.CountTotal,
+			"count":   tag.Count,
 		}
 	}
 
@@ -127,8 +98,12 @@ func CreateCollisionList(c *gin.Context) {
 	var req struct {
 		Keyword  string `json:"keyword" binding:"required"`
 		Duration int    `json:"duration"`
+
+		// 匹配模式（可选），geo 模式需要默认地址带坐标并设置 radius_km
+		MatchMode string  `json:"match_mode"`
+		RadiusKm  float64 `json:"radius_km"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || req.RadiusKm < 0 || req.RadiusKm > services.MaxMatchRadiusKm {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
 		return
 	}
@@ -137,9 +112,20 @@ func CreateCollisionList(c *gin.Context) {
 		req.Duration = 30
 	}
 
+	latitude, longitude := defaultCoordinates(userID)
+	matchMode, err := services.ResolveMatchMode(req.MatchMode, &models.CollisionCode{
+		Latitude:  latitude,
+		Longitude: longitude,
+		RadiusKm:  req.RadiusKm,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
 	// 检查是否已存在
 	var existingList models.CollisionList
-	if err := config.DB.Where("user_id = ? AND keyword = ? AND status = 'active'", userID, req.Keyword).
+	if err := config.DB.Where("user_id = ? AND keyword_canonical = ? AND status = 'active'", userID, tagnorm.Canonical(req.Keyword)).
 		First(&existingList).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "该关键词已在碰撞列表中"})
 		return
@@ -158,10 +144,7 @@ func CreateCollisionList(c *gin.Context) {
 		return
 	}
 
-	// 扣除积分
-	config.DB.Model(&user).Update("coins", user.Coins-costPoints)
-
-	// 创建碰撞列表
+	// 创建碰撞列表并扣除积分，流水关联到新建的碰撞列表
 	collisionList := models.CollisionList{
 		UserID:     uint64(userID),
 		Keyword:    req.Keyword,
@@ -169,11 +152,33 @@ func CreateCollisionList(c *gin.Context) {
 		CostPoints: costPoints,
 		Status:     "active",
 		ExpireAt:   time.Now().AddDate(0, 0, req.Duration),
+		MatchMode:  matchMode,
+		RadiusKm:   req.RadiusKm,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&collisionList).Error; err != nil {
+			return err
+		}
+		_, err := services.Debit(tx, userID, costPoints, services.LedgerEntry{
+			Type:    "collision_list",
+			Reason:  "Create collision list: " + collisionList.Keyword,
+			RefType: services.RefCollisionList,
+			RefID:   collisionList.ID,
+		})
+		return err
+	})
+	if err != nil {
+		respondV3DebitError(c, err)
+		return
 	}
-	config.DB.Create(&collisionList)
 
 	// 更新热门标签统计
-	updateHotTag(req.Keyword)
+	services.RecordHotTag(req.Keyword, true)
+
+	// 立即与已有的碰撞码、碰撞列表匹配
+	if services.NewCollisionMatcher().MatchForList(&collisionList, services.MatcherRunSourceSubmit) > 0 {
+		config.DB.First(&collisionList, collisionList.ID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -235,6 +240,8 @@ func GetCollisionLists(c *gin.Context) {
 			"match_count": list.MatchCount,
 			"created_at":  formattedCreatedAt,
 			"updated_at":  formattedUpdatedAt,
+			"match_mode":  list.MatchMode,
+			"radius_km":   list.RadiusKm,
 
 			// 原有自定义字段（为了向后兼容）
 			"is_expired":        isExpired,
@@ -274,8 +281,9 @@ func UpdateCollisionList(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status"`
-		Extend int    `json:"extend"`
+		Status    string `json:"status"`
+		Extend    int    `json:"extend"`
+		AutoRenew *bool  `json:"auto_renew"` // 到期前自动续期
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
@@ -295,22 +303,32 @@ func UpdateCollisionList(c *gin.Context) {
 			return
 		}
 
-		// 扣除积分
-		config.DB.Model(&user).Update("coins", user.Coins-req.Extend)
-
-		// 延长过期时间
-		list.ExpireAt = list.ExpireAt.AddDate(0, 0, req.Extend)
-		list.Duration += req.Extend
-		list.CostPoints += req.Extend
+		// 扣除积分并延长过期时间
+		if err := services.ExtendList(&list, req.Extend); err != nil {
+			if errors.Is(err, services.ErrRenewConflict) {
+				c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "碰撞列表已被其他请求修改，请刷新后重试"})
+				return
+			}
+			respondV3DebitError(c, err)
+			return
+		}
 	}
 
 	// 更新状态
 	if req.Status != "" {
 		list.Status = req.Status
 	}
+	if req.AutoRenew != nil {
+		list.AutoRenew = *req.AutoRenew
+	}
 
 	config.DB.Save(&list)
 
+	// 续期或重新启用后立即匹配
+	if services.NewCollisionMatcher().MatchForList(&list, services.MatcherRunSourceResubmit) > 0 {
+		config.DB.First(&list, list.ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "更新成功",
@@ -350,15 +368,18 @@ func GetCollisionResults(c *gin.Context) {
 
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
 	keyword := c.Query("keyword") // 新增：接受关键词参数
+	order := c.Query("order")     // score: 按匹配得分排序
 	startDate := time.Now().AddDate(0, 0, -days)
 
 	// 先获取匹配结果，然后在Go代码中进行分组
 	var allResults []models.CollisionResult
-	query := config.DB.Where("user_id = ? AND matched_at >= ?", userID, startDate)
+	// 与自己存在拉黑关系的用户的碰撞结果不再展示（双向）
+	query := config.DB.Where("user_id = ? AND matched_at >= ?", userID, startDate).
+		Scopes(services.ExcludeBlocked(userID, "matched_user_id"))
 
 	// 如果提供了关键词，按关键词过滤
 	if keyword != "" {
-		query = query.Where("keyword = ?", keyword)
+		query = query.Where("keyword_canonical = ?", tagnorm.Canonical(keyword))
 	}
 
 	query.Order("matched_at DESC").Find(&allResults)
@@ -366,8 +387,8 @@ func GetCollisionResults(c *gin.Context) {
 	// 在Go代码中按日期和关键词分组
 	groupMap := make(map[string][]models.CollisionResult)
 	for _, result := range allResults {
-		// 使用完整的日期时间格式作为分组键，但只精确到天
-		groupKey := result.MatchedAt.Format("2006-01-02") + "_" + result.Keyword
+		// 使用完整的日期时间格式作为分组键，但只精确到天；关键词按规范形式合并
+		groupKey := result.MatchedAt.Format("2006-01-02") + "_" + tagnorm.Canonical(result.Keyword)
 		groupMap[groupKey] = append(groupMap[groupKey], result)
 	}
 
@@ -384,6 +405,17 @@ func GetCollisionResults(c *gin.Context) {
 		groupKeys[i], groupKeys[j] = groupKeys[j], groupKeys[i]
 	}
 
+	// 按得分排序：组内按得分从高到低，分组按组内最高得分从高到低
+	if order == "score" {
+		for _, key := range groupKeys {
+			matches := groupMap[key]
+			sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+		}
+		sort.SliceStable(groupKeys, func(i, j int) bool {
+			return groupMap[groupKeys[i]][0].Score > groupMap[groupKeys[j]][0].Score
+		})
+	}
+
 	// 构建结果
 	result := make([]gin.H, 0, len(groupMap))
 	for _, groupKey := range groupKeys {
@@ -418,6 +450,10 @@ func GetCollisionResults(c *gin.Context) {
 				"matched_user_id":   m.MatchedUserID,
 				"collision_list_id": m.CollisionListID,
 				"keyword":           m.Keyword,
+				"match_type":        m.MatchType,
+				"matched_tags":      splitMatchedTags(m),
+				"overlap_count":     m.OverlapCount,
+				"score":             m.Score,
 				"matched_email":     m.MatchedEmail,
 				"remark":            m.Remark,
 				"is_known":          m.IsKnown,
@@ -435,13 +471,13 @@ func GetCollisionResults(c *gin.Context) {
 		formattedDate := groupDate.Format("2006年01月02日 15:04:05")
 
 		result = append(result, gin.H{
-			"id":         groupKey,
-			"date":       formattedDate,
-			"keyword":    maskKeyword(keyword),
-			"keyword_raw": keyword,
-			"total":      total,
-			"knownCount": knownCount,
-			"matches":    matchList,
+			"id":          groupKey,
+			"date":        formattedDate,
+			"keyword":     maskKeyword(matches[0].Keyword),
+			"keyword_raw": matches[0].Keyword,
+			"total":       total,
+			"knownCount":  knownCount,
+			"matches":     matchList,
 		})
 	}
 
@@ -463,21 +499,28 @@ func GetCollisionResultDetail(c *gin.Context) {
 	id := c.Param("id") // 格式: date_keyword
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	order := c.Query("order") // score: 按匹配得分排序
 
 	// 解析ID，提取关键词
 	var dateStr, keyword string
 	fmt.Sscanf(id, "%[^_]_%s", &dateStr, &keyword)
 
 	var matches []models.CollisionResult
-	query := config.DB.Where("user_id = ?", userID)
+	query := config.DB.Where("user_id = ?", userID).
+		Scopes(services.ExcludeBlocked(userID, "matched_user_id"))
 
 	// 如果解析到关键词，按关键词过滤
 	if keyword != "" {
-		query = query.Where("keyword = ?", keyword)
+		query = query.Where("keyword_canonical = ?", tagnorm.Canonical(keyword))
 	}
 
-	query.Order("CASE WHEN remark = '' THEN 0 ELSE 1 END, matched_at DESC").
-		Offset(offset).
+	// 得分在匹配产生时计算，并由定期任务刷新，这里只读取
+	if order == "score" {
+		query = query.Order("score DESC, matched_at DESC")
+	} else {
+		query = query.Order("CASE WHEN remark = '' THEN 0 ELSE 1 END, matched_at DESC")
+	}
+	query.Offset(offset).
 		Limit(limit).
 		Find(&matches)
 
@@ -514,6 +557,10 @@ func GetCollisionResultDetail(c *gin.Context) {
 			"matched_user_id":   m.MatchedUserID,
 			"collision_list_id": m.CollisionListID,
 			"keyword":           m.Keyword,
+			"match_type":        m.MatchType,
+			"matched_tags":      splitMatchedTags(m),
+			"overlap_count":     m.OverlapCount,
+			"score":             m.Score,
 			"matched_email":     displayEmail, // 使用处理后的邮箱显示
 			"remark":            m.Remark,
 			"is_known":          m.IsKnown,
@@ -636,6 +683,16 @@ func GetCommonKeywords(c *gin.Context) {
 		return
 	}
 
+	if services.IsBlocked(userID, uint(req.MatchedUserID)) {
+		c.JSON(http.StatusOK, gin.H{
+			"code":            200,
+			"message":         "success",
+			"common_keywords": []string{},
+			"total":           0,
+		})
+		return
+	}
+
 	// 获取当前用户与对方用户碰撞的所有关键词
 	var myKeywords []string
 	config.DB.Model(&models.CollisionResult{}).
@@ -649,15 +706,18 @@ func GetCommonKeywords(c *gin.Context) {
 		Pluck("DISTINCT keyword", &theirKeywords)
 
 	// 找出共同关键词
+	// 按规范形式比较，避免大小写、全半角等写法不同的同一关键词被漏掉
 	keywordMap := make(map[string]bool)
 	for _, keyword := range myKeywords {
-		keywordMap[keyword] = true
+		keywordMap[tagnorm.Canonical(keyword)] = true
 	}
 
 	var commonKeywords []string
 	for _, keyword := range theirKeywords {
-		if keywordMap[keyword] {
+		canonical := tagnorm.Canonical(keyword)
+		if keywordMap[canonical] {
 			commonKeywords = append(commonKeywords, keyword)
+			delete(keywordMap, canonical)
 		}
 	}
 
@@ -669,49 +729,6 @@ func GetCommonKeywords(c *gin.Context) {
 	})
 }
 
-// 更新热门标签统计
-func updateHotTag(keyword string) {
-	var tag models.HotTag
-	now := time.Now()
-
-	if err := config.DB.Where("keyword = ?", keyword).First(&tag).Error; err != nil {
-		// 不存在则创建，默认状态为hide（仅审核后首页展示）
-		tag = models.HotTag{
-			Keyword:      keyword,
-			Count24h:     0,
-			CountTotal:   0,
-			Status:       "hide",
-			SubmitCount:  0,
-			LastSearchAt: &now,
-		}
-		config.DB.Create(&tag)
-	} else {
-		if tag.Status != "show" {
-			return
-		}
-
-		// 检查是否超过24小时
-		isWithin24h := tag.LastSearchAt != nil && now.Sub(*tag.LastSearchAt) <= 24*time.Hour
-
-		updateData := map[string]interface{}{
-			"count_total":    tag.CountTotal + 1,
-			"submit_count":   tag.SubmitCount + 1,
-			"last_search_at": now,
-		}
-
-		// 如果在24小时内，增加count_24h
-		if isWithin24h {
-			updateData["count_24h"] = tag.Count24h + 1
-		} else {
-			// 超过24小时，重置count_24h为1
-			updateData["count_24h"] = 1
-		}
-
-		// 更新计数，包括SubmitCount和count_24h
-		config.DB.Model(&tag).Updates(updateData)
-	}
-}
-
 // SendEmailToMatch 发送邮件给匹配用户，扣除1积分
 func SendEmailToMatch(c *gin.Context) {
 	userID := c.GetUint("user_id")
@@ -745,6 +762,10 @@ func SendEmailToMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "match not found"})
 		return
 	}
+	if services.IsBlocked(userID, uint(collisionResult.MatchedUserID)) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "user is blocked"})
+		return
+	}
 
 	var user models.User
 	if err := config.DB.First(&user, userID).Error; err != nil {
@@ -766,20 +787,37 @@ func SendEmailToMatch(c *gin.Context) {
 		return
 	}
 
+	// 先扣除积分再发送，发送失败时退回
+	entry := services.LedgerEntry{
+		Type:    "send_email",
+		Reason:  "Email to matched user: " + collisionResult.Keyword,
+		RefType: services.RefCollisionResult,
+		RefID:   collisionResult.ID,
+	}
+	balance, err := services.Debit(config.DB, userID, 1, entry)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientCoins) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "insufficient coins"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "failed to update coins"})
+		return
+	}
+
 	subject := "小程序匹配成功，用户给你发信息啦"
 	htmlBody := fmt.Sprintf("<p>小程序匹配成功，用户给你发信息啦</p>\n<p>%s</p>", html.EscapeString(req.Content))
 
 	emailService := services.NewSMTPEmailService(config.DB)
 	if err := emailService.SendEmail(uint64(userID), matchedContact.Email, subject, htmlBody, "collision"); err != nil {
+		entry.Type = "refund"
+		entry.Reason = "Email failed: " + collisionResult.Keyword
+		if _, refundErr := services.Credit(config.DB, userID, 1, entry); refundErr != nil {
+			log.Printf("退回发送邮件积分失败: user_id=%d err=%v", userID, refundErr)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "send email failed: " + err.Error()})
 		return
 	}
 
-	if err := config.DB.Model(&user).Update("coins", user.Coins-1).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "failed to update coins"})
-		return
-	}
-
 	now := time.Now()
 	_ = config.DB.Model(&collisionResult).Updates(map[string]interface{}{
 		"email_sent":    true,
@@ -790,7 +828,7 @@ func SendEmailToMatch(c *gin.Context) {
 		"code":    200,
 		"message": "ok",
 		"data": gin.H{
-			"remaining_coins": user.Coins - 1,
+			"remaining_coins": balance,
 		},
 	})
 }
@@ -810,7 +848,7 @@ func ClickHotTag(c *gin.Context) {
 	}
 
 	// 更新标签点击次数
-	updateHotTag(req.Keyword)
+	services.RecordHotTag(req.Keyword, true)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
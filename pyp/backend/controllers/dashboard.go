@@ -3,7 +3,11 @@ package controllers
 import (
 	"collision-backend/config"
 	"collision-backend/models"
+	"collision-backend/services"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -250,6 +254,394 @@ func (ctrl *DashboardController) UpdateAuditSetting(c *gin.Context) {
 	})
 }
 
+// 获取匹配规则设置
+func (ctrl *DashboardController) GetMatchRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"rules":          services.EnabledMatchRules(),
+			"availableRules": services.AvailableMatchRules(),
+		},
+	})
+}
+
+// 更新匹配规则设置（按顺序执行，留空则恢复默认规则）
+func (ctrl *DashboardController) UpdateMatchRules(c *gin.Context) {
+	var req struct {
+		Rules []string `json:"rules"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	available := map[string]bool{}
+	for _, name := range services.AvailableMatchRules() {
+		available[name] = true
+	}
+	for _, name := range req.Rules {
+		if !available[name] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "Unknown match rule: " + name,
+			})
+			return
+		}
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", services.MatchRulesConfigKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: services.MatchRulesConfigKey,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"rules": strings.Join(req.Rules, ","),
+	})
+
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to save match rules",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Match rules updated successfully",
+		"data": gin.H{
+			"rules": services.EnabledMatchRules(),
+		},
+	})
+}
+
+// 获取匹配上限设置
+func (ctrl *DashboardController) GetMatchCaps(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": matchCapsData(services.LoadMatchCapSetting()),
+	})
+}
+
+// 更新匹配上限设置：单个碰撞码/标签每轮最多新增的匹配数（0 表示不限制）和候选采样策略
+func (ctrl *DashboardController) UpdateMatchCaps(c *gin.Context) {
+	var req struct {
+		PerCode  int    `json:"per_code"`
+		PerTag   int    `json:"per_tag"`
+		Strategy string `json:"strategy"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.PerCode < 0 || req.PerTag < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = services.MatchStrategyRecent
+	}
+	valid := false
+	for _, strategy := range services.MatchStrategies {
+		if strategy == req.Strategy {
+			valid = true
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Unknown match strategy: " + req.Strategy,
+		})
+		return
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", services.MatchCapsConfigKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: services.MatchCapsConfigKey,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"per_code": strconv.Itoa(req.PerCode),
+		"per_tag":  strconv.Itoa(req.PerTag),
+		"strategy": req.Strategy,
+	})
+
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to save match caps",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Match caps updated successfully",
+		"data": matchCapsData(services.LoadMatchCapSetting()),
+	})
+}
+
+func matchCapsData(setting services.MatchCapSetting) gin.H {
+	return gin.H{
+		"perCode":             setting.PerCode,
+		"perTag":              setting.PerTag,
+		"strategy":            setting.Strategy,
+		"availableStrategies": services.MatchStrategies,
+		"backlogSize":         services.BacklogSize(),
+	}
+}
+
+// 获取匹配模式：所有已注册的匹配策略及当前启用的模式
+func (ctrl *DashboardController) GetMatchModes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": matchModesData(),
+	})
+}
+
+// 更新启用的匹配模式（留空则启用全部模式，默认模式始终启用），只影响新提交的碰撞码和碰撞列表
+func (ctrl *DashboardController) UpdateMatchModes(c *gin.Context) {
+	var req struct {
+		Modes []string `json:"modes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	modes := make([]string, 0, len(req.Modes))
+	for _, mode := range req.Modes {
+		if !services.IsKnownMatchMode(mode) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "Unknown match mode: " + mode,
+			})
+			return
+		}
+		modes = append(modes, services.NormalizeMatchMode(mode))
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", services.MatchModesConfigKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: services.MatchModesConfigKey,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"modes": strings.Join(modes, ","),
+	})
+
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to save match modes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Match modes updated successfully",
+		"data": matchModesData(),
+	})
+}
+
+func matchModesData() gin.H {
+	available := []gin.H{}
+	for _, strategy := range services.AvailableMatchModes() {
+		available = append(available, gin.H{
+			"name":        strategy.Name(),
+			"description": strategy.Description(),
+		})
+	}
+	return gin.H{
+		"modes":          services.EnabledMatchModes(),
+		"availableModes": available,
+		"defaultMode":    services.DefaultMatchMode,
+	}
+}
+
+// 获取匹配任务记录：按来源筛选，period 为 1 时按小时汇总，7/30 时按天汇总，同时返回最近的执行记录
+func (ctrl *DashboardController) GetMatcherRuns(c *gin.Context) {
+	source := c.Query("source")
+	if source != "" {
+		valid := false
+		for _, s := range services.MatcherRunSources {
+			if s == source {
+				valid = true
+			}
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "Unknown source: " + source,
+			})
+			return
+		}
+	}
+
+	days := 7
+	switch c.DefaultQuery("period", "7") {
+	case "1":
+		days = 1
+	case "30":
+		days = 30
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	series, err := services.MatcherRunSeries(since, days == 1, source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to load matcher runs",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var runs []models.MatcherRun
+	query := config.DB.Where("started_at >= ?", since)
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	query.Order("started_at DESC").Limit(limit).Find(&runs)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"series":  series,
+			"runs":    runs,
+			"running": services.MatcherRunning(),
+			"sources": services.MatcherRunSources,
+		},
+	})
+}
+
+// 手动触发一次全量匹配（在后台执行），当前实例已有整轮匹配在执行时返回 409
+func (ctrl *DashboardController) TriggerMatcherRun(c *gin.Context) {
+	if err := services.TriggerRun(services.MatcherRunSourceManual); err != nil {
+		if errors.Is(err, services.ErrShuttingDown) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"code": 503,
+				"msg":  "Server is shutting down",
+			})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"code": 409,
+			"msg":  "Matcher is already running",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Matcher run started",
+	})
+}
+
+// 模拟匹配：给定碰撞码，或以某个用户身份提交的标签，返回谁会匹配、未匹配的原因和预估得分，不写入任何数据
+func (ctrl *DashboardController) SimulateMatch(c *gin.Context) {
+	var req struct {
+		CodeID     uint     `json:"code_id"`
+		UserID     uint     `json:"user_id"`
+		Tag        string   `json:"tag"`
+		Tags       []string `json:"tags"`
+		MinOverlap int      `json:"min_overlap"`
+		Latitude   *float64 `json:"latitude"`
+		Longitude  *float64 `json:"longitude"`
+		RadiusKm   float64  `json:"radius_km"`
+		Labels     []string `json:"target_labels"`
+		MatchMode  string   `json:"match_mode"`
+		Rules      []string `json:"rules"` // 为空时使用当前启用的规则
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	available := map[string]bool{}
+	for _, name := range services.AvailableMatchRules() {
+		available[name] = true
+	}
+	for _, name := range req.Rules {
+		if !available[name] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "Unknown match rule: " + name,
+			})
+			return
+		}
+	}
+
+	if _, ok := targetLabels(req.Labels); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid target labels",
+		})
+		return
+	}
+	if !services.IsKnownMatchMode(req.MatchMode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Unknown match mode: " + req.MatchMode,
+		})
+		return
+	}
+
+	tags := req.Tags
+	if req.Tag != "" {
+		tags = append([]string{req.Tag}, tags...)
+	}
+	simulation, err := services.NewCollisionMatcher().SimulateMatches(services.SimulateRequest{
+		CodeID:     req.CodeID,
+		UserID:     req.UserID,
+		Tags:       tags,
+		MinOverlap: req.MinOverlap,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		RadiusKm:   req.RadiusKm,
+		Labels:     req.Labels,
+		MatchMode:  req.MatchMode,
+		Rules:      req.Rules,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": simulation,
+	})
+}
+
 // 获取审核统计数据
 func (ctrl *DashboardController) GetAuditStats(c *gin.Context) {
 	type AuditStats struct {
@@ -276,3 +668,17 @@ func (ctrl *DashboardController) GetAuditStats(c *gin.Context) {
 		"data": stats,
 	})
 }
+
+// 获取后台任务选主状态（每个任务当前由哪个实例执行）
+func (ctrl *DashboardController) GetLeaderStatus(c *gin.Context) {
+	leader := services.Leader()
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"instanceId": leader.InstanceID(),
+			"backend":    leader.Backend(),
+			"jobs":       leader.Status(),
+		},
+	})
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetExpiryReminderSetting 获取到期提醒和自动续期设置
+func (ctrl *DashboardController) GetExpiryReminderSetting(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": expiryReminderData(services.LoadExpiryReminderSetting()),
+	})
+}
+
+// UpdateExpiryReminderSetting 更新到期提醒设置：碰撞码/碰撞列表到期前多少小时提醒（0 表示不提醒）和碰撞列表每次自动续期的天数
+func (ctrl *DashboardController) UpdateExpiryReminderSetting(c *gin.Context) {
+	var req struct {
+		CodeLeadHours int `json:"code_lead_hours"`
+		ListLeadHours int `json:"list_lead_hours"`
+		ListRenewDays int `json:"list_renew_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.CodeLeadHours < 0 || req.ListLeadHours < 0 || req.ListRenewDays < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", services.ExpiryReminderConfigKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: services.ExpiryReminderConfigKey,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"code_lead_hours": strconv.Itoa(req.CodeLeadHours),
+		"list_lead_hours": strconv.Itoa(req.ListLeadHours),
+		"list_renew_days": strconv.Itoa(req.ListRenewDays),
+	})
+
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to save expiry reminder setting",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Expiry reminder setting updated",
+		"data": expiryReminderData(services.LoadExpiryReminderSetting()),
+	})
+}
+
+func expiryReminderData(setting services.ExpiryReminderSetting) gin.H {
+	return gin.H{
+		"codeLeadHours": setting.CodeLeadHours,
+		"listLeadHours": setting.ListLeadHours,
+		"listRenewDays": setting.ListRenewDays,
+		"codeRenewCost": services.CodeRenewCost,
+	}
+}
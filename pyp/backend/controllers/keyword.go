@@ -3,6 +3,7 @@ package controllers
 import (
 	"collision-backend/config"
 	"collision-backend/models"
+	"collision-backend/tagnorm"
 	"net/http"
 	"strconv"
 
@@ -20,6 +21,10 @@ type KeywordStatusRequest struct {
 	Status string `json:"status" binding:"required,oneof=show hide blackhole"`
 }
 
+type KeywordMatchWindowRequest struct {
+	Historical *bool `json:"historical" binding:"required"`
+}
+
 // 获取热门关键词列表
 func (ctrl *KeywordController) GetKeywords(c *gin.Context) {
 	var keywords []models.HotTag
@@ -51,9 +56,9 @@ func (ctrl *KeywordController) CreateKeyword(c *gin.Context) {
 		return
 	}
 
-	// 检查关键词是否已存在
+	// 检查关键词是否已存在（按规范形式判断）
 	var existingKeyword models.HotTag
-	if err := config.DB.Where("keyword = ?", req.Keyword).First(&existingKeyword).Error; err == nil {
+	if err := config.DB.Where("keyword_canonical = ?", tagnorm.Canonical(req.Keyword)).First(&existingKeyword).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code": 400,
 			"msg":  "关键词已存在",
@@ -127,6 +132,51 @@ func (ctrl *KeywordController) UpdateKeywordStatus(c *gin.Context) {
 	})
 }
 
+// 设置关键词的匹配时间窗口：开启历史模式后该标签下的碰撞码不要求有效期重叠
+func (ctrl *KeywordController) UpdateKeywordMatchWindow(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的关键词ID",
+		})
+		return
+	}
+
+	var req KeywordMatchWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	var keyword models.HotTag
+	if err := config.DB.First(&keyword, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "关键词不存在",
+		})
+		return
+	}
+
+	keyword.MatchHistorical = *req.Historical
+	if err := config.DB.Save(&keyword).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新匹配模式失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": keyword,
+	})
+}
+
 // 删除关键词
 func (ctrl *KeywordController) DeleteKeyword(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
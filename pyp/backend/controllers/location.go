@@ -2,16 +2,60 @@ package controllers
 
 import (
 	"collision-backend/config"
+	"collision-backend/geo"
 	"collision-backend/models"
 	"collision-backend/utils"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type LocationController struct{}
 
+// validCoordinates 坐标可以不填，填写时经纬度必须同时提供且在合法范围内
+func validCoordinates(lat, lng *float64) bool {
+	if lat == nil && lng == nil {
+		return true
+	}
+	return lat != nil && lng != nil && geo.Valid(*lat, *lng)
+}
+
+// targetLabels 校验碰撞码按已保存地址匹配的地址标签并拼接保存，包含 all 时只保留 all
+func targetLabels(labels []string) (string, bool) {
+	valid := map[string]bool{models.LocationLabelAll: true}
+	for _, label := range models.LocationLabels {
+		valid[label] = true
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, label := range labels {
+		if !valid[label] {
+			return "", false
+		}
+		if label == models.LocationLabelAll {
+			return models.LocationLabelAll, true
+		}
+		if !seen[label] {
+			seen[label] = true
+			result = append(result, label)
+		}
+	}
+	return strings.Join(result, ","), true
+}
+
+// defaultCoordinates 用户默认地址的坐标，没有时返回 nil
+func defaultCoordinates(userID uint) (*float64, *float64) {
+	var location models.UserLocation
+	if err := config.DB.Where("user_id = ? AND is_default = ? AND latitude IS NOT NULL AND longitude IS NOT NULL", userID, true).
+		First(&location).Error; err != nil {
+		return nil, nil
+	}
+	return location.Latitude, location.Longitude
+}
+
 // 获取用户所有地址
 func (lc *LocationController) GetLocations(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -38,18 +82,24 @@ func (lc *LocationController) CreateLocation(c *gin.Context) {
 	}
 
 	var req struct {
-		Label     string `json:"label" binding:"required,oneof=home school work other"`
-		Country   string `json:"country"`
-		Province  string `json:"province"`
-		City      string `json:"city"`
-		District  string `json:"district"`
-		IsDefault bool   `json:"is_default"`
+		Label     string   `json:"label" binding:"required,oneof=home school work other"`
+		Country   string   `json:"country"`
+		Province  string   `json:"province"`
+		City      string   `json:"city"`
+		District  string   `json:"district"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		IsDefault bool     `json:"is_default"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid request: "+err.Error()))
 		return
 	}
+	if !validCoordinates(req.Latitude, req.Longitude) {
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid coordinates"))
+		return
+	}
 
 	// 如果设置为默认地址,先将其他地址设为非默认
 	if req.IsDefault {
@@ -63,6 +113,8 @@ func (lc *LocationController) CreateLocation(c *gin.Context) {
 		Province:  req.Province,
 		City:      req.City,
 		District:  req.District,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
 		IsDefault: req.IsDefault,
 	}
 
@@ -105,15 +157,17 @@ func (lc *LocationController) UpdateLocation(c *gin.Context) {
 	}
 
 	var req struct {
-		Label     string `json:"label" binding:"omitempty,oneof=home school work other"`
-		Country   string `json:"country"`
-		Province  string `json:"province"`
-		City      string `json:"city"`
-		District  string `json:"district"`
-		IsDefault bool   `json:"is_default"`
+		Label     string   `json:"label" binding:"omitempty,oneof=home school work other"`
+		Country   string   `json:"country"`
+		Province  string   `json:"province"`
+		City      string   `json:"city"`
+		District  string   `json:"district"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		IsDefault bool     `json:"is_default"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || !validCoordinates(req.Latitude, req.Longitude) {
 		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid request"))
 		return
 	}
@@ -139,6 +193,12 @@ func (lc *LocationController) UpdateLocation(c *gin.Context) {
 	if req.District != "" {
 		updates["district"] = req.District
 	}
+	if req.Latitude != nil {
+		// map 更新不会带上 BeforeSave 生成的字段，geohash 需要一起更新
+		updates["latitude"] = *req.Latitude
+		updates["longitude"] = *req.Longitude
+		updates["geohash"] = geo.Encode(*req.Latitude, *req.Longitude, geo.HashPrecision)
+	}
 	updates["is_default"] = req.IsDefault
 
 	if err := config.DB.Model(&location).Updates(updates).Error; err != nil {
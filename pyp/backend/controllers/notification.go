@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct{}
+
+// GetNotifications 获取站内通知（分页），unread=1 时只返回未读通知
+func (nc *NotificationController) GetNotifications(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	query := config.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "1" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to get notifications"))
+		return
+	}
+
+	var unread int64
+	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+
+	c.JSON(http.StatusOK, utils.Success(gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"unread":        unread,
+		"page":          page,
+		"page_size":     pageSize,
+	}))
+}
+
+// MarkNotificationRead 将一条通知标记为已读
+func (nc *NotificationController) MarkNotificationRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	var notification models.Notification
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, utils.Error(404, "Notification not found"))
+		return
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&notification).UpdateColumn("read_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update notification"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "read"}))
+}
+
+// MarkAllNotificationsRead 将全部未读通知标记为已读
+func (nc *NotificationController) MarkAllNotificationsRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, utils.Error(401, "User not authenticated"))
+		return
+	}
+
+	result := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update notifications"))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Success(gin.H{"updated": result.RowsAffected}))
+}
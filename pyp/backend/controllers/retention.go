@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"collision-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRetentionPolicies 数据保留策略：各表的保留天数和归档方式
+func (ctrl *DashboardController) GetRetentionPolicies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": retentionData(),
+	})
+}
+
+// UpdateRetentionPolicy 修改一张表的保留策略，保留天数为 0 表示不归档
+func (ctrl *DashboardController) UpdateRetentionPolicy(c *gin.Context) {
+	var req struct {
+		Table string `json:"table" binding:"required"`
+		Days  int    `json:"days"`
+		Mode  string `json:"mode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = services.ArchiveModeTable
+	}
+
+	if err := services.SaveRetentionPolicy(req.Table, req.Days, req.Mode); err != nil {
+		if errors.Is(err, services.ErrUnknownRetentionTable) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "Unknown table: " + req.Table,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid retention policy: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Retention policy updated",
+		"data": retentionData(),
+	})
+}
+
+func retentionData() gin.H {
+	policies := services.LoadRetentionPolicies()
+	items := make([]gin.H, len(policies))
+	for i, policy := range policies {
+		items[i] = gin.H{
+			"table":   policy.Table,
+			"days":    policy.Days,
+			"mode":    policy.Mode,
+			"minDays": policy.MinDays,
+			"job":     services.JobRetention + policy.Table,
+		}
+	}
+	return gin.H{
+		"policies":       items,
+		"availableModes": services.ArchiveModes,
+	}
+}
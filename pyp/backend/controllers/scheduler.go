@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"collision-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobs 后台任务列表：执行计划、暂停状态、最近一次执行结果和下一次执行时间
+func (ctrl *DashboardController) GetJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"instanceId": services.Leader().InstanceID(),
+			"jobs":       services.JobScheduler().Jobs(),
+		},
+	})
+}
+
+// UpdateJob 修改后台任务的 cron 表达式，为空时恢复默认计划
+func (ctrl *DashboardController) UpdateJob(c *gin.Context) {
+	var req struct {
+		Cron string `json:"cron"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid request data",
+		})
+		return
+	}
+
+	if err := services.JobScheduler().SetCron(c.Param("name"), req.Cron); err != nil {
+		if errors.Is(err, services.ErrUnknownJob) {
+			jobNotFound(c)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid cron expression: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Job schedule updated",
+	})
+}
+
+// PauseJob 暂停后台任务的计划执行
+func (ctrl *DashboardController) PauseJob(c *gin.Context) {
+	if err := services.JobScheduler().Pause(c.Param("name")); err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Job paused",
+	})
+}
+
+// ResumeJob 恢复后台任务的计划执行
+func (ctrl *DashboardController) ResumeJob(c *gin.Context) {
+	if err := services.JobScheduler().Resume(c.Param("name")); err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Job resumed",
+	})
+}
+
+// TriggerJob 在当前实例立即执行一次后台任务（当前实例需持有该任务的租约）
+func (ctrl *DashboardController) TriggerJob(c *gin.Context) {
+	if err := services.JobScheduler().Trigger(c.Param("name")); err != nil {
+		var notLeader *services.NotLeaderError
+		if errors.As(err, &notLeader) {
+			c.JSON(http.StatusConflict, gin.H{
+				"code": 409,
+				"msg":  "This instance is not the leader for the job, current holder: " + notLeader.Holder,
+				"data": gin.H{
+					"holder": notLeader.Holder,
+				},
+			})
+			return
+		}
+		if errors.Is(err, services.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{
+				"code": 409,
+				"msg":  "Job is already running",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrShuttingDown) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"code": 503,
+				"msg":  "Server is shutting down",
+			})
+			return
+		}
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "Job started",
+	})
+}
+
+// jobError 后台任务操作失败
+func jobError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUnknownJob) {
+		jobNotFound(c)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code": 500,
+		"msg":  "Failed to update job",
+	})
+}
+
+// jobNotFound 任务不存在
+func jobNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"code": 404,
+		"msg":  "Unknown job: " + c.Param("name"),
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"collision-backend/config"
+	"collision-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -50,7 +51,8 @@ func (sc *SparkController) GetCollisionSparks(c *gin.Context) {
 	// 构建查询，添加软删除检查和审核状态检查
 	query := config.DB.Table("collision_codes").
 		Joins("LEFT JOIN users ON collision_codes.user_id = users.id").
-		Where("collision_codes.created_at >= ? AND collision_codes.status = 'active' AND collision_codes.audit_status = 'approved' AND collision_codes.deleted_at IS NULL", startDate)
+		Where("collision_codes.created_at >= ? AND collision_codes.status = 'active' AND collision_codes.audit_status = 'approved' AND collision_codes.deleted_at IS NULL", startDate).
+		Scopes(services.ExcludeBlocked(userID, "collision_codes.user_id")) // 不展示与自己存在拉黑关系的用户
 
 	// 关键词筛选
 	if keyword != "" {
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/services"
+	"collision-backend/tagnorm"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagSynonymRequest struct {
+	Keyword string `json:"keyword" binding:"required"`
+	Synonym string `json:"synonym" binding:"required"`
+}
+
+// GetSynonyms 获取标签同义词列表，可按关键词筛选
+func (ctrl *KeywordController) GetSynonyms(c *gin.Context) {
+	query := config.DB.Model(&models.TagSynonym{})
+	if keyword := c.Query("keyword"); keyword != "" {
+		canonical := tagnorm.Canonical(keyword)
+		query = query.Where("keyword_canonical = ? OR synonym_canonical = ?", canonical, canonical)
+	}
+
+	var synonyms []models.TagSynonym
+	if err := query.Order("keyword_canonical ASC, created_at DESC").Find(&synonyms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取同义词列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": synonyms,
+	})
+}
+
+// CreateSynonym 添加标签同义词（同一关键词下的所有同义词互相匹配）
+func (ctrl *KeywordController) CreateSynonym(c *gin.Context) {
+	var req TagSynonymRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	keywordCanonical, synonymCanonical := tagnorm.Canonical(req.Keyword), tagnorm.Canonical(req.Synonym)
+	if keywordCanonical == "" || synonymCanonical == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请输入关键词和同义词",
+		})
+		return
+	}
+	if keywordCanonical == synonymCanonical {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "同义词与关键词相同",
+		})
+		return
+	}
+
+	var existing models.TagSynonym
+	if err := config.DB.Where("keyword_canonical = ? AND synonym_canonical = ?", keywordCanonical, synonymCanonical).
+		First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "同义词已存在",
+		})
+		return
+	}
+
+	synonym := models.TagSynonym{
+		Keyword: req.Keyword,
+		Synonym: req.Synonym,
+	}
+	if err := config.DB.Create(&synonym).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "添加同义词失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "添加成功",
+		"data": synonym,
+	})
+}
+
+// DeleteSynonym 删除标签同义词（已产生的匹配不受影响）
+func (ctrl *KeywordController) DeleteSynonym(c *gin.Context) {
+	id := c.Param("id")
+
+	var synonym models.TagSynonym
+	if err := config.DB.First(&synonym, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "同义词不存在",
+		})
+		return
+	}
+
+	if err := config.DB.Delete(&synonym).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// GetFuzzySetting 获取模糊匹配设置
+func (ctrl *KeywordController) GetFuzzySetting(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": services.LoadFuzzySetting(),
+	})
+}
+
+// UpdateFuzzySetting 更新模糊匹配设置（编辑距离）
+func (ctrl *KeywordController) UpdateFuzzySetting(c *gin.Context) {
+	var req services.FuzzySetting
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+	if req.MaxDistance <= 0 || req.MinSimilarity <= 0 || req.MinSimilarity > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "max_distance 必须大于0，min_similarity 取值范围为 (0, 1]",
+		})
+		return
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", services.TagFuzzyConfigKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: services.TagFuzzyConfigKey,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"enabled":        fmt.Sprintf("%t", req.Enabled),
+		"max_distance":   fmt.Sprintf("%d", req.MaxDistance),
+		"min_similarity": fmt.Sprintf("%g", req.MinSimilarity),
+	})
+
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "保存模糊匹配设置失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": services.LoadFuzzySetting(),
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"collision-backend/config"
 	"collision-backend/models"
+	"collision-backend/services"
 	"collision-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -85,7 +86,6 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 		Nickname:      createData.Nickname,
 		WechatNo:      createData.WechatNo,
 		Phone:         createData.Phone,
-		Coins:         createData.Coins,
 		AllowForceAdd: createData.AllowForceAdd,
 	}
 
@@ -95,6 +95,21 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 		return
 	}
 
+	// 初始金币通过钱包写入，留下流水
+	if createData.Coins != 0 {
+		if err := services.SetBalance(tx, user.ID, createData.Coins, services.LedgerEntry{
+			Type:    services.LedgerTypeAdminAdjust,
+			Reason:  "Initial coins",
+			RefType: services.RefAdmin,
+			RefID:   uint64(c.GetUint("user_id")),
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, utils.ErrorWithMsg(utils.ValidationErrorCode, "初始金币无效: "+err.Error()))
+			return
+		}
+		user.Coins = createData.Coins
+	}
+
 	// 创建或更新用户联系方式
 	contact := models.UserContact{
 		UserID:        uint64(user.ID),
@@ -191,9 +206,6 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	if updateData.Nickname != "" {
 		updates["nickname"] = updateData.Nickname
 	}
-	if updateData.Coins != nil {
-		updates["coins"] = *updateData.Coins
-	}
 	if updateData.Age != nil {
 		updates["age"] = *updateData.Age
 	}
@@ -210,6 +222,24 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// 修改余额通过钱包完成，按差额写入流水
+	if updateData.Coins != nil {
+		if err := services.SetBalance(tx, user.ID, *updateData.Coins, services.LedgerEntry{
+			Type:    services.LedgerTypeAdminAdjust,
+			Reason:  "Admin adjustment",
+			RefType: services.RefAdmin,
+			RefID:   uint64(c.GetUint("user_id")),
+		}); err != nil {
+			tx.Rollback()
+			if errors.Is(err, services.ErrInvalidAmount) {
+				c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid coins"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update coins"))
+			return
+		}
+	}
+
 	// 更新用户联系方式
 	var contact models.UserContact
 	result := tx.Where("user_id = ?", user.ID).First(&contact)
@@ -268,6 +298,9 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.Success(gin.H{"message": "User deleted successfully"}))
 }
 
+// signupBonusCoins 新用户赠送积分
+const signupBonusCoins = 1000
+
 // 微信小程序登录
 func (uc *UserController) WechatLogin(c *gin.Context) {
 	var req struct {
@@ -331,7 +364,6 @@ func (uc *UserController) WechatLogin(c *gin.Context) {
 			Nickname: nickname,
 			Avatar:   avatar,
 			WechatNo: "wx" + utils.GenerateRandomString(8),
-			Coins:    1000, // 新用户赠送1000积分
 		}
 
 		// 如果提供了用户信息，保存地理位置
@@ -347,10 +379,27 @@ func (uc *UserController) WechatLogin(c *gin.Context) {
 			}
 		}
 
-		if err := config.DB.Create(&user).Error; err != nil {
+		// 新用户赠送积分通过钱包写入，与创建用户在同一事务中
+		tx := config.DB.Begin()
+		if err := tx.Create(&user).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create user"))
+			return
+		}
+		balance, err := services.Credit(tx, user.ID, signupBonusCoins, services.LedgerEntry{
+			Type:   "signup_bonus",
+			Reason: "新用户赠送",
+		})
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create user"))
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
 			c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create user"))
 			return
 		}
+		user.Coins = balance
 
 		fmt.Printf("创建新用户成功: ID=%d, OpenID=%s, Nickname=%s\n", user.ID, user.OpenID, user.Nickname)
 	} else {
@@ -643,12 +692,7 @@ func (uc *UserController) CreateRechargeOrder(c *gin.Context) {
 		return
 	}
 
-	user.Coins += coins
-	user.TotalRecharge += coins
-	if err := tx.Model(&user).Updates(map[string]interface{}{
-		"coins":          user.Coins,
-		"total_recharge": user.TotalRecharge,
-	}).Error; err != nil {
+	if err := tx.Model(&user).UpdateColumn("total_recharge", gorm.Expr("total_recharge + ?", coins)).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update balance"))
 		return
@@ -668,15 +712,14 @@ func (uc *UserController) CreateRechargeOrder(c *gin.Context) {
 		return
 	}
 
-	consumeRecord := models.ConsumeRecord{
-		UserID: userID.(uint),
-		Coins:  coins,
-		Type:   "recharge",
-		Reason: "充值",
-	}
-	if err := tx.Create(&consumeRecord).Error; err != nil {
+	if _, err := services.Credit(tx, userID.(uint), coins, services.LedgerEntry{
+		Type:    "recharge",
+		Reason:  "充值",
+		RefType: services.RefRechargeRecord,
+		RefID:   uint64(record.ID),
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to create consume record"))
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to update balance"))
 		return
 	}
 
@@ -695,16 +738,19 @@ func (uc *UserController) CreateRechargeOrder(c *gin.Context) {
 // getTypeDisplay 获取消费类型的显示文本
 func getTypeDisplay(consumeType string) string {
 	typeMap := map[string]string{
-		"collision":        "碰撞提交",
-		"collision_submit": "碰撞提交", 
-		"renew_collision":  "续期碰撞",
-		"force_add":        "强制添加",
-		"match_reward":     "匹配奖励",
-		"recharge":         "充值",
-		"refund":           "退款",
-		"system":           "系统调整",
-		"haidilao":         "海底捞",
-		"send_email":       "发送邮件",
+		"collision":            "碰撞提交",
+		"collision_submit":     "碰撞提交",
+		"renew_collision":      "续期碰撞",
+		"renew_collision_list": "续期碰撞列表",
+		"collision_list":       "碰撞列表",
+		"force_add":            "强制添加",
+		"match_reward":         "匹配奖励",
+		"recharge":             "充值",
+		"refund":               "退款",
+		"system":               "系统调整",
+		"haidilao":             "海底捞",
+		"send_email":           "发送邮件",
+		"signup_bonus":         "新用户赠送",
 	}
 	
 	if display, exists := typeMap[consumeType]; exists {
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/services"
+	"collision-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondDebitError 扣除金币失败
+func respondDebitError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInsufficientCoins):
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Insufficient coins"))
+	case errors.Is(err, services.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid cost"))
+	default:
+		c.JSON(http.StatusInternalServerError, utils.Error(500, "Failed to deduct coins"))
+	}
+}
+
+// GetWalletDiscrepancies 对账发现的余额与流水合计不一致的用户
+func (ctrl *DashboardController) GetWalletDiscrepancies(c *gin.Context) {
+	var discrepancies []models.WalletDiscrepancy
+	if err := config.DB.Order("detected_at ASC").Find(&discrepancies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to load wallet discrepancies",
+		})
+		return
+	}
+
+	items := make([]gin.H, 0, len(discrepancies))
+	for _, d := range discrepancies {
+		var user models.User
+		config.DB.Select("id", "nickname").First(&user, d.UserID)
+		items = append(items, gin.H{
+			"userId":     d.UserID,
+			"nickname":   user.Nickname,
+			"coins":      d.Coins,
+			"ledgerSum":  d.LedgerSum,
+			"difference": d.Coins - d.LedgerSum,
+			"detectedAt": d.DetectedAt,
+			"checkedAt":  d.CheckedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"items": items,
+			"total": len(items),
+		},
+	})
+}
+
+// GetWalletLedger 用户的金币流水（分页，按时间倒序）
+func (ctrl *DashboardController) GetWalletLedger(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "Invalid user id",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := config.DB.Model(&models.WalletLedger{}).Where("user_id = ?", userID)
+	var total int64
+	query.Count(&total)
+
+	var entries []models.WalletLedger
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to load wallet ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": gin.H{
+			"items":    entries,
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// respondV3DebitError 扣除积分失败（V3 接口的响应格式）
+func respondV3DebitError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInsufficientCoins):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "积分不足"})
+	case errors.Is(err, services.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "积分扣除失败"})
+	}
+}
@@ -0,0 +1,204 @@
+// Package cronexpr 解析 cron 表达式并计算下一次执行时间（后台任务调度使用，不依赖第三方库）
+//
+// 支持标准的 5 段表达式：分 时 日 月 周（周日为 0 或 7），每段可以是 *、数字、范围 a-b、步长 */n 或 a-b/n，
+// 以及逗号分隔的列表；日和周都有限制（不以 * 开头）时满足其中之一即可（与 crontab 相同）。
+// 永远不会执行的表达式（如 2 月 31 日）解析时报错。
+// 另外支持 @hourly、@daily（@midnight）、@weekly、@monthly，以及按固定间隔执行的 @every <间隔>（如 @every 90s）。
+package cronexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 执行计划
+type Schedule interface {
+	// Next 严格晚于 t 的下一次执行时间
+	Next(t time.Time) time.Time
+}
+
+// descriptors 预定义的表达式
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse 解析 cron 表达式
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || interval < time.Second {
+			return nil, fmt.Errorf("cron 表达式 %q: 间隔无效（至少 1s）", spec)
+		}
+		return everySchedule{interval: interval}, nil
+	}
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式 %q: 需要 5 段（分 时 日 月 周）", spec)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q: 分钟 %v", spec, err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q: 小时 %v", spec, err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q: 日 %v", spec, err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q: 月 %v", spec, err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q: 周 %v", spec, err)
+	}
+	// 周日可以写成 0 或 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// 与 crontab 相同，以 * 开头（包括 */n）的日、周不参与"满足其一"的判断
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	if !s.dayPossible() {
+		return nil, fmt.Errorf("cron 表达式 %q: 所选月份中没有这些日期，永远不会执行", spec)
+	}
+	return s, nil
+}
+
+// monthDays 每个月最多的天数（2 月按闰年）
+var monthDays = [13]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// dayPossible 是否存在可以执行的日期：只限制日时，所选月份中至少有一个所选的日期
+func (s cronSchedule) dayPossible() bool {
+	if s.domAny || !s.dowAny {
+		return true
+	}
+	for month := 1; month <= 12; month++ {
+		if s.month&(1<<uint(month)) == 0 {
+			continue
+		}
+		for day := 1; day <= monthDays[month]; day++ {
+			if s.dom&(1<<uint(day)) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseField 解析一段表达式，返回允许值的位集合
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("步长无效: %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("范围无效: %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("取值无效: %q", part)
+			}
+			start, end = n, n
+			if step > 1 {
+				end = max // a/n 表示从 a 开始每 n 个
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("超出范围 %d-%d: %q", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronSchedule 5 段表达式的执行计划
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// Next 从下一分钟开始逐级查找（月 -> 日 -> 时 -> 分），最多向后查找 5 年
+func (s cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = later(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// later 返回 next；夏令时开始时不存在的本地时间可能被换算到 t 或 t 之前，此时按小时向后推，保证查找向前推进
+func later(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// dayMatches 日和周都限制时满足其一即可，否则两者都要满足
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// everySchedule 按固定间隔执行
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(s.interval)
+}
@@ -0,0 +1,163 @@
+package cronexpr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"@every",
+		"@every 500ms",
+		"@every abc",
+		"@yearly",
+		"0 0 31 2 *",
+		"0 0 30,31 2 *",
+		"0 0 31 4,6,9,11 *",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) 应当报错", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	from := time.Date(2024, 1, 15, 10, 7, 30, 0, time.UTC) // 星期一
+	tests := []struct {
+		spec string
+		want []time.Time
+	}{
+		{"*/15 * * * *", []time.Time{
+			time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		}},
+		{"10-30/10 * * * *", []time.Time{
+			time.Date(2024, 1, 15, 10, 10, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 10, 20, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 11, 10, 0, 0, time.UTC),
+		}},
+		{"50/5 * * * *", []time.Time{
+			time.Date(2024, 1, 15, 10, 50, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 10, 55, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 11, 50, 0, 0, time.UTC),
+		}},
+		{"0 3,15 * * *", []time.Time{
+			time.Date(2024, 1, 15, 15, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 16, 3, 0, 0, 0, time.UTC),
+		}},
+		// 周日写成 7 与 0 相同
+		{"0 0 * * 7", []time.Time{
+			time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 28, 0, 0, 0, 0, time.UTC),
+		}},
+		{"0 0 * * 0", []time.Time{
+			time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@weekly", []time.Time{
+			time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@daily", []time.Time{
+			time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@hourly", []time.Time{
+			time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		}},
+		// 日和周都有限制时满足其一即可：每月 20 日或每周三
+		{"0 0 20 * 3", []time.Time{
+			time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 24, 0, 0, 0, 0, time.UTC),
+		}},
+		// 日以 * 开头时不参与"满足其一"：单数日且为星期一
+		{"0 0 */2 * 1", []time.Time{
+			time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC),
+		}},
+		// 周以 * 开头时同样只按日：每月 20 日
+		{"0 0 20 * */2", []time.Time{
+			time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+		}},
+		// 月末：31 日跳过没有 31 日的月份
+		{"0 12 31 * *", []time.Time{
+			time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC),
+		}},
+		// 2 月 29 日只在闰年
+		{"0 0 29 2 *", []time.Time{
+			time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		next := from
+		for i, want := range tt.want {
+			next = s.Next(next)
+			if !next.Equal(want) {
+				t.Errorf("%q 第 %d 次 Next = %v, want %v", tt.spec, i+1, next, want)
+				break
+			}
+		}
+	}
+}
+
+func TestNextEvery(t *testing.T) {
+	s, err := Parse("@every 90s")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	from := time.Date(2024, 1, 15, 10, 0, 0, 400, time.UTC)
+	if got, want := s.Next(from), time.Date(2024, 1, 15, 10, 1, 30, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("没有时区数据: %v", err)
+	}
+	// 2024-03-10 02:00 开始夏令时，当天没有 2:30，下一次为次日 2:30
+	s, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	from := time.Date(2024, 3, 9, 3, 0, 0, 0, loc)
+	if got, want := s.Next(from), time.Date(2024, 3, 11, 2, 30, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+
+	// 每小时执行的任务跨过夏令时切换时不会停住
+	hourly, _ := Parse("0 * * * *")
+	t0 := time.Date(2024, 3, 10, 0, 30, 0, 0, loc)
+	for i := 0; i < 5; i++ {
+		t1 := hourly.Next(t0)
+		if !t1.After(t0) || t1.Sub(t0) > time.Hour {
+			t.Fatalf("Next(%v) = %v", t0, t1)
+		}
+		t0 = t1
+	}
+}
@@ -0,0 +1,137 @@
+// Package geo 坐标距离和 geohash 计算（纯本地计算，不依赖外部地图服务）
+//
+// 碰撞码和用户地址可以带经纬度（WGS84），保存时生成 geohash 作为空间索引：
+// 按距离查找时先用 geohash 前缀（中心格子及周围 8 个格子）在数据库中粗筛，再按球面距离精确过滤。
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+// earthRadiusKm 地球平均半径
+const earthRadiusKm = 6371.0
+
+// HashPrecision 保存到数据库的 geohash 长度（约 1.2km x 0.6km）
+const HashPrecision = 6
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// cellSizeKm 各长度 geohash 格子在赤道附近的较短边长（公里），下标为 geohash 长度
+var cellSizeKm = []float64{0, 4992, 624, 156, 19.5, 4.9, 0.61, 0.153, 0.019}
+
+// Valid 经纬度是否在合法范围内
+func Valid(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 &&
+		!math.IsNaN(lat) && !math.IsNaN(lng)
+}
+
+// Distance 两点间的球面距离（公里，haversine 公式）
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Encode 计算 geohash
+func Encode(lat, lng float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+
+	var b strings.Builder
+	b.Grow(precision)
+	bits, ch, even := 0, 0, true
+	for b.Len() < precision {
+		// 偶数位编码经度，奇数位编码纬度
+		value, r := lat, &latRange
+		if even {
+			value, r = lng, &lngRange
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		if bits++; bits == 5 {
+			b.WriteByte(base32[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// decode 返回 geohash 格子的中心点和半边长（度）
+func decode(hash string) (lat, lng, latErr, lngErr float64) {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(base32, hash[i])
+		for mask := 16; mask > 0; mask >>= 1 {
+			r := &latRange
+			if even {
+				r = &lngRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if ch&mask != 0 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lngRange[0] + lngRange[1]) / 2,
+		(latRange[1] - latRange[0]) / 2, (lngRange[1] - lngRange[0]) / 2
+}
+
+// Neighbors 格子本身及周围 8 个格子的 geohash（去重，跨越 180° 经线时绕回，靠近两极时可能少于 9 个）
+func Neighbors(hash string) []string {
+	lat, lng, latErr, lngErr := decode(hash)
+	seen := make(map[string]bool, 9)
+	hashes := make([]string, 0, 9)
+	for _, dLat := range []float64{0, 1, -1} {
+		for _, dLng := range []float64{0, 1, -1} {
+			nLat := lat + dLat*2*latErr
+			if nLat > 90 || nLat < -90 {
+				continue
+			}
+			nLng := lng + dLng*2*lngErr
+			if nLng > 180 {
+				nLng -= 360
+			} else if nLng < -180 {
+				nLng += 360
+			}
+			neighbor := Encode(nLat, nLng, len(hash))
+			if !seen[neighbor] {
+				seen[neighbor] = true
+				hashes = append(hashes, neighbor)
+			}
+		}
+	}
+	return hashes
+}
+
+// precisionFor 格子较短边不小于半径的最长 geohash，此时中心格子及周围 8 个格子能覆盖整个圆
+func precisionFor(radiusKm float64) int {
+	for precision := HashPrecision; precision > 1; precision-- {
+		if cellSizeKm[precision] >= radiusKm {
+			return precision
+		}
+	}
+	return 1
+}
+
+// CoverPrefixes 按距离粗筛用的 geohash 前缀，覆盖以 (lat, lng) 为中心、radiusKm 为半径的圆
+// 高纬度地区格子变窄，覆盖范围会小于半径，结果仍需按 Distance 精确过滤
+func CoverPrefixes(lat, lng, radiusKm float64) []string {
+	return Neighbors(Encode(lat, lng, precisionFor(radiusKm)))
+}
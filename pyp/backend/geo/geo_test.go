@@ -0,0 +1,167 @@
+package geo
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{0, 0, 1, "s"},
+		{-90, -180, 3, "000"},
+		{90, 180, 3, "zzz"},
+	}
+	for _, tt := range tests {
+		if got := Encode(tt.lat, tt.lng, tt.precision); got != tt.want {
+			t.Errorf("Encode(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	lat, lng, latErr, lngErr := decode("ezs42")
+	if math.Abs(lat-42.6) > latErr || math.Abs(lng+5.6) > lngErr {
+		t.Errorf("decode(ezs42) = (%v±%v, %v±%v)，不包含 (42.6, -5.6)", lat, latErr, lng, lngErr)
+	}
+	if got := Encode(lat, lng, 5); got != "ezs42" {
+		t.Errorf("Encode(decode(ezs42)) = %q", got)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	got := Neighbors("ezs42")
+	want := []string{"ezs42", "ezs48", "ezs40", "ezs43", "ezefr", "ezs49", "ezefx", "ezs41", "ezefp"}
+	if got[0] != "ezs42" {
+		t.Errorf("Neighbors(ezs42)[0] = %q, want 格子本身", got[0])
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Neighbors(ezs42) = %v, want %v", got, want)
+	}
+}
+
+func TestNeighborsWrap(t *testing.T) {
+	// 180° 经线东侧的格子绕回到 -180° 一侧
+	hash := Encode(0, 179.99, 4)
+	neighbors := Neighbors(hash)
+	if len(neighbors) != 9 {
+		t.Fatalf("Neighbors(%s) 有 %d 个，want 9", hash, len(neighbors))
+	}
+	wrapped := false
+	for _, n := range neighbors {
+		if _, lng, _, _ := decode(n); lng < 0 {
+			wrapped = true
+		}
+	}
+	if !wrapped {
+		t.Errorf("Neighbors(%s) = %v，没有绕回到西经", hash, neighbors)
+	}
+}
+
+func TestNeighborsPole(t *testing.T) {
+	// 北极附近的格子没有更北的一行
+	hash := Encode(89.9, 0, 2)
+	neighbors := Neighbors(hash)
+	if len(neighbors) != 6 {
+		t.Errorf("Neighbors(%s) = %v，want 6 个", hash, neighbors)
+	}
+	seen := make(map[string]bool)
+	for _, n := range neighbors {
+		if seen[n] {
+			t.Errorf("Neighbors(%s) 中 %s 重复", hash, n)
+		}
+		seen[n] = true
+	}
+}
+
+func TestPrecisionFor(t *testing.T) {
+	tests := []struct {
+		radiusKm float64
+		want     int
+	}{
+		{0.1, 6},
+		{0.61, 6},
+		{1, 5},
+		{4.9, 5},
+		{5, 4},
+		{20, 3},
+		{156, 3},
+		{157, 2},
+		{624, 2},
+		{5000, 1},
+	}
+	for _, tt := range tests {
+		if got := precisionFor(tt.radiusKm); got != tt.want {
+			t.Errorf("precisionFor(%v) = %d, want %d", tt.radiusKm, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// 北京天安门到上海人民广场约 1067 公里
+	if got := Distance(39.9087, 116.3975, 31.2304, 121.4737); math.Abs(got-1067) > 5 {
+		t.Errorf("Distance(北京, 上海) = %v, want ≈1067", got)
+	}
+	// 赤道上经度相差 1° 约 111.19 公里
+	if got := Distance(0, 0, 0, 1); math.Abs(got-111.19) > 0.01 {
+		t.Errorf("Distance(0,0,0,1) = %v, want ≈111.19", got)
+	}
+	if got := Distance(30, 120, 30, 120); got != 0 {
+		t.Errorf("Distance 同一点 = %v, want 0", got)
+	}
+}
+
+func TestCoverPrefixes(t *testing.T) {
+	// 中低纬度地区，半径内各方向上的点都落在粗筛前缀内
+	centers := [][2]float64{{31.2304, 121.4737}, {0.001, 179.999}, {-33.86, 151.21}}
+	for _, radiusKm := range []float64{0.5, 3, 10, 50} {
+		for _, c := range centers {
+			prefixes := CoverPrefixes(c[0], c[1], radiusKm)
+			for deg := 0; deg < 360; deg += 15 {
+				lat, lng := offset(c[0], c[1], radiusKm*0.99, float64(deg))
+				if d := Distance(c[0], c[1], lat, lng); d > radiusKm {
+					t.Fatalf("offset 计算有误: %v > %v", d, radiusKm)
+				}
+				hash := Encode(lat, lng, HashPrecision)
+				covered := false
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(hash, prefix) {
+						covered = true
+					}
+				}
+				if !covered {
+					t.Errorf("CoverPrefixes(%v, %v, %v) = %v 不包含 %s（方向 %d°）", c[0], c[1], radiusKm, prefixes, hash, deg)
+				}
+			}
+		}
+	}
+}
+
+// offset 从 (lat, lng) 沿方位角 bearing（度）移动 distanceKm 后的坐标
+func offset(lat, lng, distanceKm, bearing float64) (float64, float64) {
+	rad := math.Pi / 180
+	d := distanceKm / earthRadiusKm
+	lat1, lng1, b := lat*rad, lng*rad, bearing*rad
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lng2 := lng1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	lng2 = math.Mod(lng2/rad+540, 360) - 180
+	return lat2 / rad, lng2
+}
+
+func TestValid(t *testing.T) {
+	if !Valid(90, -180) || !Valid(-90, 180) {
+		t.Error("边界坐标应当合法")
+	}
+	if Valid(90.1, 0) || Valid(0, -180.1) || Valid(math.NaN(), 0) {
+		t.Error("超出范围或 NaN 的坐标应当不合法")
+	}
+}
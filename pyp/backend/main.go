@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"collision-backend/config"
@@ -44,17 +50,37 @@ func main() {
 		&models.HotTag{}, // 确保HotTag模型被迁移
 		&models.UserContact{},
 		&models.HotTag{},
+		&models.HotTagBucket{},
+		&models.Notification{},
+		&models.WalletLedger{},
+		&models.WalletDiscrepancy{},
+		&models.IdempotencyKey{},
 		&models.EmailLog{},
 		&models.SystemConfig{},
 		&models.ForbiddenKeyword{},
+		&models.TagSynonym{},
+		&models.LeaderLease{},
+		&models.MatchBacklog{},
+		&models.MatcherRun{},
+		&models.ScheduledJob{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 命令行子命令（数据维护任务），执行完直接退出
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	// 创建默认管理员
 	createDefaultAdmin()
 
+	// 首次启用钱包时写入期初余额流水（需在开始处理扣费请求之前）
+	if err := services.InitWalletLedger(); err != nil {
+		log.Fatal("Failed to initialize wallet ledger:", err)
+	}
+
 	// 启动后台服务（清理服务、匹配服务）
 	go startBackgroundServices()
 
@@ -71,60 +97,124 @@ func main() {
 	routes.SetupRoutes(r)
 	routes.RegisterV3Routes(r)
 
-	// 启动WebSocket服务器，监听8001端口
+	// API 服务器，绑定到0.0.0.0确保手机能访问
+	apiServer := &http.Server{
+		Addr:    "0.0.0.0:" + config.Config.ServerPort,
+		Handler: r,
+	}
+	// WebSocket服务器，监听8001端口
+	wsServer := newWebSocketServer("0.0.0.0:8001")
+
+	go func() {
+		log.Printf("WebSocket服务器启动在8001端口")
+		if err := wsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("WebSocket服务器启动失败:", err)
+		}
+	}()
 	go func() {
-		// WebSocket升级器
-		upgrader := websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // 允许所有跨域请求
-			},
+		log.Printf("HTTP服务器启动在端口 %s", config.Config.ServerPort)
+		if err := apiServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("HTTP服务器启动失败:", err)
 		}
+	}()
+
+	// 等待退出信号（部署时的 SIGTERM 或 Ctrl+C）
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	signal.Stop(quit) // 再次收到信号时直接退出
+
+	timeout := time.Duration(config.Config.ShutdownTimeoutSeconds) * time.Second
+	log.Printf("收到信号 %v，开始关闭服务（最多等待 %v）...", sig, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 先停止接收新请求并等待处理中的请求（包括提交时的即时匹配、发送邮件）完成，
+	// 再停止后台任务并等待正在执行的匹配、清理任务结束
+	if err := apiServer.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ HTTP服务器关闭超时: %v", err)
+	}
+	if err := wsServer.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ WebSocket服务器关闭超时: %v", err)
+	}
+	if err := services.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ 后台任务未能在期限内结束: %v", err)
+	}
+
+	if sqlDB, err := config.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	if config.Redis != nil {
+		config.Redis.Close()
+	}
+	log.Println("服务已关闭")
+}
 
-		// WebSocket处理函数
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// 升级HTTP连接为WebSocket
-			conn, err := upgrader.Upgrade(w, r, nil)
+// newWebSocketServer 创建WebSocket服务器，关闭时向所有连接发送关闭帧并断开（Shutdown 不会等待已升级的连接）
+func newWebSocketServer(addr string) *http.Server {
+	// WebSocket升级器
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true // 允许所有跨域请求
+		},
+	}
+
+	var mu sync.Mutex
+	conns := make(map[*websocket.Conn]bool)
+
+	mux := http.NewServeMux()
+	// WebSocket处理函数
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// 升级HTTP连接为WebSocket
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket升级失败: %v", err)
+			return
+		}
+		mu.Lock()
+		conns[conn] = true
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+
+		log.Printf("新的WebSocket连接")
+
+		// 保持连接，接收消息
+		for {
+			// 读取消息
+			_, message, err := conn.ReadMessage()
 			if err != nil {
-				log.Printf("WebSocket升级失败: %v", err)
-				return
+				log.Printf("WebSocket读取失败: %v", err)
+				break
 			}
-			defer conn.Close()
-
-			log.Printf("新的WebSocket连接")
-
-			// 保持连接，接收消息
-			for {
-				// 读取消息
-				_, message, err := conn.ReadMessage()
-				if err != nil {
-					log.Printf("WebSocket读取失败: %v", err)
-					break
-				}
-
-				// 打印收到的消息
-				log.Printf("收到WebSocket消息: %s", message)
-
-				// 回复消息
-				err = conn.WriteMessage(websocket.TextMessage, []byte("连接成功"))
-				if err != nil {
-					log.Printf("WebSocket写入失败: %v", err)
-					break
-				}
-			}
-		})
 
-		// 启动WebSocket服务器
-		log.Printf("WebSocket服务器启动在8001端口")
-		if err := http.ListenAndServe("0.0.0.0:8001", nil); err != nil {
-			log.Fatal("WebSocket服务器启动失败:", err)
+			// 打印收到的消息
+			log.Printf("收到WebSocket消息: %s", message)
+
+			// 回复消息
+			err = conn.WriteMessage(websocket.TextMessage, []byte("连接成功"))
+			if err != nil {
+				log.Printf("WebSocket写入失败: %v", err)
+				break
+			}
 		}
-	}()
+	})
 
-	// 启动HTTP服务器，绑定到0.0.0.0确保手机能访问
-	log.Printf("HTTP服务器启动在端口 %s", config.Config.ServerPort)
-	if err := r.Run("0.0.0.0:" + config.Config.ServerPort); err != nil {
-		log.Fatal("HTTP服务器启动失败:", err)
-	}
+	server := &http.Server{Addr: addr, Handler: mux}
+	server.RegisterOnShutdown(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "服务器关闭")
+		for conn := range conns {
+			conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			conn.Close()
+		}
+	})
+	return server
 }
 
 func createDefaultAdmin() {
@@ -145,24 +235,32 @@ func createDefaultAdmin() {
 		config.DB.Create(&admin)
 		log.Println("Default admin created - username: admin, password: admin123")
 	}
-
-	// 启动清理服务
-	cleanupService := &services.CleanupService{}
-	cleanupService.StartCleanupTasks()
 }
 
 // startBackgroundServices 启动后台服务
 func startBackgroundServices() {
 	log.Println("启动后台服务...")
 
-	// 1. 启动清理服务
+	// 未开启审核时放行遗留的待审核碰撞码（待审核的碰撞码不参与匹配）
+	if !config.Config.EnableCollisionAudit {
+		config.DB.Model(&models.CollisionCode{}).
+			Where("audit_status = ?", "pending").
+			Update("audit_status", "approved")
+	}
+
+	// 所有定时任务由调度器按 cron 表达式执行（执行计划可在管理后台修改、暂停和手动触发）
+	scheduler := services.JobScheduler()
+
+	// 1. 清理任务：过期碰撞码（每10分钟）、过期匹配（每30分钟）、24小时热门标签（每天0点）
 	cleanupService := &services.CleanupService{}
-	go cleanupService.StartCleanupTasks()
+	cleanupService.RegisterJobs(scheduler)
 
-	// 2. 启动碰撞匹配服务（每5分钟执行一次）
-	// V3.0 已集成邮件通知功能：由用户手动选择发送邮件
+	// 2. 碰撞匹配（每5分钟，启动时立即执行一次）
+	// V3.0 已集成邮件通知功能：由用户手动选择发送邮件
 	collisionMatcher := services.NewCollisionMatcher()
-	go collisionMatcher.StartMatcherService(5 * time.Minute)
+	collisionMatcher.RegisterJobs(scheduler)
+
+	scheduler.Start()
 
 	log.Println("后台服务启动完成")
 }
@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"collision-backend/services"
+	"collision-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader 幂等键请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength 幂等键最大长度
+const maxIdempotencyKeyLength = 100
+
+// responseRecorder 记录写出的响应体，处理完成后保存到幂等键
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 扣费接口的幂等中间件（需在 JWTAuth 之后）
+// 请求带 Idempotency-Key 时，同一用户同一个键只处理一次，重复请求直接返回首次的响应（响应头 Idempotent-Replayed: true）；
+// 首次请求仍在处理中时返回 409，同一个键用于不同的请求（方法、路径或请求体不同）时返回 422。
+// 首次请求返回 5xx 时不保存响应，可以用同一个键重试。不带该请求头时不做处理
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID := c.GetUint("user_id")
+		if key == "" || userID == 0 {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, utils.Error(400, "Idempotency-Key too long"))
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.Error(400, "Invalid request body"))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		token, saved, err := services.ReserveIdempotencyKey(userID, key, fingerprint)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			c.JSON(http.StatusConflict, utils.Error(409, "A request with this Idempotency-Key is still being processed"))
+			c.Abort()
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.JSON(http.StatusUnprocessableEntity, utils.Error(422, "Idempotency-Key was used for a different request"))
+			c.Abort()
+			return
+		case err != nil:
+			// 无法确认是否重复时不处理，避免重复扣费
+			log.Printf("幂等键存储不可用: %v", err)
+			c.JSON(http.StatusServiceUnavailable, utils.Error(503, "Service temporarily unavailable, please retry"))
+			c.Abort()
+			return
+		case saved != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(saved.StatusCode, saved.ContentType, saved.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		release := true
+		defer func() {
+			// 处理失败（5xx 或 panic）时释放，允许重试
+			if release {
+				if err := services.ReleaseIdempotencyKey(userID, key, fingerprint, token); err != nil {
+					log.Printf("释放幂等键失败: user_id=%d key=%s err=%v", userID, key, err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		// 已处理成功，保存失败时也不释放（占用到期前重复请求返回 409），避免重复扣费
+		release = false
+		if err := services.CompleteIdempotencyKey(userID, key, token, services.IdempotentResponse{
+			Fingerprint: fingerprint,
+			StatusCode:  recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		}); err != nil {
+			log.Printf("保存幂等键响应失败: user_id=%d key=%s err=%v", userID, key, err)
+		}
+	}
+}
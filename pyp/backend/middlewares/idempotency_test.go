@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useIdempotencyDB 使用 TEST_MYSQL_DSN 指定的测试库存储幂等键（会清空 idempotency_keys），未设置时跳过
+func useIdempotencyDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过需要 MySQL 的测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	if err := db.Exec("DELETE FROM idempotency_keys").Error; err != nil {
+		t.Fatalf("清空 idempotency_keys 失败: %v", err)
+	}
+
+	// 幂等键存储在第一次使用时选定，测试中固定为 MySQL
+	config.Config.IdempotencyBackend = "mysql"
+	config.Redis = nil
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// idempotencyRouter 模拟扣费接口：/debit 总是成功，/flaky 第一次返回 500，/reject 返回 400
+func idempotencyRouter(userID uint, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", userID) }, Idempotency())
+	router.POST("/debit", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusOK, gin.H{"code": 200, "call": *calls})
+	})
+	router.POST("/flaky", func(c *gin.Context) {
+		*calls++
+		if *calls == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 200, "call": *calls})
+	})
+	router.POST("/reject", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "call": *calls})
+	})
+	return router
+}
+
+func serveIdempotent(router http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	useIdempotencyDB(t)
+
+	type request struct {
+		path, key, body string
+		wantStatus      int
+		wantReplayed    bool
+	}
+	tests := []struct {
+		name      string
+		requests  []request
+		wantCalls int
+	}{
+		{"重复请求返回首次的响应", []request{
+			{"/debit", "k1", `{"amount":10}`, 200, false},
+			{"/debit", "k1", `{"amount":10}`, 200, true},
+			{"/debit", "k1", `{"amount":10}`, 200, true},
+		}, 1},
+		{"不同的键分别处理", []request{
+			{"/debit", "k1", `{"amount":10}`, 200, false},
+			{"/debit", "k2", `{"amount":10}`, 200, false},
+		}, 2},
+		{"请求体不同返回 422", []request{
+			{"/debit", "k1", `{"amount":10}`, 200, false},
+			{"/debit", "k1", `{"amount":20}`, 422, false},
+		}, 1},
+		{"路径不同返回 422", []request{
+			{"/debit", "k1", `{"amount":10}`, 200, false},
+			{"/reject", "k1", `{"amount":10}`, 422, false},
+		}, 1},
+		{"5xx 时释放，可以用同一个键重试", []request{
+			{"/flaky", "k1", `{}`, 500, false},
+			{"/flaky", "k1", `{}`, 200, false},
+			{"/flaky", "k1", `{}`, 200, true},
+		}, 2},
+		{"4xx 也保存响应", []request{
+			{"/reject", "k1", `{}`, 400, false},
+			{"/reject", "k1", `{}`, 400, true},
+		}, 1},
+		{"不带幂等键时不处理", []request{
+			{"/debit", "", `{"amount":10}`, 200, false},
+			{"/debit", "", `{"amount":10}`, 200, false},
+		}, 2},
+		{"幂等键过长", []request{
+			{"/debit", strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`, 400, false},
+		}, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			// 每个用例使用不同的用户，幂等键互不影响
+			router := idempotencyRouter(uint(i+1), &calls)
+			var first string
+			for j, r := range tt.requests {
+				w := serveIdempotent(router, r.path, r.key, r.body)
+				if w.Code != r.wantStatus {
+					t.Errorf("第 %d 个请求状态码 = %d, want %d（%s）", j+1, w.Code, r.wantStatus, w.Body.String())
+				}
+				if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != r.wantReplayed {
+					t.Errorf("第 %d 个请求 Idempotent-Replayed = %v, want %v", j+1, replayed, r.wantReplayed)
+				}
+				if r.wantReplayed && w.Body.String() != first {
+					t.Errorf("第 %d 个请求返回 %s, want 首次的响应 %s", j+1, w.Body.String(), first)
+				}
+				if w.Code < 500 && first == "" {
+					first = w.Body.String()
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("处理了 %d 次，want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	useIdempotencyDB(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", uint(100)) }, Idempotency())
+	calls := 0
+	var concurrent *httptest.ResponseRecorder
+	router.POST("/debit", func(c *gin.Context) {
+		calls++
+		// 首次请求处理中到达的重复请求
+		concurrent = serveIdempotent(router, "/debit", "k1", `{"amount":10}`)
+		c.JSON(http.StatusOK, gin.H{"code": 200})
+	})
+
+	if w := serveIdempotent(router, "/debit", "k1", `{"amount":10}`); w.Code != http.StatusOK {
+		t.Fatalf("首次请求状态码 = %d", w.Code)
+	}
+	if concurrent == nil || concurrent.Code != http.StatusConflict {
+		t.Errorf("处理中的重复请求 = %v, want 409", concurrent)
+	}
+	if calls != 1 {
+		t.Errorf("处理了 %d 次，want 1", calls)
+	}
+	if w := serveIdempotent(router, "/debit", "k1", `{"amount":10}`); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("处理完成后的重复请求没有返回保存的响应: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -3,47 +3,78 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"collision-backend/tagnorm"
+
+	"gorm.io/gorm"
 )
 
 // CollisionList 碰撞列表
 type CollisionList struct {
-	ID         uint64    `json:"id" gorm:"primaryKey"`
-	UserID     uint64    `json:"user_id" gorm:"index;not null"`
-	Keyword    string    `json:"keyword" gorm:"size:100;not null"`
-	Duration   int       `json:"duration" gorm:"default:30"`
-	CostPoints int       `json:"cost_points" gorm:"default:30"`
-	Status     string    `json:"status" gorm:"size:20;default:active"` // active, inactive, expired
-	ExpireAt   time.Time `json:"expire_at" gorm:"index"`
-	MatchCount int       `json:"match_count" gorm:"default:0"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID               uint64    `json:"id" gorm:"primaryKey"`
+	UserID           uint64    `json:"user_id" gorm:"index;not null"`
+	Keyword          string    `json:"keyword" gorm:"size:100;not null"`
+	KeywordCanonical string    `json:"keyword_canonical" gorm:"size:100;index"` // 关键词规范形式
+	Duration         int       `json:"duration" gorm:"default:30"`
+	CostPoints       int       `json:"cost_points" gorm:"default:30"`
+	Status           string    `json:"status" gorm:"size:20;default:active"` // active, inactive, expired
+	ExpireAt         time.Time `json:"expire_at" gorm:"index"`
+	MatchCount       int       `json:"match_count" gorm:"default:0"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// 匹配模式（见 CollisionCode.MatchMode），geo 模式以发布者默认地址的坐标为发布位置，按 RadiusKm 匹配
+	MatchMode string  `json:"match_mode" gorm:"size:20;default:region_reciprocal"`
+	RadiusKm  float64 `json:"radius_km" gorm:"default:0"`
+
+	// 到期前自动续期，余额不足时跳过并通知，见 services.AutoRenew
+	AutoRenew bool `json:"auto_renew" gorm:"default:false"`
 }
 
 func (CollisionList) TableName() string {
 	return "collision_lists"
 }
 
+// BeforeSave 保存前生成关键词规范形式
+func (l *CollisionList) BeforeSave(tx *gorm.DB) error {
+	l.Keyword = tagnorm.Display(l.Keyword)
+	l.KeywordCanonical = tagnorm.Canonical(l.Keyword)
+	return nil
+}
+
 // CollisionResult 碰撞结果
 type CollisionResult struct {
-	ID              uint64     `json:"id" gorm:"primaryKey"`
-	UserID          uint64     `json:"user_id" gorm:"index;not null"`
-	MatchedUserID   uint64     `json:"matched_user_id" gorm:"index;not null"`
-	CollisionListID uint64     `json:"collision_list_id" gorm:"index;not null"`
-	Keyword         string     `json:"keyword" gorm:"size:100;not null"`
-	MatchedEmail    string     `json:"matched_email" gorm:"size:255"`
-	Remark          string     `json:"remark" gorm:"size:20;default:''"`
-	IsKnown         bool       `json:"is_known" gorm:"default:false"`
-	EmailSent       bool       `json:"email_sent" gorm:"default:false"`
-	EmailSentAt     *time.Time `json:"email_sent_at"`
-	MatchedAt       time.Time  `json:"matched_at" gorm:"index"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+	ID               uint64     `json:"id" gorm:"primaryKey"`
+	UserID           uint64     `json:"user_id" gorm:"index;not null;uniqueIndex:idx_collision_result_pair,priority:2"`
+	MatchedUserID    uint64     `json:"matched_user_id" gorm:"index;not null"`
+	CollisionListID  uint64     `json:"collision_list_id" gorm:"index;not null"`
+	Keyword          string     `json:"keyword" gorm:"size:100;not null"`
+	KeywordCanonical string     `json:"keyword_canonical" gorm:"size:100;index"`   // 关键词规范形式
+	MatchType        string     `json:"match_type" gorm:"size:20;default:keyword"` // keyword, synonym, fuzzy
+	MatchedTags      string     `json:"matched_tags" gorm:"size:500"`              // 重合的标签（我方写法，逗号分隔）
+	OverlapCount     int        `json:"overlap_count" gorm:"default:1"`            // 重合的标签数
+	Score            float64    `json:"score" gorm:"default:0;index"`              // 匹配得分（0-100），见 services.ScoreResults
+	MatchedEmail     string     `json:"matched_email" gorm:"size:255"`
+	Remark           string     `json:"remark" gorm:"size:20;default:''"`
+	IsKnown          bool       `json:"is_known" gorm:"default:false"`
+	EmailSent        bool       `json:"email_sent" gorm:"default:false"`
+	EmailSentAt      *time.Time `json:"email_sent_at"`
+	PairKey          *string    `json:"-" gorm:"size:191;uniqueIndex:idx_collision_result_pair,priority:1"` // 匹配对唯一键（见 MatchPairKey），与 UserID 组成唯一索引
+	MatchedAt        time.Time  `json:"matched_at" gorm:"index"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 func (CollisionResult) TableName() string {
 	return "collision_results"
 }
 
+// BeforeSave 保存前生成关键词规范形式
+func (r *CollisionResult) BeforeSave(tx *gorm.DB) error {
+	r.KeywordCanonical = tagnorm.Canonical(r.Keyword)
+	return nil
+}
+
 // UserContact 用户联系方式
 type UserContact struct {
 	ID                uint64     `json:"id" gorm:"primaryKey"`
@@ -65,21 +96,30 @@ func (UserContact) TableName() string {
 
 // HotTag 热门标签
 type HotTag struct {
-	ID           uint64     `json:"id" gorm:"primaryKey"`
-	Keyword      string     `json:"keyword" gorm:"size:100;uniqueIndex;not null"`
-	Count24h     int        `json:"count_24h" gorm:"column:count_24h;default:0;index"`
-	CountTotal   int        `json:"count_total" gorm:"column:count_total;default:0;index"`
-	Status       string     `json:"status" gorm:"size:20;default:show"` // show, hide, blackhole
-	SubmitCount  int        `json:"submit_count" gorm:"default:0"`
-	LastSearchAt *time.Time `json:"last_search_at"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID               uint64     `json:"id" gorm:"primaryKey"`
+	Keyword          string     `json:"keyword" gorm:"size:100;uniqueIndex;not null"`
+	KeywordCanonical string     `json:"keyword_canonical" gorm:"size:100;index"` // 关键词规范形式，统计按此合并
+	Count24h         int        `json:"count_24h" gorm:"column:count_24h;default:0;index"`
+	CountTotal       int        `json:"count_total" gorm:"column:count_total;default:0;index"`
+	Status           string     `json:"status" gorm:"size:20;default:show"`    // show, hide, blackhole
+	MatchHistorical  bool       `json:"match_historical" gorm:"default:false"` // 历史匹配模式：不要求双方有效期重叠
+	SubmitCount      int        `json:"submit_count" gorm:"default:0"`
+	LastSearchAt     *time.Time `json:"last_search_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 func (HotTag) TableName() string {
 	return "hot_tags"
 }
 
+// BeforeSave 保存前生成关键词规范形式
+func (t *HotTag) BeforeSave(tx *gorm.DB) error {
+	t.Keyword = tagnorm.Display(t.Keyword)
+	t.KeywordCanonical = tagnorm.Canonical(t.Keyword)
+	return nil
+}
+
 // EmailLog 邮件发送记录
 type EmailLog struct {
 	ID        uint64     `json:"id" gorm:"primaryKey"`
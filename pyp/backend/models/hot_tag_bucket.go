@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// HotTagBucket 热门标签的小时计数桶（MySQL 存储时使用），24小时榜为最近24个小时桶之和
+type HotTagBucket struct {
+	KeywordCanonical string    `json:"keyword_canonical" gorm:"primaryKey;size:100"`
+	BucketAt         time.Time `json:"bucket_at" gorm:"primaryKey;index"` // 小时起点
+	Hits             int       `json:"hits" gorm:"default:0"`
+}
+
+func (HotTagBucket) TableName() string {
+	return "hot_tag_buckets"
+}
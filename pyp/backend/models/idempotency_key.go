@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey 扣费接口的幂等键（MySQL 存储时使用）：同一用户同一个 Idempotency-Key 只处理一次，之后返回保存的首次响应
+type IdempotencyKey struct {
+	ID          uint64    `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_user_key,priority:1"`
+	Key         string    `json:"key" gorm:"column:idempotency_key;size:100;not null;uniqueIndex:idx_idempotency_user_key,priority:2"`
+	Fingerprint string    `json:"fingerprint" gorm:"size:64"`     // 请求方法、路径和请求体的摘要，同一个键用于不同请求时拒绝
+	Token       string    `json:"-" gorm:"size:32"`               // 本次占用的标识，保存响应和释放时校验
+	Status      string    `json:"status" gorm:"size:20;not null"` // pending（处理中）, done（已保存响应）
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type" gorm:"size:100"`
+	Body        []byte    `json:"-" gorm:"type:mediumblob"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"` // 处理中时为锁的过期时间，完成后为保留期限
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LeaderLease 后台任务选主租约（Redis 不可用时使用）
+// 每个任务一行，Holder 为当前持有租约的实例，过期后其他实例可以接管
+type LeaderLease struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	Job       string    `json:"job" gorm:"size:100;uniqueIndex;not null"`
+	Holder    string    `json:"holder" gorm:"size:200;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (LeaderLease) TableName() string {
+	return "leader_leases"
+}
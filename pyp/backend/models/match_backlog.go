@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// MatchBacklog 待匹配队列：超过单个碰撞码或单个标签每轮匹配上限而推迟的匹配，后续每轮匹配优先处理
+// 一方来自碰撞列表时 CodeID 为 0、ListID 为列表ID
+type MatchBacklog struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	CodeID1   uint      `json:"code_id1" gorm:"uniqueIndex:idx_match_backlog_pair,priority:1"`
+	ListID1   uint64    `json:"list_id1" gorm:"uniqueIndex:idx_match_backlog_pair,priority:2"`
+	CodeID2   uint      `json:"code_id2" gorm:"uniqueIndex:idx_match_backlog_pair,priority:3"`
+	ListID2   uint64    `json:"list_id2" gorm:"uniqueIndex:idx_match_backlog_pair,priority:4"`
+	Tag       string    `json:"tag" gorm:"size:100;index"` // 计入上限的标签（规范形式）
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (MatchBacklog) TableName() string {
+	return "match_backlogs"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// MatcherRun 一次匹配任务的执行记录：定期匹配、提交/重新提交时的即时匹配和管理员手动触发的匹配各记一条
+type MatcherRun struct {
+	ID             uint64    `json:"id" gorm:"primaryKey"`
+	Source         string    `json:"source" gorm:"size:20;index"` // ticker, submit, resubmit, manual
+	Mode           string    `json:"mode" gorm:"size:20"`         // incremental, full, code, list
+	InstanceID     string    `json:"instance_id" gorm:"size:100"` // 执行匹配的实例
+	StartedAt      time.Time `json:"started_at" gorm:"index"`
+	FinishedAt     time.Time `json:"finished_at"`
+	DurationMs     int64     `json:"duration_ms"`
+	CodesScanned   int       `json:"codes_scanned"`
+	ListsScanned   int       `json:"lists_scanned"`
+	PairsEvaluated int       `json:"pairs_evaluated"` // 进入匹配判断的候选对数
+	MatchesCreated int       `json:"matches_created"`
+	Deferred       int       `json:"deferred"` // 超过匹配上限推迟到待匹配队列的匹配
+	Errors         int       `json:"errors"`
+	LastError      string    `json:"last_error" gorm:"size:500"`
+}
+
+func (MatcherRun) TableName() string {
+	return "matcher_runs"
+}
@@ -1,8 +1,13 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
+	"collision-backend/geo"
+	"collision-backend/tagnorm"
+
 	"gorm.io/gorm"
 )
 
@@ -53,7 +58,14 @@ type CollisionCode struct {
 	User      User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
 
 	// 兴趣标签/碰撞码
-	Tag string `gorm:"size:50;index" json:"tag"` // 兴趣标签（新字段）
+	Tag          string `gorm:"size:50;index" json:"tag"`           // 兴趣标签（新字段）
+	TagCanonical string `gorm:"size:50;index" json:"tag_canonical"` // 标签规范形式，用于匹配和统计
+
+	// 组合碰撞码：一次提交多个标签（逗号分隔，Tag 为第一个标签），至少 MinOverlap 个标签与对方重合才匹配
+	// 单标签碰撞码 Tags 为空，只使用 Tag
+	Tags          string `gorm:"size:500" json:"tags"`
+	TagsCanonical string `gorm:"size:500" json:"-"`
+	MinOverlap    int    `gorm:"default:1" json:"min_overlap"`
 
 	// 发布者地址信息（用于匹配）
 	Country  string `gorm:"size:50;index" json:"country"`
@@ -61,6 +73,20 @@ type CollisionCode struct {
 	City     string `gorm:"size:50;index" json:"city"`
 	District string `gorm:"size:50;index" json:"district"`
 
+	// 发布位置坐标（可选，WGS84），Geohash 由 BeforeSave 生成，用于按距离查找
+	// RadiusKm > 0 时按距离匹配：对方发布位置必须在该距离内，此时不再检查地区
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Geohash   string   `gorm:"size:12;index" json:"-"`
+	RadiusKm  float64  `gorm:"default:0" json:"radius_km"`
+
+	// 按发布者已保存的地址匹配（UserLocation.Label，逗号分隔，all 表示全部地址）
+	// 为空时使用上面填写的搜索地区；设置后以这些地址作为搜索地区，对方的任一已保存地址在其中即可
+	TargetLabels string `gorm:"size:100" json:"target_labels"`
+
+	// 匹配模式（exact/region_reciprocal/fuzzy/geo，见 services.MatchStrategy），决定标签关联方式和位置检查
+	MatchMode string `gorm:"size:20;default:region_reciprocal" json:"match_mode"`
+
 	// 发布者性别
 	Gender int `gorm:"index" json:"gender"` // 发布者性别
 
@@ -73,6 +99,9 @@ type CollisionCode struct {
 	ExpiresAt time.Time `gorm:"index" json:"expires_at"`      // 24小时后过期
 	CostCoins int       `gorm:"default:0" json:"cost_coins"`  // 发布消耗金币
 
+	// 到期前自动续期（扣除金币，余额不足时跳过并通知），见 services.AutoRenew
+	AutoRenew bool `gorm:"default:false" json:"auto_renew"`
+
 	// 审核信息
 	AuditStatus  string     `gorm:"default:pending" json:"audit_status"` // pending, approved, rejected
 	AuditBy      uint       `json:"audit_by"`                            // 审核人ID
@@ -87,6 +116,106 @@ type CollisionCode struct {
 	IsForbidden bool `gorm:"-" json:"is_forbidden"` // 是否命中违禁词
 }
 
+// BeforeSave 保存前整理标签展示形式并生成规范形式
+func (c *CollisionCode) BeforeSave(tx *gorm.DB) error {
+	if c.Tags != "" {
+		c.SetTags(strings.Split(c.Tags, ","))
+	}
+	c.Tag = tagnorm.Display(c.Tag)
+	c.TagCanonical = tagnorm.Canonical(c.Tag)
+	c.Geohash = coordinateHash(c.Latitude, c.Longitude)
+	return nil
+}
+
+// Coordinates 发布位置坐标，未填写时 ok 为 false
+func (c *CollisionCode) Coordinates() (lat, lng float64, ok bool) {
+	if c.Latitude == nil || c.Longitude == nil {
+		return 0, 0, false
+	}
+	return *c.Latitude, *c.Longitude, true
+}
+
+// TargetLabelList 按已保存地址匹配时的地址标签，未设置时为空
+func (c *CollisionCode) TargetLabelList() []string {
+	if c.TargetLabels == "" {
+		return nil
+	}
+	return strings.Split(c.TargetLabels, ",")
+}
+
+// coordinateHash 坐标对应的 geohash，没有坐标时为空
+func coordinateHash(lat, lng *float64) string {
+	if lat == nil || lng == nil || !geo.Valid(*lat, *lng) {
+		return ""
+	}
+	return geo.Encode(*lat, *lng, geo.HashPrecision)
+}
+
+// SetTags 设置组合碰撞码的标签（去掉空标签和规范形式重复的标签），只有一个标签时退化为单标签碰撞码
+func (c *CollisionCode) SetTags(tags []string) {
+	var displays, canonicals []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		// 逗号是标签分隔符，标签内的中英文逗号都视为分隔
+		for _, part := range strings.FieldsFunc(tag, isTagSeparator) {
+			display, canonical := tagnorm.Display(part), tagnorm.Canonical(part)
+			if canonical == "" || seen[canonical] {
+				continue
+			}
+			seen[canonical] = true
+			displays = append(displays, display)
+			canonicals = append(canonicals, canonical)
+		}
+	}
+
+	if len(displays) > 0 {
+		c.Tag = displays[0]
+	}
+	if len(displays) <= 1 {
+		c.Tags, c.TagsCanonical, c.MinOverlap = "", "", 1
+		return
+	}
+	c.Tags = strings.Join(displays, ",")
+	c.TagsCanonical = strings.Join(canonicals, ",")
+	if c.MinOverlap < 1 {
+		c.MinOverlap = 1
+	}
+	if c.MinOverlap > len(displays) {
+		c.MinOverlap = len(displays)
+	}
+}
+
+func isTagSeparator(r rune) bool {
+	return r == ',' || r == '，'
+}
+
+// TagList 碰撞码的全部标签（展示形式）
+func (c *CollisionCode) TagList() []string {
+	if c.Tags == "" {
+		return []string{c.Tag}
+	}
+	return strings.Split(c.Tags, ",")
+}
+
+// CanonicalTags 碰撞码全部标签的规范形式，与 TagList 一一对应
+func (c *CollisionCode) CanonicalTags() []string {
+	if c.TagsCanonical == "" {
+		if c.TagCanonical == "" {
+			return nil
+		}
+		return []string{c.TagCanonical}
+	}
+	return strings.Split(c.TagsCanonical, ",")
+}
+
+// RequiredOverlap 匹配时至少需要重合的标签数
+func (c *CollisionCode) RequiredOverlap() int {
+	if c.Tags == "" || c.MinOverlap < 1 {
+		return 1
+	}
+	return c.MinOverlap
+}
+
 // 碰撞记录表
 type CollisionRecord struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -95,14 +224,25 @@ type CollisionRecord struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// 匹配双方
-	UserID1 uint `gorm:"not null;index" json:"user_id1"`
+	UserID1 uint `gorm:"not null;index;uniqueIndex:idx_collision_record_pair,priority:2" json:"user_id1"`
 	UserID2 uint `gorm:"not null;index" json:"user_id2"`
 	User1   User `gorm:"foreignKey:UserID1" json:"user1,omitempty"`
 	User2   User `gorm:"foreignKey:UserID2" json:"user2,omitempty"`
 
+	// 匹配对唯一键（见 MatchPairKey），与 UserID1 组成唯一索引，保证同一对用户同一关键词只有一条记录
+	// 海底捞等非匹配产生的记录为 NULL
+	PairKey *string `gorm:"size:191;uniqueIndex:idx_collision_record_pair,priority:1" json:"-"`
+
 	// 匹配信息
 	Tag       string `gorm:"size:50;not null" json:"tag"`        // 匹配的兴趣标签
-	MatchType string `gorm:"size:20;not null" json:"match_type"` // district, city, province, country
+	MatchType string `gorm:"size:20;not null" json:"match_type"` // keyword 标签相同, synonym 同义词, fuzzy 模糊匹配
+
+	// 本次匹配通过的规则（逗号分隔），如 keyword,gender,age_range,region
+	MatchedRules string `gorm:"size:255" json:"matched_rules"`
+
+	// 组合碰撞码重合的标签（UserID1 一方的写法，逗号分隔）及重合数量，单标签匹配时为 1
+	MatchedTags  string `gorm:"size:500" json:"matched_tags"`
+	OverlapCount int    `gorm:"default:1" json:"overlap_count"`
 
 	// 匹配时的地理信息
 	MatchCountry  string `gorm:"size:50" json:"match_country"`
@@ -110,6 +250,12 @@ type CollisionRecord struct {
 	MatchCity     string `gorm:"size:50" json:"match_city"`
 	MatchDistrict string `gorm:"size:50" json:"match_district"`
 
+	// 双方发布位置的距离（公里），任一方没有坐标时为空
+	DistanceKm *float64 `json:"distance_km"`
+
+	// 产生这次匹配的地址标签（home 老家、school 学校、work 工作地、other 其他），未按已保存地址匹配时为空
+	LocationLabel string `gorm:"size:20" json:"location_label"`
+
 	// 状态管理
 	Status            string    `gorm:"size:20;default:matched" json:"status"` // matched, friend_added, missed
 	AddFriendDeadline time.Time `json:"add_friend_deadline"`                   // 加好友截止时间
@@ -119,6 +265,26 @@ type CollisionRecord struct {
 	EmailStatus string     `gorm:"size:20;default:''" json:"email_status"` // 邮件发送状态：success, failed, pending
 }
 
+// MatchPairKey 匹配对唯一键：较小用户ID-较大用户ID-关键词规范形式
+func MatchPairKey(userID1, userID2 uint64, tags []string) string {
+	if userID1 > userID2 {
+		userID1, userID2 = userID2, userID1
+	}
+	return fmt.Sprintf("%d-%d-%s", userID1, userID2, PairKeyword(tags))
+}
+
+// PairKeyword 一次匹配的代表关键词：tags 为双方重合的标签，取规范形式最小的一个，保证从哪一方发起匹配得到的结果都相同
+func PairKeyword(tags []string) string {
+	keyword := ""
+	for _, tag := range tags {
+		canonical := tagnorm.Canonical(tag)
+		if canonical != "" && (keyword == "" || canonical < keyword) {
+			keyword = canonical
+		}
+	}
+	return keyword
+}
+
 // 好友表
 type Friend struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -204,5 +370,22 @@ type UserLocation struct {
 	City     string `gorm:"size:50" json:"city"`     // 城市
 	District string `gorm:"size:50" json:"district"` // 区县
 
+	// 坐标（可选，WGS84），发布碰撞码时未提供坐标则使用默认地址的坐标
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Geohash   string   `gorm:"size:12;index" json:"-"`
+
 	IsDefault bool `gorm:"default:false" json:"is_default"` // 是否为默认地址
 }
+
+// LocationLabels 地址标签，碰撞码按已保存地址匹配时还可以使用 LocationLabelAll 表示全部地址
+var LocationLabels = []string{"home", "school", "work", "other"}
+
+// LocationLabelAll 按全部已保存地址匹配
+const LocationLabelAll = "all"
+
+// BeforeSave 保存前生成坐标的 geohash
+func (l *UserLocation) BeforeSave(tx *gorm.DB) error {
+	l.Geohash = coordinateHash(l.Latitude, l.Longitude)
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Notification 站内通知（到期提醒、自动续期结果等）
+type Notification struct {
+	ID        uint64     `json:"id" gorm:"primaryKey"`
+	UserID    uint64     `json:"user_id" gorm:"index;not null"`
+	Type      string     `json:"type" gorm:"size:30;index"` // expiry_reminder, auto_renewed, auto_renew_skipped
+	Title     string     `json:"title" gorm:"size:100"`
+	Content   string     `json:"content" gorm:"size:500"`
+	RefType   string     `json:"ref_type" gorm:"size:20"` // collision_code, collision_list
+	RefID     uint64     `json:"ref_id"`
+	DedupKey  *string    `json:"-" gorm:"size:191;uniqueIndex"` // 相同的通知只发送一次（如同一到期时间只提醒一次）
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
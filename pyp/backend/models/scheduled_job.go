@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ScheduledJob 后台任务的执行状态：最近一次执行和下一次计划执行时间（执行计划和暂停状态保存在 system_configs）
+type ScheduledJob struct {
+	Name           string     `json:"name" gorm:"primaryKey;size:50"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastStatus     string     `json:"last_status" gorm:"size:20"`    // success, failed
+	LastError      string     `json:"last_error" gorm:"size:500"`    // 执行失败（panic）时的错误
+	LastInstance   string     `json:"last_instance" gorm:"size:100"` // 最近一次执行的实例
+	NextRunAt      *time.Time `json:"next_run_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (ScheduledJob) TableName() string {
+	return "scheduled_jobs"
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"collision-backend/tagnorm"
+
+	"gorm.io/gorm"
+)
+
+// TagSynonym 标签同义词/别名，由管理员维护
+// 同一个 Keyword 下的所有同义词互相视为同义
+type TagSynonym struct {
+	ID               uint64    `json:"id" gorm:"primaryKey"`
+	Keyword          string    `json:"keyword" gorm:"size:100;not null"`
+	KeywordCanonical string    `json:"keyword_canonical" gorm:"size:100;uniqueIndex:idx_tag_synonym_pair"`
+	Synonym          string    `json:"synonym" gorm:"size:100;not null"`
+	SynonymCanonical string    `json:"synonym_canonical" gorm:"size:100;uniqueIndex:idx_tag_synonym_pair;index"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (TagSynonym) TableName() string {
+	return "tag_synonyms"
+}
+
+// BeforeSave 保存前统一标签的展示形式和规范形式
+func (s *TagSynonym) BeforeSave(tx *gorm.DB) error {
+	s.Keyword = tagnorm.Display(s.Keyword)
+	s.KeywordCanonical = tagnorm.Canonical(s.Keyword)
+	s.Synonym = tagnorm.Display(s.Synonym)
+	s.SynonymCanonical = tagnorm.Canonical(s.Synonym)
+	return nil
+}
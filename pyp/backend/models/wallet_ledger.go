@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// WalletLedger 金币流水：每次余额变动一行，amount 为变动量（扣除为负），balance_after 为变动后的余额
+type WalletLedger struct {
+	ID           uint64    `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"index;not null"`
+	Amount       int       `json:"amount" gorm:"not null"`
+	BalanceAfter int       `json:"balance_after" gorm:"not null"`
+	Type         string    `json:"type" gorm:"size:30;not null"` // 与消费记录类型一致，另有 opening（期初余额）、admin_adjust
+	Reason       string    `json:"reason" gorm:"size:100"`
+	RefType      string    `json:"ref_type" gorm:"size:30;index:idx_wallet_ledger_ref"` // collision_code, collision_list, collision_record ...
+	RefID        uint64    `json:"ref_id" gorm:"index:idx_wallet_ledger_ref"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (WalletLedger) TableName() string {
+	return "wallet_ledgers"
+}
+
+// WalletDiscrepancy 对账发现的余额与流水合计不一致的用户，每次对账后更新，恢复一致后删除
+type WalletDiscrepancy struct {
+	UserID     uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Coins      int       `json:"coins"`
+	LedgerSum  int       `json:"ledger_sum"`
+	DetectedAt time.Time `json:"detected_at"` // 首次发现时间
+	CheckedAt  time.Time `json:"checked_at"`  // 最近一次对账时间
+}
+
+func (WalletDiscrepancy) TableName() string {
+	return "wallet_discrepancies"
+}
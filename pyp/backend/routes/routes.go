@@ -16,6 +16,9 @@ func SetupRoutes(r *gin.Engine) {
 	// API路由组
 	api := r.Group("/api")
 
+	// 扣费接口：请求带 Idempotency-Key 时同一用户同一个键只处理一次（需在 JWTAuth 之后）
+	idempotent := middlewares.Idempotency()
+
 	// 微信小程序用户路由（不需要认证）
 	userController := &controllers.UserController{}
 	collisionUserController := &controllers.CollisionController{}
@@ -33,29 +36,30 @@ func SetupRoutes(r *gin.Engine) {
 		userAuth.GET("/recharge-records", userController.GetRechargeRecords) // 获取充值记录
 		userAuth.PUT("/location", userController.UpdateUserLocation)         // 新增地址更新接口
 		userAuth.GET("/collision-codes/:id", collisionUserController.GetMyCollisionCodeByID)
-		userAuth.PUT("/collision-codes/:id", collisionUserController.UpdateMyCollisionCode)
+		userAuth.PUT("/collision-codes/:id", idempotent, collisionUserController.UpdateMyCollisionCode)
 	}
 	}
 
 	// 碰撞相关路由（需要用户认证）
 	collision := api.Group("/collision").Use(middlewares.JWTAuth())
 	{
-		collision.POST("/submit", collisionUserController.SubmitCode)
-		collision.POST("/batch-submit", collisionUserController.BatchSubmitCodes)
+		collision.POST("/submit", idempotent, collisionUserController.SubmitCode)
+		collision.POST("/batch-submit", idempotent, collisionUserController.BatchSubmitCodes)
 		collision.GET("/matches", collisionUserController.GetMatches)
 		collision.GET("/matches/:id", collisionUserController.GetMatchDetail)
 		collision.GET("/hot-codes", collisionUserController.GetHotCodes)
 		collision.GET("/my-code", collisionUserController.GetMyCollisionCode)
-		collision.GET("/my-codes", collisionUserController.GetMyCollisionCodes)                 // 获取所有碰撞码
-		collision.POST("/my-codes/:id/renew", collisionUserController.RenewCollisionCode)       // 续费碰撞码
-		collision.POST("/my-codes/:id/resubmit", collisionUserController.ResubmitCollisionCode) // 重新提交碰撞码
+		collision.GET("/my-codes", collisionUserController.GetMyCollisionCodes)                             // 获取所有碰撞码
+		collision.POST("/my-codes/:id/renew", idempotent, collisionUserController.RenewCollisionCode)       // 续费碰撞码
+		collision.POST("/my-codes/:id/resubmit", idempotent, collisionUserController.ResubmitCollisionCode) // 重新提交碰撞码
+		collision.PUT("/my-codes/:id/auto-renew", collisionUserController.SetCollisionCodeAutoRenew)        // 开启/关闭自动续期
 		collision.DELETE("/my-codes/:id", collisionUserController.DeleteMyCollisionCode)
 		collision.POST("/search", collisionUserController.SearchCollisionCodes)
 		collision.POST("/add-friend", collisionUserController.AddFriend)
 		collision.POST("/send-friend-request", collisionUserController.SendFriendRequest)
-		collision.POST("/force-add-friend", collisionUserController.ForceAddFriend)
-		collision.POST("/haidilao", collisionUserController.Haidilao)
-		collision.POST("/send-email", collisionUserController.SendEmailToMatchedUser) // 新增发送邮件给匹配用户的API
+		collision.POST("/force-add-friend", idempotent, collisionUserController.ForceAddFriend)
+		collision.POST("/haidilao", idempotent, collisionUserController.Haidilao)
+		collision.POST("/send-email", idempotent, collisionUserController.SendEmailToMatchedUser) // 新增发送邮件给匹配用户的API
 	}
 
 	// 用户地址管理路由（需要用户认证）
@@ -69,6 +73,24 @@ func SetupRoutes(r *gin.Engine) {
 		locations.PUT("/:id/default", locationController.SetDefaultLocation)
 	}
 
+	// 站内通知（需要用户认证）
+	notificationController := &controllers.NotificationController{}
+	notifications := api.Group("/notifications").Use(middlewares.JWTAuth())
+	{
+		notifications.GET("", notificationController.GetNotifications)
+		notifications.PUT("/read-all", notificationController.MarkAllNotificationsRead)
+		notifications.PUT("/:id/read", notificationController.MarkNotificationRead)
+	}
+
+	// 拉黑管理路由（需要用户认证）
+	blockController := &controllers.BlockController{}
+	blocks := api.Group("/blocks").Use(middlewares.JWTAuth())
+	{
+		blocks.GET("", blockController.GetBlockedUsers)
+		blocks.POST("", blockController.BlockUser)
+		blocks.DELETE("/:user_id", blockController.UnblockUser)
+	}
+
 	// 管理员路由
 	adminController := &controllers.AdminController{}
 	admin := api.Group("/admin")
@@ -106,9 +128,9 @@ func SetupRoutes(r *gin.Engine) {
 	// 碰撞列表管理（需要认证）
 	collisionListsAuth := api.Group("/collision-lists").Use(middlewares.JWTAuth())
 	{
-		collisionListsAuth.POST("", controllers.CreateCollisionList)
+		collisionListsAuth.POST("", idempotent, controllers.CreateCollisionList)
 		collisionListsAuth.GET("", controllers.GetCollisionLists)
-		collisionListsAuth.PUT("/:id", controllers.UpdateCollisionList)
+		collisionListsAuth.PUT("/:id", idempotent, controllers.UpdateCollisionList)
 		collisionListsAuth.DELETE("/:id", controllers.DeleteCollisionList)
 	}
 
@@ -119,7 +141,7 @@ func SetupRoutes(r *gin.Engine) {
 		collisionResultsAuth.GET("/:id/detail", controllers.GetCollisionResultDetail)
 		collisionResultsAuth.PUT("/:id/remark", controllers.UpdateMatchRemark)
 		collisionResultsAuth.POST("/:id/mark-known", controllers.MarkCollisionResultKnown)
-		collisionResultsAuth.POST("/send-email", controllers.SendEmailToMatch)
+		collisionResultsAuth.POST("/send-email", idempotent, controllers.SendEmailToMatch)
 		collisionResultsAuth.POST("/common-keywords", controllers.GetCommonKeywords) // 获取共同碰撞关键词
 	}
 
@@ -166,7 +188,14 @@ func SetupRoutes(r *gin.Engine) {
 		keywords.GET("", keywordController.GetKeywords)
 		keywords.POST("", keywordController.CreateKeyword)
 		keywords.PUT("/:id/status", keywordController.UpdateKeywordStatus)
+		keywords.PUT("/:id/match-window", keywordController.UpdateKeywordMatchWindow)
 		keywords.DELETE("/:id", keywordController.DeleteKeyword)
+		// 同义词与模糊匹配设置
+		keywords.GET("/synonyms", keywordController.GetSynonyms)
+		keywords.POST("/synonyms", keywordController.CreateSynonym)
+		keywords.DELETE("/synonyms/:id", keywordController.DeleteSynonym)
+		keywords.GET("/fuzzy-setting", keywordController.GetFuzzySetting)
+		keywords.PUT("/fuzzy-setting", keywordController.UpdateFuzzySetting)
 	}
 
 	// 违禁词管理路由
@@ -194,14 +223,35 @@ func SetupRoutes(r *gin.Engine) {
 		dashboard.GET("/user-trend", dashboardController.GetUserRegistrationTrend)
 		dashboard.GET("/success-rate", dashboardController.GetCollisionSuccessRate)
 		// 新增审核设置路由
-		dashboard.GET("/audit-setting", dashboardController.GetAuditSetting)    // 获取审核设置
-		dashboard.PUT("/audit-setting", dashboardController.UpdateAuditSetting) // 更新审核设置
-		dashboard.GET("/audit-stats", dashboardController.GetAuditStats)        // 获取审核统计数据
+		dashboard.GET("/audit-setting", dashboardController.GetAuditSetting)               // 获取审核设置
+		dashboard.PUT("/audit-setting", dashboardController.UpdateAuditSetting)            // 更新审核设置
+		dashboard.GET("/audit-stats", dashboardController.GetAuditStats)                   // 获取审核统计数据
+		dashboard.GET("/match-rules", dashboardController.GetMatchRules)                   // 获取匹配规则
+		dashboard.PUT("/match-rules", dashboardController.UpdateMatchRules)                // 更新匹配规则
+		dashboard.GET("/leader-status", dashboardController.GetLeaderStatus)               // 后台任务选主状态
+		dashboard.GET("/match-caps", dashboardController.GetMatchCaps)                     // 获取匹配上限设置
+		dashboard.PUT("/match-caps", dashboardController.UpdateMatchCaps)                  // 更新匹配上限设置
+		dashboard.GET("/match-modes", dashboardController.GetMatchModes)                   // 获取匹配模式
+		dashboard.PUT("/match-modes", dashboardController.UpdateMatchModes)                // 更新启用的匹配模式
+		dashboard.GET("/matcher-runs", dashboardController.GetMatcherRuns)                 // 匹配任务记录和图表数据
+		dashboard.POST("/matcher-runs", dashboardController.TriggerMatcherRun)             // 手动触发一次全量匹配
+		dashboard.POST("/match-simulate", dashboardController.SimulateMatch)               // 模拟匹配（不写入数据）
+		dashboard.GET("/jobs", dashboardController.GetJobs)                                // 后台任务执行计划和状态
+		dashboard.PUT("/jobs/:name", dashboardController.UpdateJob)                        // 修改后台任务的执行计划
+		dashboard.POST("/jobs/:name/pause", dashboardController.PauseJob)                  // 暂停后台任务
+		dashboard.POST("/jobs/:name/resume", dashboardController.ResumeJob)                // 恢复后台任务
+		dashboard.POST("/jobs/:name/trigger", dashboardController.TriggerJob)              // 立即执行一次后台任务
+		dashboard.GET("/retention", dashboardController.GetRetentionPolicies)              // 数据保留策略
+		dashboard.PUT("/retention", dashboardController.UpdateRetentionPolicy)             // 修改数据保留策略
+		dashboard.GET("/expiry-reminder", dashboardController.GetExpiryReminderSetting)    // 到期提醒和自动续期设置
+		dashboard.PUT("/expiry-reminder", dashboardController.UpdateExpiryReminderSetting) // 更新到期提醒设置
+		dashboard.GET("/wallet-discrepancies", dashboardController.GetWalletDiscrepancies) // 金币余额与流水不一致的用户
+		dashboard.GET("/wallet-ledger/:id", dashboardController.GetWalletLedger)           // 用户的金币流水
 	}
 
 	recharge := api.Group("/recharge").Use(middlewares.JWTAuth())
 	{
-		recharge.POST("/create", userController.CreateRechargeOrder)
+		recharge.POST("/create", idempotent, userController.CreateRechargeOrder)
 	}
 
 	// 健康检查
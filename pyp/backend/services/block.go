@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 用户拉黑：A 拉黑 B 时 friends 表中 (A, B) 的记录状态为 blocked。
+// 拉黑是双向生效的：任一方拉黑对方后，双方不再匹配、不能互相搜索到、不能加好友或发邮件，已有的碰撞结果双方都不再展示；
+// 取消拉黑只删除自己这一方的拉黑记录，之前解除的好友关系不会恢复。
+
+// FriendStatusBlocked 拉黑状态
+const FriendStatusBlocked = "blocked"
+
+// IsBlocked 判断两个用户之间是否存在拉黑关系（任一方向）
+func IsBlocked(userID1, userID2 uint) bool {
+	var count int64
+	config.DB.Model(&models.Friend{}).
+		Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+			userID1, userID2, userID2, userID1, FriendStatusBlocked).
+		Count(&count)
+	return count > 0
+}
+
+// BlockedUserIDs 与用户存在拉黑关系的所有用户（自己拉黑的和拉黑自己的）
+func BlockedUserIDs(userID uint) []uint {
+	var blocked, blockedBy []uint
+	config.DB.Model(&models.Friend{}).
+		Where("user_id = ? AND status = ?", userID, FriendStatusBlocked).
+		Pluck("friend_id", &blocked)
+	config.DB.Model(&models.Friend{}).
+		Where("friend_id = ? AND status = ?", userID, FriendStatusBlocked).
+		Pluck("user_id", &blockedBy)
+	return append(blocked, blockedBy...)
+}
+
+// ExcludeBlocked 查询条件：column（对方用户ID所在的列）不属于与用户存在拉黑关系的用户
+func ExcludeBlocked(userID uint, column string) func(*gorm.DB) *gorm.DB {
+	blocked := BlockedUserIDs(userID)
+	return func(db *gorm.DB) *gorm.DB {
+		if len(blocked) == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN ?", blocked)
+	}
+}
+
+// BlockUser 拉黑用户：自己一方的好友记录改为 blocked（没有则新建），并删除对方一方的好友记录
+func BlockUser(userID, targetID uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var friend models.Friend
+		err := tx.Where("user_id = ? AND friend_id = ?", userID, targetID).First(&friend).Error
+		switch {
+		case err == nil:
+			if err := tx.Model(&friend).Update("status", FriendStatusBlocked).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			friend = models.Friend{UserID: userID, FriendID: targetID, Status: FriendStatusBlocked}
+			if err := tx.Create(&friend).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		// 对方也拉黑了自己时保留对方的拉黑记录
+		return tx.Where("user_id = ? AND friend_id = ? AND status != ?", targetID, userID, FriendStatusBlocked).
+			Delete(&models.Friend{}).Error
+	})
+}
+
+// UnblockUser 取消拉黑，返回是否存在拉黑记录
+func UnblockUser(userID, targetID uint) (bool, error) {
+	result := config.DB.Where("user_id = ? AND friend_id = ? AND status = ?", userID, targetID, FriendStatusBlocked).
+		Delete(&models.Friend{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListBlockedUsers 用户拉黑的人（包含对方的基本信息）
+func ListBlockedUsers(userID uint) ([]models.Friend, error) {
+	var blocks []models.Friend
+	err := config.DB.Preload("Friend").
+		Where("user_id = ? AND status = ?", userID, FriendStatusBlocked).
+		Order("updated_at DESC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// isBlockedPair 双方是否存在拉黑关系（同一匹配过程中每个用户只查询一次）
+func (s *matchSession) isBlockedPair(userID1, userID2 uint) bool {
+	blocked, ok := s.blocked[userID1]
+	if !ok {
+		blocked = make(map[uint]bool)
+		for _, id := range BlockedUserIDs(userID1) {
+			blocked[id] = true
+		}
+		s.blocked[userID1] = blocked
+	}
+	return blocked[userID2]
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -10,51 +11,59 @@ import (
 
 type CleanupService struct{}
 
-// 开始定时清理任务
-func (cs *CleanupService) StartCleanupTasks() {
-	// 每10分钟清理一次过期碰撞码
-	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			cs.CleanupExpiredCodes()
-		}
-	}()
-
-	// 每30分钟检查一次过期的匹配记录
-	go func() {
-		ticker := time.NewTicker(30 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			cs.ProcessExpiredMatches()
-		}
-	}()
-
-	// 每日重置24小时热门标签计数（每天0点执行）
-	go func() {
-		// 计算下一次执行时间（当天0点）
-		now := time.Now()
-		nextReset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		duration := nextReset.Sub(now)
-		
-		// 初始延迟
-		time.Sleep(duration)
-		
-		// 执行第一次重置
-		cs.ResetHotTags24h()
-		
-		// 之后每天执行一次
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-		
-		for range ticker.C {
-			cs.ResetHotTags24h()
-		}
-	}()
-
-	log.Println("Cleanup service started")
+// RegisterJobs 将清理任务注册到后台任务调度器（执行计划可在管理后台修改）
+func (cs *CleanupService) RegisterJobs(scheduler *Scheduler) {
+	scheduler.Register(JobSpec{
+		Name:        JobCleanupCodes,
+		Description: "将过期的碰撞码和碰撞列表标记为已过期",
+		DefaultCron: "*/10 * * * *",
+		Run:         func(context.Context, bool) { cs.CleanupExpiredCodes() },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobExpiredMatches,
+		Description: "处理超过加好友期限的匹配（双方允许被动添加时自动加好友，否则标记为错过）",
+		DefaultCron: "*/30 * * * *",
+		Run:         func(ctx context.Context, _ bool) { cs.ProcessExpiredMatches(ctx) },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobExpiryReminder,
+		Description: "为开启自动续期的碰撞码和碰撞列表续期，并为即将到期的发送提醒（站内通知和邮件）",
+		DefaultCron: "*/5 * * * *",
+		Run:         func(ctx context.Context, _ bool) { SendExpiryReminders(ctx) },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobWalletReconcile,
+		Description: "金币对账：标记余额与流水合计不一致的用户",
+		DefaultCron: "0 4 * * *",
+		Run:         func(context.Context, bool) { cs.ReconcileWallets() },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobIdempotencyKeys,
+		Description: "清理过期的扣费接口幂等键（Redis 存储时自动过期）",
+		DefaultCron: "15 * * * *",
+		Run:         func(context.Context, bool) { cs.PruneIdempotencyKeys() },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobMatchScores,
+		Description: "刷新碰撞结果的匹配得分（匹配时间和对方活跃度随时间变化）",
+		DefaultCron: "40 * * * *",
+		Run:         func(ctx context.Context, _ bool) { cs.RescoreMatches(ctx) },
+	})
+	scheduler.Register(JobSpec{
+		Name:        JobHotTags24h,
+		Description: "刷新24小时热门标签快照（hot_tags.count_24h）并清理滑出窗口的小时桶",
+		DefaultCron: "*/10 * * * *",
+		Run:         func(context.Context, bool) { RefreshHotTags24h() },
+	})
+	for _, table := range retentionTables {
+		name := table.name
+		scheduler.Register(JobSpec{
+			Name:        JobRetention + name,
+			Description: "按保留策略归档 " + name + " 中超过保留期的数据",
+			DefaultCron: table.defaultCron,
+			Run:         func(ctx context.Context, _ bool) { cs.ArchiveExpired(ctx, name) },
+		})
+	}
 }
 
 // 清理过期的碰撞码和碰撞列表
@@ -90,8 +99,8 @@ func (cs *CleanupService) CleanupExpiredCodes() {
 	}
 }
 
-// 处理过期的匹配记录
-func (cs *CleanupService) ProcessExpiredMatches() {
+// 处理过期的匹配记录，ctx 取消（服务关闭）后处理完当前这条即停止，剩下的留到下一次
+func (cs *CleanupService) ProcessExpiredMatches(ctx context.Context) {
 	now := time.Now()
 
 	// 查找已过期但状态仍为matched的记录
@@ -113,6 +122,9 @@ func (cs *CleanupService) ProcessExpiredMatches() {
 	log.Printf("Processing %d expired matches", len(expiredRecords))
 
 	for _, record := range expiredRecords {
+		if ctx.Err() != nil {
+			return
+		}
 		cs.processExpiredMatch(record)
 	}
 }
@@ -123,8 +135,8 @@ func (cs *CleanupService) processExpiredMatch(record models.CollisionRecord) {
 	user1AllowsPassive := record.User1.AllowPassiveAdd
 	user2AllowsPassive := record.User2.AllowPassiveAdd
 
-	// 如果双方都允许被动添加，自动添加为好友
-	if user1AllowsPassive && user2AllowsPassive {
+	// 如果双方都允许被动添加，自动添加为好友（任一方拉黑了对方时不添加）
+	if user1AllowsPassive && user2AllowsPassive && !IsBlocked(record.UserID1, record.UserID2) {
 		cs.autoAddFriends(record)
 	} else {
 		// 否则标记为错过
@@ -200,23 +212,44 @@ func (cs *CleanupService) markAsMissed(record models.CollisionRecord) {
 		record.ID, record.UserID1, record.UserID2)
 }
 
-// 重置24小时热门标签计数
-func (cs *CleanupService) ResetHotTags24h() {
-	log.Println("开始重置24小时热门标签计数...")
-	
-	result := config.DB.Model(&models.HotTag{}).Update("count_24h", 0)
-	if result.Error != nil {
-		log.Printf("重置24小时热门标签计数失败: %v", result.Error)
+// ArchiveExpired 归档一张表中超过保留期的数据
+func (cs *CleanupService) ArchiveExpired(ctx context.Context, table string) {
+	if _, err := ArchiveExpired(ctx, table); err != nil {
+		log.Printf("归档 %s 失败: %v", table, err)
+	}
+}
+
+// ReconcileWallets 金币余额与流水对账
+func (cs *CleanupService) ReconcileWallets() {
+	flagged, err := ReconcileWallets()
+	if err != nil {
+		log.Printf("金币对账失败: %v", err)
+		return
+	}
+	log.Printf("金币对账完成，%d 个用户余额与流水不一致", flagged)
+}
+
+// PruneIdempotencyKeys 清理过期的幂等键
+func (cs *CleanupService) PruneIdempotencyKeys() {
+	if err := PruneIdempotencyKeys(); err != nil {
+		log.Printf("清理幂等键失败: %v", err)
+	}
+}
+
+// RescoreMatches 刷新碰撞结果的匹配得分
+func (cs *CleanupService) RescoreMatches(ctx context.Context) {
+	users, err := RescoreMatches(ctx)
+	if err != nil {
+		log.Printf("刷新匹配得分失败（已处理 %d 个用户）: %v", users, err)
 		return
 	}
-	
-	log.Printf("成功重置 %d 个热门标签的24小时计数", result.RowsAffected)
+	log.Printf("刷新匹配得分完成，%d 个用户", users)
 }
 
 // 手动触发清理（用于测试或立即清理）
 func (cs *CleanupService) ManualCleanup() {
 	log.Println("Starting manual cleanup...")
 	cs.CleanupExpiredCodes()
-	cs.ProcessExpiredMatches()
+	cs.ProcessExpiredMatches(context.Background())
 	log.Println("Manual cleanup completed")
 }
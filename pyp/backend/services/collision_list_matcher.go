@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// 碰撞列表（V3）作为匹配来源：
+// 列表被转换成一个没有地区、性别、年龄筛选条件的碰撞码参与匹配（使用列表的匹配模式，按距离匹配时以发布者默认地址为发布位置），
+// 与其他列表、碰撞码使用同一套规则链和去重逻辑，产生的碰撞结果记录对应的列表ID。
+
+// isListMatchable 碰撞列表是否处于可匹配状态（启用且未过期）
+func isListMatchable(list *models.CollisionList) bool {
+	return list.KeywordCanonical != "" && list.Status == "active" && list.ExpireAt.After(time.Now())
+}
+
+// listCode 将碰撞列表转换成参与匹配的碰撞码，并在本次匹配过程中记录其来源列表
+func (s *matchSession) listCode(list *models.CollisionList) *models.CollisionCode {
+	code := &models.CollisionCode{
+		UserID:       uint(list.UserID),
+		Tag:          list.Keyword,
+		TagCanonical: list.KeywordCanonical,
+		Status:       "active",
+		AuditStatus:  "approved",
+		ExpiresAt:    list.ExpireAt,
+		MatchMode:    list.MatchMode,
+		RadiusKm:     list.RadiusKm,
+	}
+	code.CreatedAt = list.CreatedAt
+	if list.RadiusKm > 0 || !matchStrategy(list.MatchMode).ChecksRegion() {
+		code.Latitude, code.Longitude = s.defaultCoordinates(code.UserID)
+	}
+	s.lists[code] = list.ID
+	return code
+}
+
+// defaultCoordinates 用户默认地址的坐标，没有时为 nil
+func (s *matchSession) defaultCoordinates(userID uint) (*float64, *float64) {
+	for _, location := range s.userLocations(userID) {
+		if location.IsDefault && location.Latitude != nil && location.Longitude != nil {
+			return location.Latitude, location.Longitude
+		}
+	}
+	return nil, nil
+}
+
+// listID 碰撞码对应的来源列表ID，普通碰撞码返回 0
+func (s *matchSession) listID(code *models.CollisionCode) uint64 {
+	return s.lists[code]
+}
+
+// describeSource 日志中的匹配来源描述
+func describeSource(code *models.CollisionCode, listID uint64) string {
+	if listID != 0 {
+		return fmt.Sprintf("碰撞列表#%d", listID)
+	}
+	return fmt.Sprintf("碰撞码#%d", code.ID)
+}
+
+// MatchForList 立即为指定碰撞列表执行匹配（创建、续期、重新启用时调用），source 为匹配任务来源（见 MatcherRunSource*）
+func (cm *CollisionMatcher) MatchForList(list *models.CollisionList, source string) int {
+	startTime := time.Now()
+	session := newMatchSession()
+	matchCount := cm.matchForListWith(list, session)
+	saveMatcherRun(source, startTime, session.stats(MatchRunStats{Mode: "list", ListsScanned: 1, MatchesCreated: matchCount}, startTime), session)
+	return matchCount
+}
+
+// matchForListWith 在同一匹配过程中为碰撞列表寻找匹配
+func (cm *CollisionMatcher) matchForListWith(list *models.CollisionList, session *matchSession) int {
+	if list == nil || !isListMatchable(list) {
+		return 0
+	}
+	return cm.findAllMatchesWith(session.listCode(list), session)
+}
+
+// activeLists 查询指定标签下可匹配的碰撞列表（排除某用户自己的）
+func activeLists(tag string, excludeUserID uint) []models.CollisionList {
+	var lists []models.CollisionList
+	config.DB.Where("keyword_canonical = ? AND status = ? AND expire_at > ? AND user_id != ?",
+		tag, "active", time.Now(), uint64(excludeUserID)).
+		Find(&lists)
+	return lists
+}
+
+// listCandidates 在指定标签下为匹配来源查找候选碰撞列表（排除已匹配的用户）
+func (s *matchSession) listCandidates(source *models.CollisionCode, tag string, partners map[uint]bool) []*models.CollisionCode {
+	lists := activeLists(tag, source.UserID)
+
+	var candidates []*models.CollisionCode
+	for i := range lists {
+		if partners[uint(lists[i].UserID)] {
+			continue
+		}
+		candidates = append(candidates, s.listCode(&lists[i]))
+	}
+	return candidates
+}
+
+// changedLists 增量匹配：since 之后新建或修改（续期、重新启用）的碰撞列表
+func (cm *CollisionMatcher) changedLists(since time.Time) []models.CollisionList {
+	var lists []models.CollisionList
+	if err := config.DB.
+		Where("updated_at >= ? AND status = ? AND expire_at > ?", since, "active", time.Now()).
+		Find(&lists).Error; err != nil {
+		log.Printf("获取变动碰撞列表失败: %v", err)
+	}
+	return lists
+}
@@ -3,32 +3,224 @@ package services
 import (
 	"collision-backend/config"
 	"collision-backend/models"
+	"collision-backend/tagnorm"
+	"context"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// reconcileEvery 每执行多少次定期任务做一次全量对账
+const reconcileEvery = 12
+
 // CollisionMatcher 碰撞匹配服务
-type CollisionMatcher struct{}
+type CollisionMatcher struct {
+	index     TagIndex
+	lastRunAt time.Time // 上一次定期任务开始时间，用于增量扫描
+	runCount  int
+}
+
+// MatchRunStats 单次匹配任务统计
+type MatchRunStats struct {
+	Mode           string // incremental, full
+	CodesScanned   int
+	ListsScanned   int
+	PairsEvaluated int // 进入匹配判断的候选对数
+	MatchesCreated int
+	Errors         int
+	Elapsed        time.Duration
+
+	// 匹配上限（见 MatchCapSetting）
+	PerCodeCap     int
+	PerTagCap      int
+	Strategy       string
+	Deferred       int   // 本轮超过上限推迟到待匹配队列的匹配
+	BacklogMatched int   // 本轮从待匹配队列补上的匹配（已计入 MatchesCreated）
+	BacklogPending int64 // 本轮结束时待匹配队列中的数量
+}
+
+// matchSession 一次匹配过程中共享的配置（规则链、标签关联关系），避免逐对重复加载
+type matchSession struct {
+	ctx context.Context // 取消后不再判断新的候选对（服务关闭）
+
+	pipeline  *MatchPipeline
+	relations *TagRelations
+	lists     map[*models.CollisionCode]uint64 // 由碰撞列表转换来的碰撞码 -> 列表ID
+
+	historical map[string]bool // 开启历史匹配模式的标签，不检查有效期重叠
+	caps       *matchCaps      // 单个碰撞码、单个标签的匹配上限及本次已新增的匹配数
+
+	locations map[uint][]models.UserLocation // 本次匹配中已加载的用户已保存地址
+	blocked   map[uint]map[uint]bool         // 本次匹配中已加载的用户拉黑关系
+
+	// 本次匹配的统计（写入 matcher_runs）
+	pairsEvaluated int
+	errors         int
+	lastError      string
+
+	// 模拟匹配时不为 nil：只记录每个候选的判断结果，不写入任何数据
+	simulation *MatchSimulation
+	// 补算匹配时不为 nil：已匹配过的用户对也重新判断，记录会产生的匹配和未通过的原因，不写入任何数据
+	replay *rematchReplay
+}
+
+// newMatchSession 加载当前部署的匹配规则链和同义词/模糊匹配设置
+func newMatchSession() *matchSession {
+	return &matchSession{
+		ctx:       context.Background(),
+		pipeline:  LoadMatchPipeline(),
+		relations: LoadTagRelations(),
+		lists:     make(map[*models.CollisionCode]uint64),
+
+		historical: LoadHistoricalTags(),
+		caps:       newMatchCaps(),
+
+		locations: make(map[uint][]models.UserLocation),
+		blocked:   make(map[uint]map[uint]bool),
+	}
+}
+
+// userLocations 用户已保存的地址（同一匹配过程中只查询一次）
+func (s *matchSession) userLocations(userID uint) []models.UserLocation {
+	if locations, ok := s.locations[userID]; ok {
+		return locations
+	}
+	var locations []models.UserLocation
+	if err := config.DB.Where("user_id = ?", userID).Order("is_default DESC, id ASC").Find(&locations).Error; err != nil {
+		log.Printf("读取用户User%d的地址失败: %v", userID, err)
+	}
+	s.locations[userID] = locations
+	return locations
+}
 
-// NewCollisionMatcher 创建碰撞匹配服务实例
+// NewCollisionMatcher 创建碰撞匹配服务实例（共享同一个倒排索引）
 func NewCollisionMatcher() *CollisionMatcher {
-	return &CollisionMatcher{}
+	return &CollisionMatcher{index: matchIndex()}
 }
 
-// MatchForCode 立即为指定碰撞码执行匹配
-func (cm *CollisionMatcher) MatchForCode(code *models.CollisionCode) int {
+// MatchForCode 立即为指定碰撞码执行匹配（新提交、续期、重新提交时调用），source 为匹配任务来源（见 MatcherRunSource*）
+func (cm *CollisionMatcher) MatchForCode(code *models.CollisionCode, source string) int {
+	startTime := time.Now()
+	session := newMatchSession()
+	matchCount := cm.matchForCodeWith(code, session)
+	saveMatcherRun(source, startTime, session.stats(MatchRunStats{Mode: "code", CodesScanned: 1, MatchesCreated: matchCount}, startTime), session)
+	return matchCount
+}
+
+// matchForCodeWith 更新碰撞码的倒排索引并在同一匹配过程中为其寻找匹配
+func (cm *CollisionMatcher) matchForCodeWith(code *models.CollisionCode, session *matchSession) int {
 	if code == nil {
 		return 0
 	}
-	return cm.findAllMatches(code)
+	if !isIndexable(code) {
+		cm.RemoveCode(code.CanonicalTags(), code.ID)
+		return 0
+	}
+	for _, tag := range code.CanonicalTags() {
+		if err := cm.index.Add(tag, code.ID, code.UserID); err != nil {
+			log.Printf("更新碰撞码#%d索引失败: %v", code.ID, err)
+			session.recordError(err)
+		}
+	}
+	return cm.findAllMatchesWith(code, session)
+}
+
+// RemoveCode 将碰撞码从这些标签下移出倒排索引（修改标签或删除时调用）
+func (cm *CollisionMatcher) RemoveCode(tags []string, codeID uint) {
+	for _, tag := range tags {
+		if err := cm.index.Remove(tag, codeID); err != nil {
+			log.Printf("移除碰撞码#%d索引失败: %v", codeID, err)
+		}
+	}
 }
 
-// RunMatcher 运行匹配逻辑（定期调用）
-func (cm *CollisionMatcher) RunMatcher() {
-	log.Println("========== 开始碰撞匹配任务 ==========")
+// runMatcher 执行一轮匹配并写入匹配任务记录，调用方需持有 matcherRunMu（同一实例上定期匹配与手动触发的匹配不并发执行）
+// 平时只处理上次运行以来有变动的碰撞码，每 reconcileEvery 次做一次全量对账；ctx 取消后处理完当前这一对即停止
+func (cm *CollisionMatcher) runMatcher(ctx context.Context, source string) MatchRunStats {
+	matcherActive.Store(true)
+	defer matcherActive.Store(false)
+
 	startTime := time.Now()
+	cm.runCount++
+
+	// 整轮共用一个匹配过程，单个标签的上限按整轮计算；先处理之前推迟的匹配
+	session := newMatchSession()
+	session.ctx = ctx
+	backlogMatched := cm.drainBacklog(session)
+
+	var stats MatchRunStats
+	if cm.lastRunAt.IsZero() || cm.runCount%reconcileEvery == 0 {
+		stats = cm.reconcile(session)
+	} else {
+		stats = cm.runIncremental(cm.lastRunAt, session)
+	}
+	cm.lastRunAt = startTime
+
+	stats.MatchesCreated += backlogMatched
+	stats.BacklogMatched = backlogMatched
+	stats.PerCodeCap = session.caps.setting.PerCode
+	stats.PerTagCap = session.caps.setting.PerTag
+	stats.Strategy = session.caps.setting.Strategy
+	stats.Deferred = session.caps.deferred
+	stats.BacklogPending = BacklogSize()
+
+	stats = session.stats(stats, startTime)
+	saveMatcherRun(source, startTime, stats, session)
+	if session.stopped() {
+		log.Printf("碰撞匹配任务因服务关闭提前结束(%s)", stats.Mode)
+	}
+	log.Printf("碰撞匹配任务完成(%s) - 总耗时: %v, 新增匹配: %d, 扫描碰撞码: %d, 扫描碰撞列表: %d",
+		stats.Mode, stats.Elapsed, stats.MatchesCreated, stats.CodesScanned, stats.ListsScanned)
+	if session.caps.setting.Enabled() || stats.BacklogPending > 0 {
+		log.Printf("匹配上限 - 每个碰撞码: %d, 每个标签: %d, 策略: %s, 推迟: %d, 队列补匹配: %d, 队列剩余: %d",
+			stats.PerCodeCap, stats.PerTagCap, stats.Strategy, stats.Deferred, stats.BacklogMatched, stats.BacklogPending)
+	}
+	return stats
+}
+
+// runIncremental 增量匹配：只处理 since 之后新增、修改或删除的碰撞码和碰撞列表
+// 这里兜底所有不经过 MatchForCode 的写入（管理后台修改、其他实例提交等）
+func (cm *CollisionMatcher) runIncremental(since time.Time, session *matchSession) MatchRunStats {
+	stats := MatchRunStats{Mode: "incremental"}
+
+	// 留出少量重叠，避免与上一轮边界上的写入漏掉
+	since = since.Add(-time.Minute)
+
+	var changedCodes []models.CollisionCode
+	if err := config.DB.Unscoped().
+		Where("updated_at >= ? OR deleted_at >= ?", since, since).
+		Find(&changedCodes).Error; err != nil {
+		log.Printf("获取变动碰撞码失败: %v", err)
+		session.recordError(err)
+		return stats
+	}
+
+	for i := range changedCodes {
+		if session.stopped() {
+			break
+		}
+		stats.CodesScanned++
+		stats.MatchesCreated += cm.matchForCodeWith(&changedCodes[i], session)
+	}
+
+	changedLists := cm.changedLists(since)
+	for i := range changedLists {
+		if session.stopped() {
+			break
+		}
+		stats.ListsScanned++
+		stats.MatchesCreated += cm.matchForListWith(&changedLists[i], session)
+	}
+	return stats
+}
+
+// reconcile 全量对账：重建倒排索引，并按标签分组补齐遗漏的匹配
+func (cm *CollisionMatcher) reconcile(session *matchSession) MatchRunStats {
+	stats := MatchRunStats{Mode: "full"}
 
 	// 清理无效的碰撞码(用户不存在的)
 	cm.cleanInvalidCodes()
@@ -40,27 +232,147 @@ func (cm *CollisionMatcher) RunMatcher() {
 		Preload("User").
 		Find(&activeCodes).Error; err != nil {
 		log.Printf("获取活跃碰撞码失败: %v", err)
-		return
+		session.recordError(err)
+		return stats
 	}
+	stats.CodesScanned = len(activeCodes)
 
-	log.Printf("找到 %d 个活跃的碰撞码", len(activeCodes))
+	if err := cm.index.Rebuild(activeCodes); err != nil {
+		log.Printf("重建碰撞码索引失败: %v", err)
+		session.recordError(err)
+	}
 
-	matchCount := 0
-	for _, code := range activeCodes {
-		// 跳过用户数据未加载的碰撞码
-		if code.User.ID == 0 {
-			log.Printf("⚠️ 碰撞码#%d的用户数据未加载,跳过", code.ID)
+	// 按标签分组，组合碰撞码出现在它的每个标签分组中
+	groups := make(map[string][]*models.CollisionCode)
+	for i := range activeCodes {
+		if !isIndexable(&activeCodes[i]) {
 			continue
 		}
+		for _, tag := range activeCodes[i].CanonicalTags() {
+			groups[tag] = append(groups[tag], &activeCodes[i])
+		}
+	}
 
-		// 为每个碰撞码寻找所有可能的匹配（多对多）
-		matches := cm.findAllMatches(&code)
-		matchCount += matches
+	// 启用中的碰撞列表与碰撞码一起按标签分组
+	var activeLists []models.CollisionList
+	if err := config.DB.
+		Where("status = ? AND expire_at > ?", "active", time.Now()).
+		Find(&activeLists).Error; err != nil {
+		log.Printf("获取活跃碰撞列表失败: %v", err)
+		session.recordError(err)
+	}
+	stats.ListsScanned = len(activeLists)
+	for i := range activeLists {
+		if isListMatchable(&activeLists[i]) {
+			code := session.listCode(&activeLists[i])
+			groups[code.TagCanonical] = append(groups[code.TagCanonical], code)
+		}
 	}
 
-	elapsed := time.Since(startTime)
-	log.Printf("========== 碰撞匹配任务完成 ==========")
-	log.Printf("总耗时: %v, 新增匹配: %d, 活跃碰撞码: %d", elapsed, matchCount, len(activeCodes))
+	tags := make([]string, 0, len(groups))
+	for tag, codes := range groups {
+		tags = append(tags, tag)
+		if len(codes) < 2 || session.stopped() {
+			continue
+		}
+		stats.MatchesCreated += cm.matchGroup(tag, codes, session)
+	}
+
+	// 同义词/模糊匹配：相关标签的分组之间交叉匹配（每对标签只处理一次）
+	for _, tag := range tags {
+		if session.stopped() {
+			break
+		}
+		for _, related := range session.relations.Related(tag, tags) {
+			if tag < related {
+				stats.MatchesCreated += cm.matchCrossGroups(groups[tag], groups[related], session)
+			}
+		}
+	}
+	return stats
+}
+
+// matchGroup 在同一标签的碰撞码之间两两匹配，已存在的用户对只查询一次
+func (cm *CollisionMatcher) matchGroup(tag string, codes []*models.CollisionCode, session *matchSession) int {
+	var pairs []struct {
+		UserID        uint64
+		MatchedUserID uint64
+	}
+	config.DB.Model(&models.CollisionResult{}).
+		Select("user_id, matched_user_id").
+		Where("keyword_canonical = ?", tag).
+		Scan(&pairs)
+
+	matched := make(map[[2]uint]bool, len(pairs))
+	for _, p := range pairs {
+		matched[userPair(uint(p.UserID), uint(p.MatchedUserID))] = true
+	}
+
+	// 设置了匹配上限时，每个碰撞码的候选按采样策略排序（最近发布的碰撞码优先作为发起方）
+	if session.caps.setting.Enabled() {
+		sort.SliceStable(codes, func(i, j int) bool {
+			return codes[i].CreatedAt.After(codes[j].CreatedAt)
+		})
+	}
+
+	matchCount := 0
+	for i := 0; i < len(codes); i++ {
+		candidates := codes[i+1:]
+		if session.caps.setting.Enabled() {
+			candidates = append([]*models.CollisionCode{}, candidates...)
+			session.rankCandidates(codes[i], candidates)
+		}
+		for _, candidate := range candidates {
+			if codes[i].UserID == candidate.UserID {
+				continue
+			}
+			key := userPair(codes[i].UserID, candidate.UserID)
+			if matched[key] {
+				continue
+			}
+			// 同一用户对可能有多个碰撞码，规则不通过时继续尝试其他组合
+			if cm.createMatchIfNotExists(codes[i], candidate, session) {
+				matchCount++
+				matched[key] = true
+			}
+		}
+	}
+	return matchCount
+}
+
+// matchCrossGroups 在两个相关标签（同义词或模糊相近）的碰撞码之间两两匹配
+func (cm *CollisionMatcher) matchCrossGroups(codes1, codes2 []*models.CollisionCode, session *matchSession) int {
+	matched := make(map[[2]uint]bool)
+	matchCount := 0
+	for _, code1 := range codes1 {
+		candidates := codes2
+		if session.caps.setting.Enabled() {
+			candidates = append([]*models.CollisionCode{}, codes2...)
+			session.rankCandidates(code1, candidates)
+		}
+		for _, code2 := range candidates {
+			if code1.UserID == code2.UserID {
+				continue
+			}
+			key := userPair(code1.UserID, code2.UserID)
+			if matched[key] {
+				continue
+			}
+			if cm.createMatchIfNotExists(code1, code2, session) {
+				matchCount++
+				matched[key] = true
+			}
+		}
+	}
+	return matchCount
+}
+
+// userPair 生成与顺序无关的用户对
+func userPair(a, b uint) [2]uint {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint{a, b}
 }
 
 // cleanInvalidCodes 清理无效的碰撞码(用户不存在的)
@@ -82,47 +394,320 @@ func (cm *CollisionMatcher) cleanInvalidCodes() {
 	}
 }
 
-// findAllMatches 为指定的碰撞码寻找所有可能的匹配（多对多）- 简化版：仅关键词相同即可匹配
+// matchedPartners 获取用户在这些标签（规范形式）下已经匹配过的对方用户
+func (cm *CollisionMatcher) matchedPartners(userID uint, tags []string) map[uint]bool {
+	var partnerIDs []uint64
+	config.DB.Model(&models.CollisionResult{}).
+		Where("user_id = ? AND keyword_canonical IN ?", uint64(userID), tags).
+		Pluck("matched_user_id", &partnerIDs)
+
+	var reverseIDs []uint64
+	config.DB.Model(&models.CollisionResult{}).
+		Where("matched_user_id = ? AND keyword_canonical IN ?", uint64(userID), tags).
+		Pluck("user_id", &reverseIDs)
+
+	partners := make(map[uint]bool, len(partnerIDs)+len(reverseIDs))
+	for _, id := range partnerIDs {
+		partners[uint(id)] = true
+	}
+	for _, id := range reverseIDs {
+		partners[uint(id)] = true
+	}
+	return partners
+}
+
+// findAllMatches 为指定的碰撞码寻找所有可能的匹配（多对多）
+// 候选碰撞码来自倒排索引（本标签及其同义/模糊相近的标签），
+// 已匹配过的用户对通过一次查询整体排除，再经过匹配规则链过滤
 func (cm *CollisionMatcher) findAllMatches(collisionCode *models.CollisionCode) int {
+	return cm.findAllMatchesWith(collisionCode, newMatchSession())
+}
+
+// findAllMatchesWith 使用已加载的匹配配置为碰撞码（或由碰撞列表转换的碰撞码）寻找碰撞码和碰撞列表中的匹配
+func (cm *CollisionMatcher) findAllMatchesWith(collisionCode *models.CollisionCode, session *matchSession) int {
+	ownTags := collisionCode.CanonicalTags()
+	tags := append(ownTags, cm.relatedTags(collisionCode, session.relations)...)
+
+	// 补算匹配时已匹配过的用户也重新判断
+	partners := make(map[uint]bool)
+	if session.replay == nil {
+		partners = cm.matchedPartners(collisionCode.UserID, tags)
+	}
+
+	// 碰撞码和碰撞列表一起排序：标签重合多的优先，设置了匹配上限时再按采样策略
+	candidates := cm.codeCandidates(collisionCode, tags, partners)
+	for _, tag := range tags {
+		candidates = append(candidates, session.listCandidates(collisionCode, tag, partners)...)
+	}
+	session.rankCandidates(collisionCode, candidates)
+
+	// 为每个匹配创建记录（同一用户的多个碰撞码/列表只匹配一次）
 	matchCount := 0
+	for _, candidate := range candidates {
+		if partners[candidate.UserID] {
+			continue
+		}
+		if cm.createMatchIfNotExists(collisionCode, candidate, session) {
+			matchCount++
+			partners[candidate.UserID] = true
+		}
+	}
+	return matchCount
+}
 
-	// 构建简化查询：仅相同关键词、活跃或过期状态、不是自己
-	baseQuery := config.DB.Model(&models.CollisionCode{}).
-		Where("collision_codes.tag = ? AND collision_codes.user_id != ?",
-			collisionCode.Tag, collisionCode.UserID)
+// relatedTags 与碰撞码的标签同义或模糊相近的其他标签（不含这些标签本身），只考虑碰撞码的匹配模式接受的关联类型
+// 模糊匹配需要遍历倒排索引中的所有标签，不接受模糊相近时只查同义词表
+func (cm *CollisionMatcher) relatedTags(code *models.CollisionCode, relations *TagRelations) []string {
+	tags := code.CanonicalTags()
+	types := make(map[string]bool)
+	for _, t := range matchStrategy(code.MatchMode).MatchTypes(relations) {
+		types[t] = true
+	}
+	if !types[MatchTypeSynonym] && !types[MatchTypeFuzzy] {
+		return nil
+	}
 
-	// 查找所有符合条件的碰撞码（多对多）
+	var candidates []string
+	if types[MatchTypeFuzzy] {
+		indexed, err := cm.index.Tags()
+		if err != nil {
+			log.Printf("读取碰撞码索引标签失败: %v", err)
+		}
+		candidates = indexed
+	}
+
+	own := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		own[tag] = true
+	}
+	seen := make(map[string]bool)
+	var related []string
+	for _, tag := range tags {
+		found := relations.Synonyms(tag)
+		if candidates != nil {
+			found = relations.relatedIn(tag, candidates, types)
+		}
+		for _, r := range found {
+			if !own[r] && !seen[r] {
+				seen[r] = true
+				related = append(related, r)
+			}
+		}
+	}
+	return related
+}
+
+// codeCandidates 在这些标签下查找候选碰撞码（排除自己和已匹配的用户）
+func (cm *CollisionMatcher) codeCandidates(collisionCode *models.CollisionCode, tags []string, partners map[uint]bool) []*models.CollisionCode {
+	seen := make(map[uint]bool)
+	var candidateIDs []uint
+	for _, tag := range tags {
+		entries, err := cm.index.Lookup(tag)
+		if err != nil {
+			log.Printf("查询碰撞码索引失败(%s): %v", tag, err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.UserID == collisionCode.UserID || partners[entry.UserID] || seen[entry.CodeID] {
+				continue
+			}
+			seen[entry.CodeID] = true
+			candidateIDs = append(candidateIDs, entry.CodeID)
+		}
+	}
+	if len(candidateIDs) == 0 {
+		return nil
+	}
+
+	// 重新从数据库加载候选碰撞码，索引中残留的已删除/已修改条目会在标签重合检查时被过滤
 	var matchedCodes []models.CollisionCode
-	baseQuery.Preload("User").Find(&matchedCodes)
+	config.DB.Where("id IN ? AND user_id != ?", candidateIDs, collisionCode.UserID).
+		Preload("User").
+		Find(&matchedCodes)
 
-	// 为每个匹配创建记录（跳过已存在的匹配）
-	for _, matchedCode := range matchedCodes {
-		if cm.createMatchIfNotExists(collisionCode, &matchedCode) {
-			matchCount++
+	candidates := make([]*models.CollisionCode, len(matchedCodes))
+	for i := range matchedCodes {
+		candidates[i] = &matchedCodes[i]
+	}
+	return candidates
+}
+
+// createMatchIfNotExists 检查匹配是否已存在，不存在且通过所有匹配规则则创建
+// 双方标签相同为 keyword 匹配，通过同义词表或编辑距离关联时分别为 synonym、fuzzy 匹配；
+// 组合碰撞码需要重合的标签数同时达到双方要求的数量
+func (cm *CollisionMatcher) createMatchIfNotExists(code1, code2 *models.CollisionCode, session *matchSession) bool {
+	if session.stopped() {
+		return false
+	}
+	session.pairsEvaluated++
+
+	// 只按双方匹配模式都接受的标签关联类型计算重合
+	overlap := session.overlap(code1, code2)
+	if overlap.Count() == 0 || overlap.Count() < code1.RequiredOverlap() || overlap.Count() < code2.RequiredOverlap() {
+		session.observe(code1, code2, overlap, SimulateReasonOverlap, nil)
+		return false
+	}
+
+	// 待审核、审核拒绝的碰撞码不匹配；有效期不重叠的不匹配（历史模式的标签除外）
+	if !isAuditApproved(code1) || !isAuditApproved(code2) {
+		session.observe(code1, code2, overlap, SimulateReasonAudit, nil)
+		return false
+	}
+	if !session.inMatchWindow(code1, code2, overlap) {
+		session.observe(code1, code2, overlap, SimulateReasonWindow, nil)
+		return false
+	}
+
+	// 任一方拉黑了对方时不匹配（不受匹配规则配置影响）
+	if session.isBlockedPair(code1.UserID, code2.UserID) {
+		session.observe(code1, code2, overlap, SimulateReasonBlocked, nil)
+		return false
+	}
+
+	// 设置了距离范围的碰撞码，对方必须在范围内
+	distance := codeDistance(code1, code2)
+	if !withinRadius(code1, code2, distance) {
+		session.observe(code1, code2, overlap, SimulateReasonDistance, nil)
+		return false
+	}
+
+	// 双方匹配模式的额外要求（如按距离匹配模式双方都必须有坐标）
+	if !modesAccept(code1, code2, distance) {
+		session.observe(code1, code2, overlap, SimulateReasonMode, nil)
+		return false
+	}
+
+	// 检查是否已存在匹配结果（双向检查，双方各自的关键词都算）；补算匹配时已有的匹配也重新判断
+	if session.replay == nil {
+		tags := append(code1.CanonicalTags(), code2.CanonicalTags()...)
+		var existingCount int64
+		config.DB.Model(&models.CollisionResult{}).
+			Where("(user_id = ? AND matched_user_id = ? AND keyword_canonical IN ?) OR (user_id = ? AND matched_user_id = ? AND keyword_canonical IN ?)",
+				uint64(code1.UserID), uint64(code2.UserID), tags,
+				uint64(code2.UserID), uint64(code1.UserID), tags).
+			Count(&existingCount)
+
+		if existingCount > 0 {
+			session.observe(code1, code2, overlap, SimulateReasonAlreadyMatched, nil)
+			return false // 已存在匹配，跳过
 		}
 	}
 
-	return matchCount
+	if !loadCodeUser(code1) || !loadCodeUser(code2) {
+		session.observe(code1, code2, overlap, SimulateReasonUserMissing, nil)
+		return false
+	}
+
+	// 依次执行匹配规则（关键词、性别、年龄、地区、可见性、黑名单等）
+	ctx := &MatchContext{
+		Code1:      code1,
+		Code2:      code2,
+		User1:      &code1.User,
+		User2:      &code2.User,
+		MatchType:  overlap.MatchType,
+		Locations1: session.userLocations(code1.UserID),
+		Locations2: session.userLocations(code2.UserID),
+	}
+	passedRules, ok := session.pipeline.Evaluate(ctx)
+	if !ok {
+		session.observe(code1, code2, overlap, SimulateReasonRule+session.pipeline.rules[len(passedRules)].Name(), passedRules)
+		return false
+	}
+
+	// 超过单个碰撞码或单个标签的匹配上限时推迟到待匹配队列
+	if !session.allowMatch(code1, code2, overlap) {
+		session.deferMatch(code1, code2, overlap)
+		session.observe(code1, code2, overlap, SimulateReasonCapped, passedRules)
+		return false
+	}
+	if session.simulation != nil {
+		session.takeMatch(code1, code2, overlap)
+		session.observe(code1, code2, overlap, "", passedRules)
+		session.simulation.Candidates[len(session.simulation.Candidates)-1].LocationLabel = ctx.LocationLabel1
+		return true
+	}
+
+	outcome := matchOutcome{
+		MatchType:    overlap.MatchType,
+		MatchedRules: passedRules,
+		ListID1:      session.listID(code1),
+		ListID2:      session.listID(code2),
+		Tags1:        overlap.Tags1,
+		Tags2:        overlap.Tags2,
+		DistanceKm:   distance,
+
+		LocationLabel1: ctx.LocationLabel1,
+		LocationLabel2: ctx.LocationLabel2,
+	}
+	if session.replay != nil {
+		session.observe(code1, code2, overlap, "", passedRules)
+		session.replay.accept(code1, code2, outcome)
+		return true
+	}
+
+	created, err := cm.createMatchRecord(code1, code2, outcome)
+	if err != nil {
+		session.recordError(err)
+	}
+	if !created {
+		return false
+	}
+	session.takeMatch(code1, code2, overlap)
+	return true
 }
 
-// createMatchIfNotExists 检查匹配是否已存在，不存在则创建 - 简化版：仅关键词相同即可匹配
-func (cm *CollisionMatcher) createMatchIfNotExists(code1, code2 *models.CollisionCode) bool {
-	// 检查是否已存在匹配结果（双向检查）
-	var existingCount int64
-	config.DB.Model(&models.CollisionResult{}).
-		Where("(user_id = ? AND matched_user_id = ? AND keyword = ?) OR (user_id = ? AND matched_user_id = ? AND keyword = ?)",
-			uint64(code1.UserID), uint64(code2.UserID), code1.Tag,
-			uint64(code2.UserID), uint64(code1.UserID), code1.Tag).
-		Count(&existingCount)
+// matchOutcome 一次匹配的结果，写入碰撞记录和碰撞结果
+type matchOutcome struct {
+	MatchType    string
+	MatchedRules []string // 通过的匹配规则
+	ListID1      uint64   // 非 0 时表示该方来自碰撞列表
+	ListID2      uint64
+	Tags1        []string // code1 一方重合的标签（第一个作为展示关键词）
+	Tags2        []string // code2 一方与之对应的标签
+	DistanceKm   *float64 // 双方发布位置的距离，任一方没有坐标时为 nil
+
+	// 双方各自产生匹配的地址标签（见 MatchContext.LocationLabel1）
+	LocationLabel1 string
+	LocationLabel2 string
+}
+
+// keywords 双方各自看到的关键词（自己提交的写法）
+func (o matchOutcome) keywords(code1, code2 *models.CollisionCode) (string, string) {
+	keyword1, keyword2 := code1.Tag, code2.Tag
+	if len(o.Tags1) > 0 && len(o.Tags2) > 0 {
+		keyword1, keyword2 = o.Tags1[0], o.Tags2[0]
+	}
+	return keyword1, keyword2
+}
 
-	if existingCount > 0 {
-		return false // 已存在匹配，跳过
+// pairKey 匹配对唯一键（见 models.MatchPairKey）
+func (o matchOutcome) pairKey(code1, code2 *models.CollisionCode) string {
+	tags := append(append([]string{}, o.Tags1...), o.Tags2...)
+	if len(o.Tags1) == 0 {
+		keyword1, keyword2 := o.keywords(code1, code2)
+		tags = []string{keyword1, keyword2}
 	}
+	return models.MatchPairKey(uint64(code1.UserID), uint64(code2.UserID), tags)
+}
 
-	// 简化匹配类型：仅使用keyword即可
-	matchType := "keyword" // 简化为仅关键词匹配
+// overlapCount 重合的标签数，单标签匹配为 1
+func (o matchOutcome) overlapCount() int {
+	if len(o.Tags1) == 0 {
+		return 1
+	}
+	return len(o.Tags1)
+}
 
-	return cm.createMatchRecord(code1, code2, matchType)
+// loadCodeUser 确保碰撞码的发布者信息已加载
+func loadCodeUser(code *models.CollisionCode) bool {
+	if code.User.ID != 0 {
+		return true
+	}
+	if err := config.DB.First(&code.User, code.UserID).Error; err != nil {
+		log.Printf("⚠️ 碰撞码#%d的用户数据加载失败,跳过: %v", code.ID, err)
+		return false
+	}
+	return true
 }
 
 // findAndCreateMatch 为指定的碰撞码寻找匹配并创建记录（保留兼容，但不再使用）
@@ -253,7 +838,8 @@ func (cm *CollisionMatcher) findAndCreateMatch(collisionCode *models.CollisionCo
 
 	// 如果找到匹配，创建碰撞记录
 	if matchedCode != nil {
-		return cm.createMatchRecord(collisionCode, matchedCode, matchType)
+		created, _ := cm.createMatchRecord(collisionCode, matchedCode, matchOutcome{MatchType: matchType})
+		return created
 	}
 
 	log.Printf("碰撞码#%d 未找到匹配", collisionCode.ID)
@@ -261,77 +847,106 @@ func (cm *CollisionMatcher) findAndCreateMatch(collisionCode *models.CollisionCo
 }
 
 // createMatchRecord 创建匹配记录并更新碰撞码状态
-func (cm *CollisionMatcher) createMatchRecord(code1, code2 *models.CollisionCode, matchType string) bool {
+// 通过的规则和重合的标签记录到碰撞记录中；来自碰撞列表的一方，碰撞结果关联到对应列表并累加列表的匹配数
+func (cm *CollisionMatcher) createMatchRecord(code1, code2 *models.CollisionCode, outcome matchOutcome) (bool, error) {
 	// 验证用户是否存在
 	var user1, user2 models.User
 	if err := config.DB.First(&user1, code1.UserID).Error; err != nil {
 		log.Printf("❌ 用户User%d不存在,跳过匹配: %v", code1.UserID, err)
-		return false
+		return false, err
 	}
 	if err := config.DB.First(&user2, code2.UserID).Error; err != nil {
 		log.Printf("❌ 用户User%d不存在,跳过匹配: %v", code2.UserID, err)
-		return false
+		return false, err
+	}
+
+	keyword1, keyword2 := outcome.keywords(code1, code2)
+	tags1, tags2 := outcome.Tags1, outcome.Tags2
+	if len(tags1) == 0 {
+		tags1, tags2 = []string{keyword1}, []string{keyword2}
 	}
 
+	// 同一对用户同一关键词只保留一次匹配：唯一索引兜底，提交时的即时匹配和定期匹配并发执行时后插入的被忽略
+	pairKey := outcome.pairKey(code1, code2)
+
 	tx := config.DB.Begin()
 
 	// 创建碰撞记录（双向：code1 -> code2 和 code2 -> code1）
 	record1 := models.CollisionRecord{
 		UserID1:           code1.UserID,
 		UserID2:           code2.UserID,
-		Tag:               code1.Tag,
-		MatchType:         matchType,
+		PairKey:           &pairKey,
+		Tag:               keyword1,
+		MatchType:         outcome.MatchType,
+		MatchedRules:      strings.Join(outcome.MatchedRules, ","),
+		MatchedTags:       strings.Join(tags1, ","),
+		OverlapCount:      outcome.overlapCount(),
 		MatchCountry:      code1.Country,
 		MatchProvince:     code1.Province,
 		MatchCity:         code1.City,
 		MatchDistrict:     code1.District,
+		DistanceKm:        outcome.DistanceKm,
+		LocationLabel:     outcome.LocationLabel1,
 		Status:            "matched",
 		AddFriendDeadline: time.Now().Add(24 * time.Hour),
 	}
 
-	if err := tx.Create(&record1).Error; err != nil {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record1)
+	if result.Error != nil {
 		tx.Rollback()
-		log.Printf("创建碰撞记录失败 (User%d->User%d): %v", code1.UserID, code2.UserID, err)
-		return false
+		log.Printf("创建碰撞记录失败 (User%d->User%d): %v", code1.UserID, code2.UserID, result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil // 已由其他匹配过程创建
 	}
 
 	// 创建反向记录
 	record2 := models.CollisionRecord{
 		UserID1:           code2.UserID,
 		UserID2:           code1.UserID,
-		Tag:               code1.Tag,
-		MatchType:         matchType,
+		PairKey:           &pairKey,
+		Tag:               keyword2,
+		MatchType:         outcome.MatchType,
+		MatchedRules:      strings.Join(outcome.MatchedRules, ","),
+		MatchedTags:       strings.Join(tags2, ","),
+		OverlapCount:      outcome.overlapCount(),
 		MatchCountry:      code1.Country,
 		MatchProvince:     code1.Province,
 		MatchCity:         code1.City,
 		MatchDistrict:     code1.District,
+		DistanceKm:        outcome.DistanceKm,
+		LocationLabel:     outcome.LocationLabel2,
 		Status:            "matched",
 		AddFriendDeadline: time.Now().Add(24 * time.Hour),
 	}
 
-	if err := tx.Create(&record2).Error; err != nil {
+	result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record2)
+	if result.Error != nil {
 		tx.Rollback()
-		log.Printf("创建反向碰撞记录失败 (User%d->User%d): %v", code2.UserID, code1.UserID, err)
-		return false
+		log.Printf("创建反向碰撞记录失败 (User%d->User%d): %v", code2.UserID, code1.UserID, result.Error)
+		return false, result.Error
 	}
-
-	// 更新两个碰撞码的匹配计数和匹配状态
-	if err := tx.Model(code1).Updates(map[string]interface{}{
-		"match_count": gorm.Expr("match_count + 1"),
-		"is_matched":  true,
-	}).Error; err != nil {
+	if result.RowsAffected == 0 {
 		tx.Rollback()
-		log.Printf("更新碰撞码#%d状态失败: %v", code1.ID, err)
-		return false
+		return false, nil
 	}
 
-	if err := tx.Model(code2).Updates(map[string]interface{}{
-		"match_count": gorm.Expr("match_count + 1"),
-		"is_matched":  true,
-	}).Error; err != nil {
-		tx.Rollback()
-		log.Printf("更新碰撞码#%d状态失败: %v", code2.ID, err)
-		return false
+	// 更新两个碰撞码的匹配计数和匹配状态（来自碰撞列表的一方没有碰撞码）
+	// 使用 UpdateColumns 不刷新 updated_at，避免增量匹配重复扫描
+	for _, code := range []*models.CollisionCode{code1, code2} {
+		if code.ID == 0 {
+			continue
+		}
+		if err := tx.Model(code).UpdateColumns(map[string]interface{}{
+			"match_count": gorm.Expr("match_count + 1"),
+			"is_matched":  true,
+		}).Error; err != nil {
+			tx.Rollback()
+			log.Printf("更新碰撞码#%d状态失败: %v", code.ID, err)
+			return false, err
+		}
 	}
 
 	// ========== V3.0 新增：写入 collision_results 表并发送邮件通知 ==========
@@ -346,45 +961,83 @@ func (cm *CollisionMatcher) createMatchRecord(code1, code2 *models.CollisionCode
 	collisionResult1 := models.CollisionResult{
 		UserID:          uint64(code1.UserID),
 		MatchedUserID:   uint64(code2.UserID),
-		CollisionListID: 0, // 由 CollisionCode 触发，无关联的 CollisionList
-		Keyword:         code1.Tag,
+		CollisionListID: outcome.ListID1, // 由碰撞码触发时为 0
+		Keyword:         keyword1,
+		PairKey:         &pairKey,
+		MatchType:       outcome.MatchType,
+		MatchedTags:     strings.Join(tags1, ","),
+		OverlapCount:    outcome.overlapCount(),
 		MatchedEmail:    contact2.Email,
 		MatchedAt:       now,
 	}
-	tx.Create(&collisionResult1)
+	result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&collisionResult1)
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("创建碰撞结果失败 (User%d->User%d): %v", code1.UserID, code2.UserID, result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
 
 	// 写入 V3 碰撞结果表（用户2看到用户1）
 	collisionResult2 := models.CollisionResult{
 		UserID:          uint64(code2.UserID),
 		MatchedUserID:   uint64(code1.UserID),
-		CollisionListID: 0,
-		Keyword:         code1.Tag,
+		CollisionListID: outcome.ListID2,
+		Keyword:         keyword2, // 同义词/模糊匹配时双方各看到自己的关键词
+		PairKey:         &pairKey,
+		MatchType:       outcome.MatchType,
+		MatchedTags:     strings.Join(tags2, ","),
+		OverlapCount:    outcome.overlapCount(),
 		MatchedEmail:    contact1.Email,
 		MatchedAt:       now,
 	}
-	tx.Create(&collisionResult2)
-
-	tx.Commit()
-	log.Printf("✅ 匹配成功！碰撞码#%d (User%d) <-> 碰撞码#%d (User%d), 类型: %s",
-		code1.ID, code1.UserID, code2.ID, code2.UserID, matchType)
+	result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&collisionResult2)
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("创建反向碰撞结果失败 (User%d->User%d): %v", code2.UserID, code1.UserID, result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
 
-	// 更新碰撞列表的匹配数量
-	// 1. 更新code1用户的碰撞列表
-	config.DB.Model(&models.CollisionList{}).
-		Where("user_id = ? AND keyword = ? AND status = 'active'", uint64(code1.UserID), code1.Tag).
-		UpdateColumn("match_count", gorm.Expr("match_count + 1"))
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("提交匹配事务失败 (User%d<->User%d): %v", code1.UserID, code2.UserID, err)
+		return false, err
+	}
+	log.Printf("✅ 匹配成功！%s (User%d) <-> %s (User%d), 类型: %s",
+		describeSource(code1, outcome.ListID1), code1.UserID, describeSource(code2, outcome.ListID2), code2.UserID, outcome.MatchType)
 
-	// 2. 更新code2用户的碰撞列表
-	config.DB.Model(&models.CollisionList{}).
-		Where("user_id = ? AND keyword = ? AND status = 'active'", uint64(code2.UserID), code1.Tag).
-		UpdateColumn("match_count", gorm.Expr("match_count + 1"))
+	// 更新产生匹配的碰撞列表的匹配数量
+	for _, listID := range []uint64{outcome.ListID1, outcome.ListID2} {
+		if listID == 0 {
+			continue
+		}
+		config.DB.Model(&models.CollisionList{}).
+			Where("id = ?", listID).
+			UpdateColumn("match_count", gorm.Expr("match_count + 1"))
+	}
 
 	// 不自动发送邮件，用户手动选择发送
 
-	// 更新热门标签计数(基于碰撞次数)
-	go cm.updateHotTagCount(code1.Tag)
+	// 双方之间的共同关键词变化，重新计算两人所有碰撞结果的得分
+	goBackground(func() { RefreshPairScores(uint64(code1.UserID), uint64(code2.UserID)) })
 
-	return true
+	// 更新热门标签计数(基于碰撞次数)，双方重合的每个标签各计一次
+	counted := make(map[string]bool)
+	for _, tag := range append(tags1, tags2...) {
+		if canonical := tagnorm.Canonical(tag); !counted[canonical] {
+			counted[canonical] = true
+			tag := tag
+			goBackground(func() { RecordHotTag(tag, false) })
+		}
+	}
+
+	return true, nil
 }
 
 // sendEmailNotifications 发送邮件通知给双方（V3.0 新增）
@@ -432,62 +1085,42 @@ func (cm *CollisionMatcher) sendEmailNotifications(userID1, userID2 uint64, keyw
 	}
 }
 
-// updateHotTagCount 更新热门标签计数
-func (cm *CollisionMatcher) updateHotTagCount(keyword string) {
-	var tag models.HotTag
-	now := time.Now()
+// RegisterJobs 将定期匹配注册到后台任务调度器：启动时立即执行一次（首次为全量对账，同时建立倒排索引）
+// 多实例部署时只有持有租约的实例执行匹配，其他实例使用内存索引时到点只刷新本地索引，保证提交时的即时匹配能查到其他实例写入的碰撞码
+func (cm *CollisionMatcher) RegisterJobs(scheduler *Scheduler) {
+	scheduler.Register(JobSpec{
+		Name:        JobMatcher,
+		Description: "定期碰撞匹配（增量匹配，每12次做一次全量对账）",
+		DefaultCron: "*/5 * * * *",
+		RunOnStart:  true,
+		Run: func(ctx context.Context, manual bool) {
+			if !matcherRunMu.TryLock() {
+				log.Println("匹配任务正在执行，跳过本次")
+				return
+			}
+			defer matcherRunMu.Unlock()
+			if manual {
+				NewCollisionMatcher().runMatcher(ctx, MatcherRunSourceManual) // 新的匹配实例首次运行即为全量对账
+				return
+			}
+			cm.runMatcher(ctx, MatcherRunSourceTicker)
+		},
+		Follower: cm.refreshIndex,
+	})
+}
 
-	// 检查标签是否存在
-	if err := config.DB.Where("keyword = ?", keyword).First(&tag).Error; err != nil {
-		// 不存在则创建
-		tag = models.HotTag{
-			Keyword:      keyword,
-			Count24h:     0,
-			CountTotal:   0,
-			Status:       "hide",
-			SubmitCount:  0,
-			LastSearchAt: &now,
-		}
-		config.DB.Create(&tag)
+// refreshIndex 使用内存索引时按数据库重建本地索引
+func (cm *CollisionMatcher) refreshIndex() {
+	if cm.index.Backend() != "memory" {
 		return
-	} else {
-		if tag.Status != "show" {
-			return
-		}
-
-		// 检查是否超过24小时
-		isWithin24h := tag.LastSearchAt != nil && now.Sub(*tag.LastSearchAt) <= 24*time.Hour
-
-		updateData := map[string]interface{}{
-			"count_total":    tag.CountTotal + 1,
-			"last_search_at": now,
-		}
-
-		// 如果在24小时内，增加count_24h
-		if isWithin24h {
-			updateData["count_24h"] = tag.Count24h + 1
-		} else {
-			// 超过24小时，重置count_24h为1
-			updateData["count_24h"] = 1
-		}
-
-		// 更新计数
-		config.DB.Model(&tag).Updates(updateData)
 	}
-}
 
-// StartMatcherService 启动定期匹配服务
-func (cm *CollisionMatcher) StartMatcherService(interval time.Duration) {
-	log.Printf("启动碰撞匹配服务，间隔: %v", interval)
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	// 立即执行一次
-	cm.RunMatcher()
-
-	// 定期执行
-	for range ticker.C {
-		cm.RunMatcher()
+	var activeCodes []models.CollisionCode
+	if err := config.DB.Where("status != ?", "invalid").Find(&activeCodes).Error; err != nil {
+		log.Printf("获取活跃碰撞码失败: %v", err)
+		return
+	}
+	if err := cm.index.Rebuild(activeCodes); err != nil {
+		log.Printf("重建碰撞码索引失败: %v", err)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"html"
 	"net/mail"
 	"net/smtp"
 	"strings"
@@ -482,3 +483,25 @@ func (s *SMTPEmailService) SendCollisionNotifyEmailWithPartnerCompat(userID uint
 
 	return s.SendEmail(userID, toEmail, subject, htmlBody, "collision")
 }
+
+// SendNotificationEmail 发送站内通知的邮件副本（到期提醒、自动续期结果等）
+func (s *SMTPEmailService) SendNotificationEmail(userID uint64, toEmail, title, content string) error {
+	htmlBody := fmt.Sprintf(`
+		<html>
+		<head>
+			<meta charset="UTF-8">
+		</head>
+		<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+			<div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 8px rgba(0,0,0,0.1);">
+				<h2 style="color: #333; text-align: center;">%s</h2>
+				<p style="font-size: 14px; color: #666;">亲爱的用户，</p>
+				<p style="font-size: 14px; color: #666;">%s</p>
+				<p style="font-size: 14px; color: #666;">请登录应用查看更多详情。</p>
+				<hr style="border: none; border-top: 1px solid #eee; margin: 20px 0;">
+				<p style="font-size: 12px; color: #999; text-align: center;">此邮件由系统自动发送，请勿直接回复</p>
+			</div>
+		</body>
+		</html>
+	`, html.EscapeString(title), html.EscapeString(content))
+	return s.SendEmail(userID, toEmail, title, htmlBody, "expiry")
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 到期提醒和自动续期：
+// 定期任务先为开启了自动续期、即将到期的碰撞码和碰撞列表续期（与手动续期一样扣除金币并写入消费记录），
+// 余额不足时跳过并通知用户，到期后照常由清理任务标记为已过期；
+// 然后为其余即将到期的碰撞码和碰撞列表发送到期提醒。通知写入站内通知，用户验证过邮箱时同时发送邮件，
+// 同一到期时间的同一种通知只发送一次（续期后到期时间变化，会再次提醒）。
+
+// ExpiryReminderConfigKey 到期提醒设置在 system_configs 中的配置键
+const ExpiryReminderConfigKey = "expiry_reminder"
+
+// 续期价格
+const (
+	CodeRenewCost     = 10             // 碰撞码续期一次的金币
+	CodeRenewDuration = 24 * time.Hour // 碰撞码续期一次延长的时间
+)
+
+// autoRenewLead 到期前多久自动续期，需大于到期提醒任务的执行间隔
+const autoRenewLead = 15 * time.Minute
+
+// 站内通知类型
+const (
+	NotificationExpiryReminder   = "expiry_reminder"
+	NotificationAutoRenewed      = "auto_renewed"
+	NotificationAutoRenewSkipped = "auto_renew_skipped"
+)
+
+// ErrRenewConflict 到期时间已被其他请求修改（已续期）
+var ErrRenewConflict = errors.New("已被续期")
+
+// ExpiryReminderSetting 到期提醒设置，提前时间为 0 表示不提醒
+type ExpiryReminderSetting struct {
+	CodeLeadHours int `json:"code_lead_hours"` // 碰撞码到期前多少小时提醒
+	ListLeadHours int `json:"list_lead_hours"` // 碰撞列表到期前多少小时提醒
+	ListRenewDays int `json:"list_renew_days"` // 碰撞列表每次自动续期的天数（每天 1 积分）
+}
+
+// DefaultExpiryReminderSetting 碰撞码提前 2 小时、碰撞列表提前 1 天提醒，碰撞列表每次自动续期 7 天
+var DefaultExpiryReminderSetting = ExpiryReminderSetting{CodeLeadHours: 2, ListLeadHours: 24, ListRenewDays: 7}
+
+// LoadExpiryReminderSetting 从系统配置读取到期提醒设置
+func LoadExpiryReminderSetting() ExpiryReminderSetting {
+	setting := DefaultExpiryReminderSetting
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", ExpiryReminderConfigKey).First(&cfg).Error; err != nil {
+		return setting
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("code_lead_hours")); err == nil && v >= 0 {
+		setting.CodeLeadHours = v
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("list_lead_hours")); err == nil && v >= 0 {
+		setting.ListLeadHours = v
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("list_renew_days")); err == nil && v > 0 {
+		setting.ListRenewDays = v
+	}
+	return setting
+}
+
+// SendExpiryReminders 自动续期即将到期的碰撞码和碰撞列表，并为其余的发送到期提醒
+func SendExpiryReminders(ctx context.Context) {
+	setting := LoadExpiryReminderSetting()
+	now := time.Now()
+
+	renewed, skipped := autoRenewCodes(ctx, now)
+	listsRenewed, listsSkipped := autoRenewLists(ctx, now, setting.ListRenewDays)
+	reminded := 0
+	if setting.CodeLeadHours > 0 {
+		reminded += remindCodes(ctx, now, time.Duration(setting.CodeLeadHours)*time.Hour)
+	}
+	if setting.ListLeadHours > 0 {
+		reminded += remindLists(ctx, now, time.Duration(setting.ListLeadHours)*time.Hour)
+	}
+
+	if renewed+skipped+listsRenewed+listsSkipped+reminded > 0 {
+		log.Printf("到期提醒: 自动续期碰撞码 %d（余额不足 %d），自动续期碰撞列表 %d（余额不足 %d），发送提醒 %d",
+			renewed, skipped, listsRenewed, listsSkipped, reminded)
+	}
+}
+
+// autoRenewCodes 为开启自动续期、即将到期的碰撞码续期
+func autoRenewCodes(ctx context.Context, now time.Time) (renewed, skipped int) {
+	var codes []models.CollisionCode
+	if err := config.DB.Where("auto_renew = ? AND status = ? AND expires_at <= ?", true, "active", now.Add(autoRenewLead)).
+		Find(&codes).Error; err != nil {
+		log.Printf("读取待自动续期的碰撞码失败: %v", err)
+		return 0, 0
+	}
+
+	for i := range codes {
+		if ctx.Err() != nil {
+			break
+		}
+		code := &codes[i]
+		expiresAt := code.ExpiresAt
+		label := codeLabel(code)
+		err := RenewCode(code)
+		switch {
+		case err == nil:
+			renewed++
+			notify(models.Notification{
+				UserID:  uint64(code.UserID),
+				Type:    NotificationAutoRenewed,
+				Title:   "碰撞码已自动续期",
+				Content: fmt.Sprintf("您的碰撞码「%s」已自动续期，扣除 %d 金币，新的到期时间为 %s。", label, CodeRenewCost, code.ExpiresAt.Format("2006-01-02 15:04")),
+				RefType: "collision_code",
+				RefID:   uint64(code.ID),
+			}, notificationKey(NotificationAutoRenewed, "code", uint64(code.ID), expiresAt))
+		case errors.Is(err, ErrInsufficientCoins):
+			skipped++
+			notify(models.Notification{
+				UserID:  uint64(code.UserID),
+				Type:    NotificationAutoRenewSkipped,
+				Title:   "碰撞码自动续期失败",
+				Content: fmt.Sprintf("您的碰撞码「%s」将于 %s 到期，自动续期需要 %d 金币，当前余额不足，请充值后手动续期。", label, expiresAt.Format("2006-01-02 15:04"), CodeRenewCost),
+				RefType: "collision_code",
+				RefID:   uint64(code.ID),
+			}, notificationKey(NotificationAutoRenewSkipped, "code", uint64(code.ID), expiresAt))
+		case errors.Is(err, ErrRenewConflict):
+		default:
+			log.Printf("自动续期碰撞码 %d 失败: %v", code.ID, err)
+		}
+	}
+	return renewed, skipped
+}
+
+// autoRenewLists 为开启自动续期、即将到期的碰撞列表续期
+func autoRenewLists(ctx context.Context, now time.Time, days int) (renewed, skipped int) {
+	var lists []models.CollisionList
+	if err := config.DB.Where("auto_renew = ? AND status = ? AND expire_at <= ?", true, "active", now.Add(autoRenewLead)).
+		Find(&lists).Error; err != nil {
+		log.Printf("读取待自动续期的碰撞列表失败: %v", err)
+		return 0, 0
+	}
+
+	for i := range lists {
+		if ctx.Err() != nil {
+			break
+		}
+		list := &lists[i]
+		expireAt := list.ExpireAt
+		err := ExtendList(list, days)
+		switch {
+		case err == nil:
+			renewed++
+			notify(models.Notification{
+				UserID:  list.UserID,
+				Type:    NotificationAutoRenewed,
+				Title:   "碰撞列表已自动续期",
+				Content: fmt.Sprintf("您的碰撞列表「%s」已自动续期 %d 天，扣除 %d 积分，新的到期时间为 %s。", list.Keyword, days, days, list.ExpireAt.Format("2006-01-02 15:04")),
+				RefType: "collision_list",
+				RefID:   list.ID,
+			}, notificationKey(NotificationAutoRenewed, "list", list.ID, expireAt))
+		case errors.Is(err, ErrInsufficientCoins):
+			skipped++
+			notify(models.Notification{
+				UserID:  list.UserID,
+				Type:    NotificationAutoRenewSkipped,
+				Title:   "碰撞列表自动续期失败",
+				Content: fmt.Sprintf("您的碰撞列表「%s」将于 %s 到期，自动续期 %d 天需要 %d 积分，当前余额不足，请充值后手动续期。", list.Keyword, expireAt.Format("2006-01-02 15:04"), days, days),
+				RefType: "collision_list",
+				RefID:   list.ID,
+			}, notificationKey(NotificationAutoRenewSkipped, "list", list.ID, expireAt))
+		case errors.Is(err, ErrRenewConflict):
+		default:
+			log.Printf("自动续期碰撞列表 %d 失败: %v", list.ID, err)
+		}
+	}
+	return renewed, skipped
+}
+
+// remindCodes 为即将到期、没有开启自动续期的碰撞码发送提醒
+func remindCodes(ctx context.Context, now time.Time, lead time.Duration) int {
+	var codes []models.CollisionCode
+	if err := config.DB.Where("auto_renew = ? AND status = ? AND expires_at > ? AND expires_at <= ?", false, "active", now, now.Add(lead)).
+		Find(&codes).Error; err != nil {
+		log.Printf("读取即将到期的碰撞码失败: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for _, code := range codes {
+		if ctx.Err() != nil {
+			break
+		}
+		if notify(models.Notification{
+			UserID:  uint64(code.UserID),
+			Type:    NotificationExpiryReminder,
+			Title:   "碰撞码即将到期",
+			Content: fmt.Sprintf("您的碰撞码「%s」将于 %s 到期，到期后不再参与匹配。续期一次需要 %d 金币，也可以开启自动续期。", codeLabel(&code), code.ExpiresAt.Format("2006-01-02 15:04"), CodeRenewCost),
+			RefType: "collision_code",
+			RefID:   uint64(code.ID),
+		}, notificationKey(NotificationExpiryReminder, "code", uint64(code.ID), code.ExpiresAt)) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// remindLists 为即将到期、没有开启自动续期的碰撞列表发送提醒
+func remindLists(ctx context.Context, now time.Time, lead time.Duration) int {
+	var lists []models.CollisionList
+	if err := config.DB.Where("auto_renew = ? AND status = ? AND expire_at > ? AND expire_at <= ?", false, "active", now, now.Add(lead)).
+		Find(&lists).Error; err != nil {
+		log.Printf("读取即将到期的碰撞列表失败: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for _, list := range lists {
+		if ctx.Err() != nil {
+			break
+		}
+		if notify(models.Notification{
+			UserID:  list.UserID,
+			Type:    NotificationExpiryReminder,
+			Title:   "碰撞列表即将到期",
+			Content: fmt.Sprintf("您的碰撞列表「%s」将于 %s 到期，到期后不再参与匹配。续期每天需要 1 积分，也可以开启自动续期。", list.Keyword, list.ExpireAt.Format("2006-01-02 15:04")),
+			RefType: "collision_list",
+			RefID:   list.ID,
+		}, notificationKey(NotificationExpiryReminder, "list", list.ID, list.ExpireAt)) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// RenewCode 续期碰撞码：扣除 CodeRenewCost 金币，到期时间延长 CodeRenewDuration（已过期的从现在起算）并写入消费记录
+// 按读取时的到期时间条件更新，同一到期时间只会续期一次
+func RenewCode(code *models.CollisionCode) error {
+	now := time.Now()
+	newExpire := now.Add(CodeRenewDuration)
+	if code.ExpiresAt.After(now) {
+		newExpire = code.ExpiresAt.Add(CodeRenewDuration)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CollisionCode{}).
+			Where("id = ? AND expires_at = ?", code.ID, code.ExpiresAt).
+			Updates(map[string]interface{}{
+				"expires_at": newExpire,
+				"status":     "active",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRenewConflict
+		}
+		_, err := Debit(tx, code.UserID, CodeRenewCost, LedgerEntry{
+			Type:    "renew_collision",
+			Reason:  "Renew collision code: " + code.Tag,
+			RefType: RefCollisionCode,
+			RefID:   uint64(code.ID),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	code.ExpiresAt = newExpire
+	code.Status = "active"
+	return nil
+}
+
+// ExtendList 碰撞列表续期 days 天，每天 1 积分（与修改碰撞列表时延长有效期相同），并写入消费记录
+func ExtendList(list *models.CollisionList, days int) error {
+	newExpire := list.ExpireAt.AddDate(0, 0, days)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CollisionList{}).
+			Where("id = ? AND expire_at = ?", list.ID, list.ExpireAt).
+			Updates(map[string]interface{}{
+				"expire_at":   newExpire,
+				"duration":    gorm.Expr("duration + ?", days),
+				"cost_points": gorm.Expr("cost_points + ?", days),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRenewConflict
+		}
+		_, err := Debit(tx, uint(list.UserID), days, LedgerEntry{
+			Type:    "renew_collision_list",
+			Reason:  "Renew collision list: " + list.Keyword,
+			RefType: RefCollisionList,
+			RefID:   list.ID,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	list.ExpireAt = newExpire
+	list.Duration += days
+	list.CostPoints += days
+	return nil
+}
+
+// notify 写入站内通知，用户验证过邮箱时同时发送邮件；dedupKey 相同的通知只发送一次，已发送过时返回 false
+func notify(notification models.Notification, dedupKey string) bool {
+	notification.DedupKey = &dedupKey
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+	if result.Error != nil {
+		log.Printf("写入站内通知失败: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	var contact models.UserContact
+	if err := config.DB.Where("user_id = ?", notification.UserID).First(&contact).Error; err == nil && contact.Email != "" && contact.EmailVerified {
+		if err := NewSMTPEmailService(config.DB).SendNotificationEmail(notification.UserID, contact.Email, notification.Title, notification.Content); err != nil {
+			log.Printf("📧 发送通知邮件给User%d失败: %v", notification.UserID, err)
+		}
+	}
+	return true
+}
+
+// notificationKey 通知去重键：通知类型 + 对象 + 到期时间
+func notificationKey(kind, refType string, refID uint64, expiresAt time.Time) string {
+	return fmt.Sprintf("%s:%s:%d:%d", kind, refType, refID, expiresAt.Unix())
+}
+
+// codeLabel 碰撞码在通知中的名称，组合碰撞码显示全部标签
+func codeLabel(code *models.CollisionCode) string {
+	return strings.Join(code.TagList(), "、")
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 热门标签计数：
+// 总榜使用 hot_tags.count_total，原子累加；24小时榜是滑动窗口，按小时分桶计数，取最近24个小时桶（含当前小时）之和，
+// 不再按最后搜索时间重置或在零点清零。小时桶在 Redis 可用时为每小时一个有序集合（25小时后自动过期），
+// 否则为 MySQL 的 hot_tag_buckets 表（由定期任务删除过期的桶）。
+// hot_tags.count_24h 只是定期刷新的快照（供管理后台查看），首页24小时榜直接读取小时桶。
+
+// hotTagWindow 24小时榜的窗口（小时桶个数）
+const hotTagWindow = 24
+
+// HotTagRank 热门标签排行中的一项
+type HotTagRank struct {
+	Keyword string
+	Count   int
+}
+
+// hotTagCounter 小时桶存储
+type hotTagCounter interface {
+	// Incr 在 at 所在的小时桶中为标签（规范形式）计数加一
+	Incr(canonical string, at time.Time) error
+	// Window 从 since 所在的小时桶起，各标签（规范形式）的计数之和
+	Window(since time.Time) (map[string]int, error)
+	// Prune 删除 before 所在小时之前的桶
+	Prune(before time.Time) error
+	Backend() string
+}
+
+var (
+	sharedHotTagCounter     hotTagCounter
+	sharedHotTagCounterOnce sync.Once
+)
+
+// hotTags 获取进程内共享的小时桶存储，Redis 可用时使用 Redis，否则退回 MySQL
+func hotTags() hotTagCounter {
+	sharedHotTagCounterOnce.Do(func() {
+		backend := config.Config.HotTagsBackend
+		if backend != "mysql" && config.Redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := config.Redis.Ping(ctx).Err()
+			cancel()
+			if err == nil {
+				sharedHotTagCounter = &redisHotTagCounter{client: config.Redis, prefix: "collision:hot_tags:"}
+			} else if backend == "redis" {
+				log.Printf("⚠️ Redis不可用，热门标签计数退回MySQL: %v", err)
+			}
+		}
+		if sharedHotTagCounter == nil {
+			sharedHotTagCounter = &mysqlHotTagCounter{}
+		}
+		log.Printf("热门标签小时桶已启用，存储: %s", sharedHotTagCounter.Backend())
+	})
+	return sharedHotTagCounter
+}
+
+// hotTagWindowStart 当前24小时窗口的起点（最早一个小时桶）
+func hotTagWindowStart(now time.Time) time.Time {
+	return now.Truncate(time.Hour).Add(-(hotTagWindow - 1) * time.Hour)
+}
+
+// RecordHotTag 热门标签计数加一（提交碰撞列表、点击标签、碰撞成功时调用），submitted 为 true 时同时累加提交次数
+// 标签不存在时创建为 hide 状态，审核为 show 之前不计数
+func RecordHotTag(keyword string, submitted bool) {
+	canonical := tagnorm.Canonical(keyword)
+	if canonical == "" {
+		return
+	}
+	now := time.Now()
+
+	var tag models.HotTag
+	if err := config.DB.Where("keyword_canonical = ?", canonical).First(&tag).Error; err != nil {
+		config.DB.Create(&models.HotTag{
+			Keyword:      keyword,
+			Status:       "hide",
+			LastSearchAt: &now,
+		})
+		return
+	}
+	if tag.Status != "show" {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"count_total":    gorm.Expr("count_total + 1"),
+		"last_search_at": now,
+	}
+	if submitted {
+		updates["submit_count"] = gorm.Expr("submit_count + 1")
+	}
+	if err := config.DB.Model(&tag).Updates(updates).Error; err != nil {
+		log.Printf("更新热门标签 %q 计数失败: %v", tag.Keyword, err)
+		return
+	}
+	if err := hotTags().Incr(canonical, now); err != nil {
+		log.Printf("更新热门标签 %q 小时计数失败: %v", tag.Keyword, err)
+	}
+}
+
+// HotTags24h 最近24小时的热门标签（只包含 show 状态），按计数降序取前 limit 个
+func HotTags24h(limit int) ([]HotTagRank, error) {
+	counts, err := hotTags().Window(hotTagWindowStart(time.Now()))
+	if err != nil || len(counts) == 0 {
+		return nil, err
+	}
+
+	canonicals := make([]string, 0, len(counts))
+	for canonical := range counts {
+		canonicals = append(canonicals, canonical)
+	}
+	var tags []models.HotTag
+	if err := config.DB.Where("status = ? AND keyword_canonical IN ?", "show", canonicals).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	ranks := make([]HotTagRank, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if seen[tag.KeywordCanonical] {
+			continue
+		}
+		seen[tag.KeywordCanonical] = true
+		if count := counts[tag.KeywordCanonical]; count > 0 {
+			ranks = append(ranks, HotTagRank{Keyword: tag.Keyword, Count: count})
+		}
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Count != ranks[j].Count {
+			return ranks[i].Count > ranks[j].Count
+		}
+		return ranks[i].Keyword < ranks[j].Keyword
+	})
+	if len(ranks) > limit {
+		ranks = ranks[:limit]
+	}
+	return ranks, nil
+}
+
+// HotTagsAll 总榜热门标签（只包含 show 状态），按总计数降序取前 limit 个
+func HotTagsAll(limit int) ([]HotTagRank, error) {
+	var tags []models.HotTag
+	if err := config.DB.Where("status = ? AND count_total > 0", "show").
+		Order("count_total DESC, keyword ASC").
+		Limit(limit).
+		Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	ranks := make([]HotTagRank, len(tags))
+	for i, tag := range tags {
+		ranks[i] = HotTagRank{Keyword: tag.Keyword, Count: tag.CountTotal}
+	}
+	return ranks, nil
+}
+
+// RefreshHotTags24h 将小时桶的窗口计数写入 hot_tags.count_24h 快照，并删除已滑出窗口的小时桶
+func RefreshHotTags24h() {
+	since := hotTagWindowStart(time.Now())
+	counts, err := hotTags().Window(since)
+	if err != nil {
+		log.Printf("读取24小时热门标签计数失败: %v", err)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.HotTag{}).Where("count_24h <> 0").UpdateColumn("count_24h", 0).Error; err != nil {
+			return err
+		}
+		for canonical, count := range counts {
+			if err := tx.Model(&models.HotTag{}).Where("keyword_canonical = ?", canonical).UpdateColumn("count_24h", count).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("刷新24小时热门标签快照失败: %v", err)
+		return
+	}
+
+	if err := hotTags().Prune(since); err != nil {
+		log.Printf("清理过期的热门标签小时桶失败: %v", err)
+		return
+	}
+	log.Printf("已刷新24小时热门标签快照，窗口内 %d 个标签", len(counts))
+}
+
+// mysqlHotTagCounter 基于 hot_tag_buckets 表的小时桶
+type mysqlHotTagCounter struct{}
+
+func (m *mysqlHotTagCounter) Backend() string {
+	return "mysql"
+}
+
+func (m *mysqlHotTagCounter) Incr(canonical string, at time.Time) error {
+	return config.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"hits": gorm.Expr("hits + 1")}),
+	}).Create(&models.HotTagBucket{
+		KeywordCanonical: canonical,
+		BucketAt:         at.Truncate(time.Hour),
+		Hits:             1,
+	}).Error
+}
+
+func (m *mysqlHotTagCounter) Window(since time.Time) (map[string]int, error) {
+	var rows []struct {
+		KeywordCanonical string
+		Hits             int
+	}
+	if err := config.DB.Model(&models.HotTagBucket{}).
+		Select("keyword_canonical, SUM(hits) AS hits").
+		Where("bucket_at >= ?", since.Truncate(time.Hour)).
+		Group("keyword_canonical").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.KeywordCanonical] = row.Hits
+	}
+	return counts, nil
+}
+
+func (m *mysqlHotTagCounter) Prune(before time.Time) error {
+	return config.DB.Where("bucket_at < ?", before.Truncate(time.Hour)).Delete(&models.HotTagBucket{}).Error
+}
+
+// redisHotTagCounter 基于 Redis 有序集合的小时桶，每小时一个（member=标签规范形式, score=计数）
+type redisHotTagCounter struct {
+	client *redis.Client
+	prefix string
+}
+
+func (r *redisHotTagCounter) Backend() string {
+	return "redis"
+}
+
+// key 小时桶的键，按 Unix 小时编号，与时区无关
+func (r *redisHotTagCounter) key(at time.Time) string {
+	return r.prefix + strconv.FormatInt(at.Unix()/3600, 10)
+}
+
+func (r *redisHotTagCounter) Incr(canonical string, at time.Time) error {
+	ctx := context.Background()
+	key := r.key(at)
+	pipe := r.client.TxPipeline()
+	pipe.ZIncrBy(ctx, key, 1, canonical)
+	// 多保留一小时，保证桶在滑出窗口之前不会过期
+	pipe.Expire(ctx, key, (hotTagWindow+1)*time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redisHotTagCounter) Window(since time.Time) (map[string]int, error) {
+	ctx := context.Background()
+	pipe := r.client.Pipeline()
+	var cmds []*redis.ZSliceCmd
+	for at := since.Truncate(time.Hour); !at.After(time.Now()); at = at.Add(time.Hour) {
+		cmds = append(cmds, pipe.ZRangeWithScores(ctx, r.key(at), 0, -1))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			if member, ok := z.Member.(string); ok {
+				counts[member] += int(z.Score)
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Prune 小时桶自动过期，无需清理
+func (r *redisHotTagCounter) Prune(before time.Time) error {
+	return nil
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 扣费接口的幂等键：
+// 请求带 Idempotency-Key 时，同一用户同一个键第一次请求先占用该键（处理中），处理完成后保存响应，
+// 保留期内的重复请求直接返回保存的响应；占用期间到达的重复请求返回 409。
+// 处理中的占用只保持 idempotencyLockTTL，进程在处理过程中退出时，过期后同一个键可以重新处理。
+// 每次占用有各自的标识（token），保存响应和释放只对仍由本次占用的键生效，处理超时后被重试接管的键不会被覆盖或删除。
+// 存储由 IDEMPOTENCY_BACKEND（auto|redis|mysql）决定：Redis 可用时使用 Redis（到期自动删除），否则为 MySQL 的 idempotency_keys 表（定期清理）。
+
+// idempotencyLockTTL 处理中的占用时长，需大于扣费接口的最长处理时间（含发送邮件）
+const idempotencyLockTTL = 5 * time.Minute
+
+// 幂等键状态
+const (
+	idempotencyPending = "pending"
+	idempotencyDone    = "done"
+)
+
+var (
+	// ErrIdempotencyInProgress 同一个幂等键的请求正在处理中
+	ErrIdempotencyInProgress = errors.New("相同幂等键的请求正在处理中")
+	// ErrIdempotencyKeyReused 同一个幂等键用于了不同的请求
+	ErrIdempotencyKeyReused = errors.New("幂等键已用于其他请求")
+	// ErrIdempotencyLockLost 保存响应时占用已过期或被其他请求接管
+	ErrIdempotencyLockLost = errors.New("幂等键的占用已失效")
+)
+
+// IdempotentResponse 幂等键保存的首次响应
+type IdempotentResponse struct {
+	Fingerprint string `json:"fingerprint"` // 请求摘要
+	Token       string `json:"token"`       // 占用标识
+	Status      string `json:"status"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// idempotencyStore 幂等键存储
+type idempotencyStore interface {
+	// Reserve 以 token 占用幂等键：占用成功返回 nil；已保存响应时返回该响应
+	Reserve(userID uint, key, fingerprint, token string) (*IdempotentResponse, error)
+	// Complete 键仍由 token 占用时保存响应，保留 ttl；占用已失效时返回 ErrIdempotencyLockLost
+	Complete(userID uint, key, token string, resp IdempotentResponse, ttl time.Duration) error
+	// Release 键仍由 token 占用时释放（处理失败，允许重试）
+	Release(userID uint, key, fingerprint, token string) error
+	// Prune 删除 before 之前到期的幂等键
+	Prune(before time.Time) error
+	Backend() string
+}
+
+var (
+	sharedIdempotencyStore     idempotencyStore
+	sharedIdempotencyStoreOnce sync.Once
+)
+
+// idempotency 按配置选择幂等键存储，Redis 不可用时退回 MySQL
+func idempotency() idempotencyStore {
+	sharedIdempotencyStoreOnce.Do(func() {
+		backend := config.Config.IdempotencyBackend
+		if backend != "mysql" && config.Redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := config.Redis.Ping(ctx).Err()
+			cancel()
+			if err == nil {
+				sharedIdempotencyStore = &redisIdempotencyStore{client: config.Redis, prefix: "collision:idempotency:"}
+			} else if backend == "redis" {
+				log.Printf("⚠️ Redis不可用，幂等键退回MySQL: %v", err)
+			}
+		}
+		if sharedIdempotencyStore == nil {
+			sharedIdempotencyStore = &mysqlIdempotencyStore{}
+		}
+		log.Printf("扣费接口幂等键已启用，存储: %s", sharedIdempotencyStore.Backend())
+	})
+	return sharedIdempotencyStore
+}
+
+// idempotencyTTL 幂等键保留时长
+func idempotencyTTL() time.Duration {
+	hours := config.Config.IdempotencyTTLHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// ReserveIdempotencyKey 占用幂等键。返回的 saved 为 nil 且没有错误时由本次请求处理，
+// 处理完用返回的 token 调用 CompleteIdempotencyKey 或 ReleaseIdempotencyKey；
+// 已保存响应时返回该响应；正在处理中返回 ErrIdempotencyInProgress，用于不同请求时返回 ErrIdempotencyKeyReused
+func ReserveIdempotencyKey(userID uint, key, fingerprint string) (token string, saved *IdempotentResponse, err error) {
+	token = utils.GenerateRandomString(32)
+	saved, err = idempotency().Reserve(userID, key, fingerprint, token)
+	return token, saved, err
+}
+
+// CompleteIdempotencyKey 保存首次响应，键已不由 token 占用时返回 ErrIdempotencyLockLost
+func CompleteIdempotencyKey(userID uint, key, token string, resp IdempotentResponse) error {
+	resp.Token = token
+	resp.Status = idempotencyDone
+	return idempotency().Complete(userID, key, token, resp, idempotencyTTL())
+}
+
+// ReleaseIdempotencyKey 释放本次占用，之后同一个键可以重新处理
+func ReleaseIdempotencyKey(userID uint, key, fingerprint, token string) error {
+	return idempotency().Release(userID, key, fingerprint, token)
+}
+
+// PruneIdempotencyKeys 删除已过期的幂等键（Redis 存储自动过期）
+func PruneIdempotencyKeys() error {
+	return idempotency().Prune(time.Now())
+}
+
+// checkIdempotentResponse 已存在的幂等键：用于不同请求、处理中或返回保存的响应
+func checkIdempotentResponse(resp *IdempotentResponse, fingerprint string) (*IdempotentResponse, error) {
+	if resp.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if resp.Status != idempotencyDone {
+		return nil, ErrIdempotencyInProgress
+	}
+	return resp, nil
+}
+
+// mysqlIdempotencyStore MySQL 存储：唯一索引 (user_id, idempotency_key) 保证只有一个请求占用成功
+type mysqlIdempotencyStore struct{}
+
+func (s *mysqlIdempotencyStore) Backend() string {
+	return "mysql"
+}
+
+func (s *mysqlIdempotencyStore) Reserve(userID uint, key, fingerprint, token string) (*IdempotentResponse, error) {
+	// 占用的键被删除或过期时重试
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now()
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			Token:       token,
+			Status:      idempotencyPending,
+			ExpiresAt:   now.Add(idempotencyLockTTL),
+		}
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil, nil
+		}
+
+		var existing models.IdempotencyKey
+		err := config.DB.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// 已过期（保留期已过，或处理中的进程已退出）时接管
+		if existing.ExpiresAt.Before(now) {
+			result := config.DB.Model(&models.IdempotencyKey{}).
+				Where("id = ? AND expires_at = ?", existing.ID, existing.ExpiresAt).
+				Updates(map[string]interface{}{
+					"fingerprint":  fingerprint,
+					"token":        token,
+					"status":       idempotencyPending,
+					"status_code":  0,
+					"content_type": "",
+					"body":         nil,
+					"expires_at":   now.Add(idempotencyLockTTL),
+				})
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			if result.RowsAffected > 0 {
+				return nil, nil
+			}
+			continue
+		}
+
+		return checkIdempotentResponse(&IdempotentResponse{
+			Fingerprint: existing.Fingerprint,
+			Status:      existing.Status,
+			StatusCode:  existing.StatusCode,
+			ContentType: existing.ContentType,
+			Body:        existing.Body,
+		}, fingerprint)
+	}
+	return nil, ErrIdempotencyInProgress
+}
+
+func (s *mysqlIdempotencyStore) Complete(userID uint, key, token string, resp IdempotentResponse, ttl time.Duration) error {
+	result := config.DB.Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND idempotency_key = ? AND status = ? AND fingerprint = ? AND token = ?",
+			userID, key, idempotencyPending, resp.Fingerprint, token).
+		Updates(map[string]interface{}{
+			"status":       resp.Status,
+			"status_code":  resp.StatusCode,
+			"content_type": resp.ContentType,
+			"body":         resp.Body,
+			"expires_at":   time.Now().Add(ttl),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyLockLost
+	}
+	return nil
+}
+
+func (s *mysqlIdempotencyStore) Release(userID uint, key, fingerprint, token string) error {
+	return config.DB.Where("user_id = ? AND idempotency_key = ? AND status = ? AND fingerprint = ? AND token = ?",
+		userID, key, idempotencyPending, fingerprint, token).
+		Delete(&models.IdempotencyKey{}).Error
+}
+
+func (s *mysqlIdempotencyStore) Prune(before time.Time) error {
+	return config.DB.Where("expires_at < ?", before).Delete(&models.IdempotencyKey{}).Error
+}
+
+// redisIdempotencyStore Redis 存储：每个键一个字符串（JSON），SETNX 占用，到期自动删除
+type redisIdempotencyStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *redisIdempotencyStore) Backend() string {
+	return "redis"
+}
+
+func (s *redisIdempotencyStore) redisKey(userID uint, key string) string {
+	return fmt.Sprintf("%s%d:%s", s.prefix, userID, key)
+}
+
+// pendingValue 处理中的键的值，保存响应和释放时按该值比较，只对本次占用生效
+func (s *redisIdempotencyStore) pendingValue(fingerprint, token string) ([]byte, error) {
+	return json.Marshal(IdempotentResponse{Fingerprint: fingerprint, Token: token, Status: idempotencyPending})
+}
+
+// 键的值仍为本次占用时保存响应
+var redisIdempotencyCompleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0`)
+
+func (s *redisIdempotencyStore) Reserve(userID uint, key, fingerprint, token string) (*IdempotentResponse, error) {
+	ctx := context.Background()
+	redisKey := s.redisKey(userID, key)
+	pending, err := s.pendingValue(fingerprint, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// 占用的键在 SETNX 和 GET 之间过期时重试
+	for attempt := 0; attempt < 3; attempt++ {
+		ok, err := s.client.SetNX(ctx, redisKey, pending, idempotencyLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+
+		data, err := s.client.Get(ctx, redisKey).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var existing IdempotentResponse
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return nil, err
+		}
+		return checkIdempotentResponse(&existing, fingerprint)
+	}
+	return nil, ErrIdempotencyInProgress
+}
+
+func (s *redisIdempotencyStore) Complete(userID uint, key, token string, resp IdempotentResponse, ttl time.Duration) error {
+	pending, err := s.pendingValue(resp.Fingerprint, token)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	result, err := redisIdempotencyCompleteScript.Run(context.Background(), s.client,
+		[]string{s.redisKey(userID, key)}, pending, data, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if result == 0 {
+		return ErrIdempotencyLockLost
+	}
+	return nil
+}
+
+// Release 与租约的释放相同：值仍为本次占用时删除
+func (s *redisIdempotencyStore) Release(userID uint, key, fingerprint, token string) error {
+	pending, err := s.pendingValue(fingerprint, token)
+	if err != nil {
+		return err
+	}
+	return redisReleaseScript.Run(context.Background(), s.client, []string{s.redisKey(userID, key)}, pending).Err()
+}
+
+// Prune Redis 中的键到期自动删除
+func (s *redisIdempotencyStore) Prune(time.Time) error {
+	return nil
+}
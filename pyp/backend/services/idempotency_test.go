@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// idempotencyBackend 一种幂等键存储及让处理中的占用立即过期的方法（模拟经过 idempotencyLockTTL）
+type idempotencyBackend struct {
+	name string
+	open func(t *testing.T) (store idempotencyStore, expire func(userID uint, key string))
+}
+
+var idempotencyBackends = []idempotencyBackend{
+	{"mysql", func(t *testing.T) (idempotencyStore, func(uint, string)) {
+		db := useTestDB(t, &models.IdempotencyKey{})
+		return &mysqlIdempotencyStore{}, func(userID uint, key string) {
+			db.Model(&models.IdempotencyKey{}).
+				Where("user_id = ? AND idempotency_key = ?", userID, key).
+				UpdateColumn("expires_at", time.Now().Add(-time.Second))
+		}
+	}},
+	{"redis", func(t *testing.T) (idempotencyStore, func(uint, string)) {
+		client, prefix := useTestRedis(t)
+		store := &redisIdempotencyStore{client: client, prefix: prefix}
+		return store, func(userID uint, key string) {
+			client.PExpire(context.Background(), store.redisKey(userID, key), time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}},
+}
+
+// completedResponse 与 CompleteIdempotencyKey 保存的响应相同
+func completedResponse(fingerprint, token, body string) IdempotentResponse {
+	return IdempotentResponse{
+		Fingerprint: fingerprint,
+		Token:       token,
+		Status:      idempotencyDone,
+		StatusCode:  200,
+		ContentType: "application/json; charset=utf-8",
+		Body:        []byte(body),
+	}
+}
+
+func TestIdempotencyStoreReplay(t *testing.T) {
+	for _, backend := range idempotencyBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, _ := backend.open(t)
+
+			if saved, err := store.Reserve(1, "k1", "fp-a", "token-1"); saved != nil || err != nil {
+				t.Fatalf("首次 Reserve = %v, %v, want 占用成功", saved, err)
+			}
+			// 处理中：同一请求返回 409 对应的错误，不同请求返回 422 对应的错误
+			if _, err := store.Reserve(1, "k1", "fp-a", "token-2"); !errors.Is(err, ErrIdempotencyInProgress) {
+				t.Errorf("处理中 Reserve = %v, want ErrIdempotencyInProgress", err)
+			}
+			if _, err := store.Reserve(1, "k1", "fp-b", "token-2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+				t.Errorf("处理中用于不同请求 Reserve = %v, want ErrIdempotencyKeyReused", err)
+			}
+			// 幂等键按用户区分
+			if saved, err := store.Reserve(2, "k1", "fp-b", "token-3"); saved != nil || err != nil {
+				t.Errorf("其他用户的同名键 Reserve = %v, %v, want 占用成功", saved, err)
+			}
+
+			if err := store.Complete(1, "k1", "token-1", completedResponse("fp-a", "token-1", `{"code":200}`), time.Hour); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			saved, err := store.Reserve(1, "k1", "fp-a", "token-4")
+			if err != nil || saved == nil {
+				t.Fatalf("完成后 Reserve = %v, %v, want 保存的响应", saved, err)
+			}
+			if saved.StatusCode != 200 || saved.ContentType != "application/json; charset=utf-8" || string(saved.Body) != `{"code":200}` {
+				t.Errorf("保存的响应 = %d %q %q", saved.StatusCode, saved.ContentType, saved.Body)
+			}
+			if _, err := store.Reserve(1, "k1", "fp-b", "token-4"); !errors.Is(err, ErrIdempotencyKeyReused) {
+				t.Errorf("完成后用于不同请求 Reserve = %v, want ErrIdempotencyKeyReused", err)
+			}
+			// 已完成的键不能再被保存
+			if err := store.Complete(1, "k1", "token-1", completedResponse("fp-a", "token-1", `{}`), time.Hour); !errors.Is(err, ErrIdempotencyLockLost) {
+				t.Errorf("重复 Complete = %v, want ErrIdempotencyLockLost", err)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreRelease(t *testing.T) {
+	for _, backend := range idempotencyBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, _ := backend.open(t)
+
+			if _, err := store.Reserve(1, "k1", "fp-a", "token-1"); err != nil {
+				t.Fatalf("Reserve: %v", err)
+			}
+			// 不是本次占用（token 或请求不同）时不释放
+			if err := store.Release(1, "k1", "fp-a", "token-2"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if err := store.Release(1, "k1", "fp-b", "token-1"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if _, err := store.Reserve(1, "k1", "fp-a", "token-3"); !errors.Is(err, ErrIdempotencyInProgress) {
+				t.Errorf("其他占用释放后 Reserve = %v, want ErrIdempotencyInProgress", err)
+			}
+
+			// 处理失败（5xx）时释放，之后可以重试
+			if err := store.Release(1, "k1", "fp-a", "token-1"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if saved, err := store.Reserve(1, "k1", "fp-a", "token-3"); saved != nil || err != nil {
+				t.Errorf("释放后 Reserve = %v, %v, want 占用成功", saved, err)
+			}
+			// 已保存响应的键不会被释放
+			if err := store.Complete(1, "k1", "token-3", completedResponse("fp-a", "token-3", `{}`), time.Hour); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if err := store.Release(1, "k1", "fp-a", "token-3"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if saved, err := store.Reserve(1, "k1", "fp-a", "token-4"); err != nil || saved == nil {
+				t.Errorf("完成后 Release 不应删除响应，Reserve = %v, %v", saved, err)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreTakeover(t *testing.T) {
+	for _, backend := range idempotencyBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, expire := backend.open(t)
+
+			if _, err := store.Reserve(1, "k1", "fp-a", "stale"); err != nil {
+				t.Fatalf("Reserve: %v", err)
+			}
+			// 处理超过 idempotencyLockTTL，重试接管
+			expire(1, "k1")
+			if saved, err := store.Reserve(1, "k1", "fp-a", "fresh"); saved != nil || err != nil {
+				t.Fatalf("过期后 Reserve = %v, %v, want 接管", saved, err)
+			}
+
+			// 原来的请求处理完时不能覆盖或释放接管后的占用
+			if err := store.Complete(1, "k1", "stale", completedResponse("fp-a", "stale", `{"from":"stale"}`), time.Hour); !errors.Is(err, ErrIdempotencyLockLost) {
+				t.Errorf("被接管后 Complete = %v, want ErrIdempotencyLockLost", err)
+			}
+			if err := store.Release(1, "k1", "fp-a", "stale"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if _, err := store.Reserve(1, "k1", "fp-a", "other"); !errors.Is(err, ErrIdempotencyInProgress) {
+				t.Errorf("被接管后原请求的 Release 删除了新的占用，Reserve = %v", err)
+			}
+
+			if err := store.Complete(1, "k1", "fresh", completedResponse("fp-a", "fresh", `{"from":"fresh"}`), time.Hour); err != nil {
+				t.Fatalf("接管后 Complete: %v", err)
+			}
+			saved, err := store.Reserve(1, "k1", "fp-a", "other")
+			if err != nil || saved == nil || string(saved.Body) != `{"from":"fresh"}` {
+				t.Errorf("保存的响应 = %v, %v, want 接管后请求的响应", saved, err)
+			}
+
+			// 保留期过后同一个键可以用于新的请求
+			expire(1, "k1")
+			if saved, err := store.Reserve(1, "k1", "fp-b", "next"); saved != nil || err != nil {
+				t.Errorf("保留期过后 Reserve = %v, %v, want 占用成功", saved, err)
+			}
+		})
+	}
+}
+
+// MySQL 存储需要定期清理过期的键，Redis 到期自动删除
+func TestIdempotencyStorePrune(t *testing.T) {
+	store, expire := idempotencyBackends[0].open(t)
+	store.Reserve(1, "old", "fp", "token-1")
+	store.Reserve(1, "new", "fp", "token-2")
+	expire(1, "old")
+
+	if err := store.Prune(time.Now()); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	var keys []models.IdempotencyKey
+	if err := config.DB.Find(&keys).Error; err != nil {
+		t.Fatalf("读取幂等键失败: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Key != "new" {
+		t.Errorf("Prune 后剩余 %+v, want 只剩 new", keys)
+	}
+}
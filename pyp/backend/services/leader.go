@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+)
+
+// 需要选主的后台任务，每个任务单独持有租约
+const (
+	JobMatcher         = "matcher"          // 定期碰撞匹配
+	JobCleanupCodes    = "cleanup_codes"    // 清理过期碰撞码和碰撞列表
+	JobExpiredMatches  = "expired_matches"  // 处理过期的匹配记录
+	JobHotTags24h      = "hot_tags_24h"     // 刷新24小时热门标签快照、清理过期小时桶
+	JobRetention       = "retention_"       // 按保留策略归档数据，每张表一个任务（retention_<表名>）
+	JobExpiryReminder  = "expiry_reminders" // 自动续期和到期提醒
+	JobWalletReconcile = "wallet_reconcile" // 金币余额与流水对账
+	JobIdempotencyKeys = "idempotency_keys" // 清理过期的幂等键（MySQL 存储时）
+	JobMatchScores     = "match_scores"     // 刷新碰撞结果的匹配得分
+)
+
+// leaseStore 租约存储，TryAcquire 同时用于首次获取和续约
+type leaseStore interface {
+	TryAcquire(job, holder string, ttl time.Duration) (bool, error)
+	Release(job, holder string) error
+	Holder(job string) (string, time.Time, error)
+	Backend() string
+}
+
+// LeaderStatus 任务的选主状态（管理后台展示）
+type LeaderStatus struct {
+	Job       string     `json:"job"`
+	Holder    string     `json:"holder"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	IsSelf    bool       `json:"isSelf"`
+}
+
+// LeaderElector 基于租约的选主：每个实例定期尝试获取/续约各任务的租约，
+// 只有持有租约的实例执行对应的后台任务
+type LeaderElector struct {
+	id    string
+	ttl   time.Duration
+	store leaseStore
+
+	mu      sync.RWMutex
+	leading map[string]time.Time // 任务 -> 本实例租约的本地过期时间
+	jobs    map[string]bool
+}
+
+var (
+	sharedElector     *LeaderElector
+	sharedElectorOnce sync.Once
+)
+
+// Leader 获取进程内共享的选主器
+// Redis 可用时使用 Redis，否则使用 MySQL 租约表
+func Leader() *LeaderElector {
+	sharedElectorOnce.Do(func() {
+		ttl := time.Duration(config.Config.LeaderLeaseSeconds) * time.Second
+		if ttl <= 0 {
+			ttl = 30 * time.Second
+		}
+
+		var store leaseStore
+		backend := config.Config.LeaderElectionBackend
+		if backend != "mysql" && config.Redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := config.Redis.Ping(ctx).Err()
+			cancel()
+			if err == nil {
+				store = &redisLeaseStore{client: config.Redis, prefix: "collision:leader:"}
+			} else if backend == "redis" {
+				log.Printf("⚠️ Redis不可用，选主退回MySQL租约表: %v", err)
+			}
+		}
+		if store == nil {
+			store = &mysqlLeaseStore{}
+		}
+
+		sharedElector = &LeaderElector{
+			id:      config.Config.InstanceID,
+			ttl:     ttl,
+			store:   store,
+			leading: make(map[string]time.Time),
+			jobs:    make(map[string]bool),
+		}
+		log.Printf("后台任务选主已启用，实例: %s, 存储: %s, 租约: %v", sharedElector.id, store.Backend(), ttl)
+	})
+	return sharedElector
+}
+
+// InstanceID 本实例标识
+func (e *LeaderElector) InstanceID() string {
+	return e.id
+}
+
+// Backend 租约存储类型
+func (e *LeaderElector) Backend() string {
+	return e.store.Backend()
+}
+
+// Campaign 开始竞选任务的租约，每 ttl/3 尝试获取或续约一次（重复调用无副作用）
+func (e *LeaderElector) Campaign(job string) {
+	e.mu.Lock()
+	if e.jobs[job] {
+		e.mu.Unlock()
+		return
+	}
+	e.jobs[job] = true
+	e.mu.Unlock()
+
+	e.renew(job)
+	go func() {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-BackgroundContext().Done():
+				return
+			case <-ticker.C:
+				e.renew(job)
+			}
+		}
+	}()
+}
+
+// Resign 释放本实例持有的所有租约（服务关闭时调用，其他实例不必等租约过期即可接手）
+func (e *LeaderElector) Resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for job := range e.leading {
+		if err := e.store.Release(job, e.id); err != nil {
+			log.Printf("⚠️ 释放任务 %s 的租约失败: %v", job, err)
+			continue
+		}
+		delete(e.leading, job)
+		log.Printf("实例 %s 释放任务 %s 的执行权", e.id, job)
+	}
+}
+
+// renew 获取或续约租约，失败时立即放弃本地的领导身份
+func (e *LeaderElector) renew(job string) {
+	start := time.Now()
+	ok, err := e.store.TryAcquire(job, e.id, e.ttl)
+	if err != nil {
+		log.Printf("⚠️ 任务 %s 续约失败: %v", job, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, wasLeader := e.leading[job]
+	if ok {
+		// 以请求发出的时间计算本地过期时间，保证本地判断先于存储中的租约过期
+		e.leading[job] = start.Add(e.ttl)
+		if !wasLeader {
+			log.Printf("👑 实例 %s 成为任务 %s 的执行者", e.id, job)
+		}
+	} else if wasLeader {
+		delete(e.leading, job)
+		log.Printf("实例 %s 失去任务 %s 的执行权", e.id, job)
+	}
+}
+
+// IsLeader 本实例当前是否持有任务的租约
+func (e *LeaderElector) IsLeader(job string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	expiresAt, ok := e.leading[job]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Status 所有已竞选任务的当前持有者
+func (e *LeaderElector) Status() []LeaderStatus {
+	e.mu.RLock()
+	jobs := make([]string, 0, len(e.jobs))
+	for job := range e.jobs {
+		jobs = append(jobs, job)
+	}
+	e.mu.RUnlock()
+	sort.Strings(jobs)
+
+	statuses := make([]LeaderStatus, 0, len(jobs))
+	for _, job := range jobs {
+		status := LeaderStatus{Job: job}
+		holder, expiresAt, err := e.store.Holder(job)
+		if err != nil {
+			log.Printf("查询任务 %s 的租约失败: %v", job, err)
+		}
+		if holder != "" {
+			status.Holder = holder
+			status.ExpiresAt = &expiresAt
+		}
+		status.IsSelf = e.IsLeader(job)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// redisLeaseStore 基于 Redis 键过期的租约
+type redisLeaseStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// 不存在时获取，已由自己持有时续约，被其他实例持有时失败
+var redisAcquireScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if not holder then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0`)
+
+var redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (s *redisLeaseStore) Backend() string {
+	return "redis"
+}
+
+func (s *redisLeaseStore) TryAcquire(job, holder string, ttl time.Duration) (bool, error) {
+	result, err := redisAcquireScript.Run(context.Background(), s.client,
+		[]string{s.prefix + job}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (s *redisLeaseStore) Release(job, holder string) error {
+	return redisReleaseScript.Run(context.Background(), s.client, []string{s.prefix + job}, holder).Err()
+}
+
+func (s *redisLeaseStore) Holder(job string) (string, time.Time, error) {
+	ctx := context.Background()
+	holder, err := s.client.Get(ctx, s.prefix+job).Result()
+	if err == redis.Nil {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	ttl, err := s.client.PTTL(ctx, s.prefix+job).Result()
+	if err != nil {
+		return holder, time.Time{}, err
+	}
+	return holder, time.Now().Add(ttl), nil
+}
+
+// mysqlLeaseStore 基于 leader_leases 表的租约，依赖各实例时钟大致同步
+type mysqlLeaseStore struct{}
+
+func (s *mysqlLeaseStore) Backend() string {
+	return "mysql"
+}
+
+func (s *mysqlLeaseStore) TryAcquire(job, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	// 自己持有或租约已过期时更新
+	result := config.DB.Model(&models.LeaderLease{}).
+		Where("job = ? AND (holder = ? OR expires_at < ?)", job, holder, now).
+		Updates(map[string]interface{}{
+			"holder":     holder,
+			"expires_at": now.Add(ttl),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// 任务还没有租约记录时插入，并发插入只有一个成功
+	lease := models.LeaderLease{Job: job, Holder: holder, ExpiresAt: now.Add(ttl)}
+	result = config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *mysqlLeaseStore) Release(job, holder string) error {
+	return config.DB.Model(&models.LeaderLease{}).
+		Where("job = ? AND holder = ?", job, holder).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+}
+
+func (s *mysqlLeaseStore) Holder(job string) (string, time.Time, error) {
+	var lease models.LeaderLease
+	if err := config.DB.Where("job = ? AND expires_at > ?", job, time.Now()).First(&lease).Error; err != nil {
+		return "", time.Time{}, nil
+	}
+	return lease.Holder, lease.ExpiresAt, nil
+}
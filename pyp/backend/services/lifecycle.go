@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// 后台任务的生命周期：
+// 调度器执行的任务、手动触发的匹配以及匹配过程中启动的异步工作（重新计算得分、更新热门标签）都登记在 backgroundWork 中。
+// 服务关闭时先取消 BackgroundContext：调度器不再启动新任务，正在执行的匹配处理完当前这一对后停止（不会中断写入中的匹配事务），
+// 然后等待登记的工作全部结束（最多等到关闭期限），最后释放本实例持有的任务租约，让其他实例尽快接手。
+
+// ErrShuttingDown 服务正在关闭，不再启动新的后台工作
+var ErrShuttingDown = errors.New("服务正在关闭")
+
+var (
+	backgroundCtx, cancelBackground = context.WithCancel(context.Background())
+
+	backgroundMu   sync.Mutex
+	backgroundWork sync.WaitGroup
+	stopping       bool
+)
+
+// BackgroundContext 后台任务使用的 context，服务开始关闭时取消
+func BackgroundContext() context.Context {
+	return backgroundCtx
+}
+
+// startBackground 启动一项登记的后台工作，服务关闭中返回 false 且不启动
+func startBackground(fn func()) bool {
+	backgroundMu.Lock()
+	defer backgroundMu.Unlock()
+	if stopping {
+		return false
+	}
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		fn()
+	}()
+	return true
+}
+
+// goBackground 异步执行一项登记的后台工作；服务关闭中改为同步执行（调用方本身是被等待的工作，不会丢失）
+func goBackground(fn func()) {
+	if !startBackground(fn) {
+		fn()
+	}
+}
+
+// Shutdown 停止后台任务并等待正在执行的工作结束，ctx 到期时不再等待并返回 ctx 的错误
+func Shutdown(ctx context.Context) error {
+	backgroundMu.Lock()
+	stopping = true
+	backgroundMu.Unlock()
+	cancelBackground()
+
+	done := make(chan struct{})
+	go func() {
+		backgroundWork.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Println("后台任务已全部结束")
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Printf("⚠️ 等待后台任务结束超时: %v", err)
+	}
+
+	Leader().Resign()
+	return err
+}
+
+// stopped 匹配过程是否已被取消（服务关闭）
+func (s *matchSession) stopped() bool {
+	return s.ctx.Err() != nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"strconv"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// 热门标签的匹配扇出控制：
+// 单个碰撞码（或碰撞列表）、单个标签每轮匹配最多新增的匹配数有上限，候选按采样策略排序后依次匹配，
+// 超过上限的匹配进入待匹配队列（MatchBacklog），之后每轮匹配优先处理。
+
+// MatchCapsConfigKey 匹配上限在 system_configs 中的配置键
+const MatchCapsConfigKey = "match_caps"
+
+// 候选采样策略
+const (
+	MatchStrategyRecent  = "recent"  // 最近发布的优先
+	MatchStrategyNearest = "nearest" // 地区最接近的优先
+	MatchStrategyScore   = "score"   // 预估匹配得分最高的优先
+)
+
+// MatchStrategies 可用的采样策略
+var MatchStrategies = []string{MatchStrategyRecent, MatchStrategyNearest, MatchStrategyScore}
+
+// backlogBatchSize 每轮匹配最多处理的待匹配队列条数
+const backlogBatchSize = 1000
+
+// MatchCapSetting 匹配上限设置，上限为 0 表示不限制
+type MatchCapSetting struct {
+	PerCode  int    `json:"per_code"` // 单个碰撞码/碰撞列表每轮最多新增的匹配数
+	PerTag   int    `json:"per_tag"`  // 单个标签每轮最多新增的匹配数
+	Strategy string `json:"strategy"` // 候选采样策略
+}
+
+// DefaultMatchCapSetting 默认不限制，候选按最近发布排序
+var DefaultMatchCapSetting = MatchCapSetting{PerCode: 0, PerTag: 0, Strategy: MatchStrategyRecent}
+
+// Enabled 是否设置了任一上限
+func (s MatchCapSetting) Enabled() bool {
+	return s.PerCode > 0 || s.PerTag > 0
+}
+
+// LoadMatchCapSetting 从系统配置读取匹配上限设置
+func LoadMatchCapSetting() MatchCapSetting {
+	setting := DefaultMatchCapSetting
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", MatchCapsConfigKey).First(&cfg).Error; err != nil {
+		return setting
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("per_code")); err == nil && v > 0 {
+		setting.PerCode = v
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("per_tag")); err == nil && v > 0 {
+		setting.PerTag = v
+	}
+	for _, strategy := range MatchStrategies {
+		if cfg.GetValue("strategy") == strategy {
+			setting.Strategy = strategy
+		}
+	}
+	return setting
+}
+
+// matchCaps 一次匹配过程中各碰撞码、各标签已新增的匹配数
+type matchCaps struct {
+	setting  MatchCapSetting
+	perCode  map[string]int
+	perTag   map[string]int
+	deferred int // 本次推迟到待匹配队列的匹配数
+}
+
+func newMatchCaps() *matchCaps {
+	return &matchCaps{
+		setting: LoadMatchCapSetting(),
+		perCode: make(map[string]int),
+		perTag:  make(map[string]int),
+	}
+}
+
+// capKey 计数用的碰撞码标识，来自碰撞列表的按列表区分
+func (s *matchSession) capKey(code *models.CollisionCode) string {
+	if listID := s.listID(code); listID != 0 {
+		return "list:" + strconv.FormatUint(listID, 10)
+	}
+	return "code:" + strconv.FormatUint(uint64(code.ID), 10)
+}
+
+// allowMatch 双方碰撞码和这次匹配的标签是否都还没有达到上限
+func (s *matchSession) allowMatch(code1, code2 *models.CollisionCode, overlap TagOverlap) bool {
+	setting := s.caps.setting
+	if setting.PerCode > 0 && (s.caps.perCode[s.capKey(code1)] >= setting.PerCode || s.caps.perCode[s.capKey(code2)] >= setting.PerCode) {
+		return false
+	}
+	if setting.PerTag > 0 && s.caps.perTag[overlapTag(overlap)] >= setting.PerTag {
+		return false
+	}
+	return true
+}
+
+// takeMatch 记录一次新增的匹配
+func (s *matchSession) takeMatch(code1, code2 *models.CollisionCode, overlap TagOverlap) {
+	s.caps.perCode[s.capKey(code1)]++
+	s.caps.perCode[s.capKey(code2)]++
+	s.caps.perTag[overlapTag(overlap)]++
+}
+
+// deferMatch 把超过上限的匹配放入待匹配队列（模拟匹配时不写入）
+func (s *matchSession) deferMatch(code1, code2 *models.CollisionCode, overlap TagOverlap) {
+	s.caps.deferred++
+	if s.simulation != nil {
+		return
+	}
+
+	// 同一对碰撞码只排队一次，与发起方向无关
+	if s.capKey(code1) > s.capKey(code2) {
+		code1, code2 = code2, code1
+	}
+	entry := models.MatchBacklog{
+		CodeID1: code1.ID,
+		ListID1: s.listID(code1),
+		CodeID2: code2.ID,
+		ListID2: s.listID(code2),
+		Tag:     overlapTag(overlap),
+	}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		log.Printf("写入待匹配队列失败: %v", err)
+	}
+}
+
+// overlapTag 一次匹配计入标签上限的标签
+func overlapTag(overlap TagOverlap) string {
+	return models.PairKeyword(append(append([]string{}, overlap.Tags1...), overlap.Tags2...))
+}
+
+// rankCandidates 候选排序：标签重合多的优先；设置了上限时，重合数相同的按采样策略排序
+func (s *matchSession) rankCandidates(source *models.CollisionCode, candidates []*models.CollisionCode) {
+	overlaps := make(map[*models.CollisionCode]int, len(candidates))
+	for _, candidate := range candidates {
+		overlaps[candidate] = s.overlap(source, candidate).Count()
+	}
+
+	var priority map[*models.CollisionCode]float64
+	if s.caps.setting.Enabled() {
+		priority = s.strategyPriority(source, candidates)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if overlaps[a] != overlaps[b] {
+			return overlaps[a] > overlaps[b]
+		}
+		return priority[a] > priority[b]
+	})
+}
+
+// strategyPriority 按采样策略计算每个候选的优先级，数值越大越优先
+func (s *matchSession) strategyPriority(source *models.CollisionCode, candidates []*models.CollisionCode) map[*models.CollisionCode]float64 {
+	priority := make(map[*models.CollisionCode]float64, len(candidates))
+	switch s.caps.setting.Strategy {
+	case MatchStrategyNearest:
+		loadCodeUsers(append([]*models.CollisionCode{source}, candidates...))
+		for _, candidate := range candidates {
+			// 双方都有坐标时按距离排序，排在只能按地区比较的候选之前
+			if distance := codeDistance(source, candidate); distance != nil {
+				priority[candidate] = 2 + 1/(1+*distance)
+				continue
+			}
+			priority[candidate] = regionProximity(&source.User, &candidate.User)
+		}
+	case MatchStrategyScore:
+		results := make([]models.CollisionResult, len(candidates))
+		pending := make(map[uint64][]string)
+		for i, candidate := range candidates {
+			results[i] = models.CollisionResult{MatchedUserID: uint64(candidate.UserID), MatchedAt: candidate.CreatedAt}
+			pending[uint64(candidate.UserID)] = append(pending[uint64(candidate.UserID)], s.overlap(source, candidate).Tags2...)
+		}
+		scores := scoreResults(uint64(source.UserID), results, pending)
+		for i, candidate := range candidates {
+			priority[candidate] = scores[i]
+		}
+	default:
+		for _, candidate := range candidates {
+			priority[candidate] = float64(candidate.CreatedAt.Unix())
+		}
+	}
+	return priority
+}
+
+// loadCodeUsers 批量加载还没有加载发布者信息的碰撞码的发布者
+func loadCodeUsers(codes []*models.CollisionCode) {
+	var userIDs []uint
+	for _, code := range codes {
+		if code.User.ID == 0 {
+			userIDs = append(userIDs, code.UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	var users []models.User
+	config.DB.Where("id IN ?", userIDs).Find(&users)
+	userMap := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		userMap[user.ID] = user
+	}
+	for _, code := range codes {
+		if code.User.ID == 0 {
+			code.User = userMap[code.UserID]
+		}
+	}
+}
+
+// drainBacklog 优先处理待匹配队列：仍超过上限的留在队列中，其余重新判断后移出队列
+func (cm *CollisionMatcher) drainBacklog(session *matchSession) int {
+	var entries []models.MatchBacklog
+	if err := config.DB.Order("id ASC").Limit(backlogBatchSize).Find(&entries).Error; err != nil {
+		log.Printf("读取待匹配队列失败: %v", err)
+		session.recordError(err)
+		return 0
+	}
+
+	matchCount := 0
+	for _, entry := range entries {
+		if session.stopped() {
+			break // 未处理的留在队列中
+		}
+		code1 := session.backlogCode(entry.CodeID1, entry.ListID1)
+		code2 := session.backlogCode(entry.CodeID2, entry.ListID2)
+		if code1 != nil && code2 != nil && !session.allowMatch(code1, code2, session.overlap(code1, code2)) {
+			continue
+		}
+
+		config.DB.Delete(&models.MatchBacklog{}, entry.ID)
+		if code1 == nil || code2 == nil {
+			continue // 碰撞码已删除或碰撞列表已停用
+		}
+		if cm.createMatchIfNotExists(code1, code2, session) {
+			matchCount++
+		}
+	}
+	return matchCount
+}
+
+// backlogCode 加载待匹配队列中的一方
+func (s *matchSession) backlogCode(codeID uint, listID uint64) *models.CollisionCode {
+	if listID != 0 {
+		var list models.CollisionList
+		if err := config.DB.First(&list, listID).Error; err != nil || !isListMatchable(&list) {
+			return nil
+		}
+		return s.listCode(&list)
+	}
+
+	var code models.CollisionCode
+	if err := config.DB.Preload("User").First(&code, codeID).Error; err != nil || !isIndexable(&code) {
+		return nil
+	}
+	return &code
+}
+
+// BacklogSize 待匹配队列中的数量
+func BacklogSize() int64 {
+	var count int64
+	config.DB.Model(&models.MatchBacklog{}).Count(&count)
+	return count
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"collision-backend/models"
+)
+
+// capSession 不访问数据库的匹配过程：设置了 simulation，deferMatch 不写入待匹配队列
+func capSession(setting MatchCapSetting) *matchSession {
+	return &matchSession{
+		relations: &TagRelations{},
+		lists:     make(map[*models.CollisionCode]uint64),
+		caps: &matchCaps{
+			setting: setting,
+			perCode: make(map[string]int),
+			perTag:  make(map[string]int),
+		},
+		simulation: &MatchSimulation{},
+	}
+}
+
+func tagOverlap(tag string) TagOverlap {
+	return TagOverlap{MatchType: MatchTypeKeyword, Tags1: []string{tag}, Tags2: []string{tag}}
+}
+
+func TestCapKey(t *testing.T) {
+	s := capSession(MatchCapSetting{PerCode: 1})
+	code := &models.CollisionCode{ID: 12}
+	listCode := &models.CollisionCode{}
+	s.lists[listCode] = 7
+
+	if got := s.capKey(code); got != "code:12" {
+		t.Errorf("capKey(碰撞码) = %q, want code:12", got)
+	}
+	if got := s.capKey(listCode); got != "list:7" {
+		t.Errorf("capKey(碰撞列表) = %q, want list:7", got)
+	}
+}
+
+func TestOverlapTag(t *testing.T) {
+	overlap := TagOverlap{Tags1: []string{"Python", "机器学习"}, Tags2: []string{"ｐｙｔｈｏｎ", "機器學習"}}
+	if got := overlapTag(overlap); got != "python" {
+		t.Errorf("overlapTag = %q, want python", got)
+	}
+}
+
+func TestMatchCapsPerCode(t *testing.T) {
+	s := capSession(MatchCapSetting{PerCode: 2})
+	a, b, c, d := &models.CollisionCode{ID: 1}, &models.CollisionCode{ID: 2}, &models.CollisionCode{ID: 3}, &models.CollisionCode{ID: 4}
+	overlap := tagOverlap("python")
+
+	for _, other := range []*models.CollisionCode{b, c} {
+		if !s.allowMatch(a, other, overlap) {
+			t.Fatalf("第 %d 个匹配前 allowMatch = false", other.ID-1)
+		}
+		s.takeMatch(a, other, overlap)
+	}
+	if s.allowMatch(a, d, overlap) {
+		t.Error("a 已有 2 个匹配，allowMatch(a, d) = true, want false")
+	}
+	if s.allowMatch(d, a, overlap) {
+		t.Error("上限双向检查，allowMatch(d, a) = true, want false")
+	}
+	if !s.allowMatch(b, d, overlap) {
+		t.Error("b 只有 1 个匹配，allowMatch(b, d) = false, want true")
+	}
+	if got := s.caps.perCode["code:1"]; got != 2 {
+		t.Errorf("perCode[code:1] = %d, want 2", got)
+	}
+	// PerTag 为 0 时只计数不限制
+	if got := s.caps.perTag["python"]; got != 2 {
+		t.Errorf("perTag[python] = %d, want 2", got)
+	}
+}
+
+func TestMatchCapsPerList(t *testing.T) {
+	s := capSession(MatchCapSetting{PerCode: 2})
+	// 同一碰撞列表每次转换出的碰撞码共用一个计数
+	list1, list2 := &models.CollisionCode{}, &models.CollisionCode{}
+	s.lists[list1], s.lists[list2] = 9, 9
+	b, c, d := &models.CollisionCode{ID: 2}, &models.CollisionCode{ID: 3}, &models.CollisionCode{ID: 4}
+	overlap := tagOverlap("python")
+
+	s.takeMatch(list1, b, overlap)
+	s.takeMatch(list2, c, overlap)
+	if s.allowMatch(list1, d, overlap) {
+		t.Error("碰撞列表已有 2 个匹配，allowMatch = true, want false")
+	}
+}
+
+func TestMatchCapsPerTag(t *testing.T) {
+	s := capSession(MatchCapSetting{PerTag: 2})
+	python, golang := tagOverlap("Python"), tagOverlap("go")
+	codes := make([]*models.CollisionCode, 6)
+	for i := range codes {
+		codes[i] = &models.CollisionCode{ID: uint(i + 1)}
+	}
+
+	s.takeMatch(codes[0], codes[1], python)
+	s.takeMatch(codes[2], codes[3], python)
+	if s.allowMatch(codes[4], codes[5], tagOverlap("ｐｙｔｈｏｎ")) {
+		t.Error("python 已有 2 个匹配，allowMatch = true, want false")
+	}
+	if !s.allowMatch(codes[4], codes[5], golang) {
+		t.Error("go 没有匹配，allowMatch = false, want true")
+	}
+}
+
+func TestMatchCapsUnlimited(t *testing.T) {
+	s := capSession(DefaultMatchCapSetting)
+	a, b := &models.CollisionCode{ID: 1}, &models.CollisionCode{ID: 2}
+	for i := 0; i < 100; i++ {
+		s.takeMatch(a, b, tagOverlap("python"))
+	}
+	if !s.allowMatch(a, b, tagOverlap("python")) {
+		t.Error("未设置上限时 allowMatch = false, want true")
+	}
+}
+
+func TestDeferMatchCounts(t *testing.T) {
+	s := capSession(MatchCapSetting{PerCode: 1})
+	a, b := &models.CollisionCode{ID: 1}, &models.CollisionCode{ID: 2}
+	s.deferMatch(a, b, tagOverlap("python"))
+	s.deferMatch(b, a, tagOverlap("python"))
+	if s.caps.deferred != 2 {
+		t.Errorf("deferred = %d, want 2", s.caps.deferred)
+	}
+	// 推迟的匹配不占用上限
+	if s.caps.perCode["code:1"] != 0 || s.caps.perTag["python"] != 0 {
+		t.Errorf("deferMatch 不应计入上限: perCode=%v perTag=%v", s.caps.perCode, s.caps.perTag)
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	now := time.Now()
+	source := &models.CollisionCode{ID: 1, Tags: "a,b", TagsCanonical: "a,b"}
+	candidate := func(id uint, tags string, age time.Duration) *models.CollisionCode {
+		return &models.CollisionCode{ID: id, Tags: tags, TagsCanonical: tags, CreatedAt: now.Add(-age)}
+	}
+	order := func(candidates []*models.CollisionCode) []uint {
+		ids := make([]uint, len(candidates))
+		for i, c := range candidates {
+			ids[i] = c.ID
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name    string
+		setting MatchCapSetting
+		want    []uint
+	}{
+		// 未设置上限时只按重合数排序，重合数相同的保持原顺序
+		{"不限制", DefaultMatchCapSetting, []uint{3, 2, 4, 5}},
+		// 设置了上限时重合数相同的按最近发布排序
+		{"最近发布优先", MatchCapSetting{PerCode: 1, Strategy: MatchStrategyRecent}, []uint{3, 4, 2, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := []*models.CollisionCode{
+				candidate(2, "a", 2*time.Hour),
+				candidate(3, "a,b", 3*time.Hour),
+				candidate(4, "b,c", time.Hour),
+				candidate(5, "c", 0),
+			}
+			s := capSession(tt.setting)
+			s.rankCandidates(source, candidates)
+			if got := order(candidates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankCandidates = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// MatchDedupStats 匹配去重统计
+type MatchDedupStats struct {
+	RecordsRemoved int // 删除的重复碰撞记录
+	ResultsRemoved int // 删除的重复碰撞结果
+	KeysFilled     int // 补齐匹配对唯一键的记录和结果
+	CodesRecounted int // 修正 match_count 的碰撞码
+	ListsRecounted int // 修正 match_count 的碰撞列表
+}
+
+// DedupMatches 合并同一对用户同一关键词的重复碰撞记录和碰撞结果，补齐 pair_key，并按碰撞结果重新统计匹配数量
+// 唯一索引上线前产生的重复数据只能通过这里清理；dryRun 为 true 时只统计不写入
+func DedupMatches(dryRun bool) (MatchDedupStats, error) {
+	var stats MatchDedupStats
+
+	if err := dedupRecords(dryRun, &stats); err != nil {
+		return stats, err
+	}
+	if err := dedupResults(dryRun, &stats); err != nil {
+		return stats, err
+	}
+	if err := recountListMatches(dryRun, &stats); err != nil {
+		return stats, err
+	}
+	if err := recountCodeMatches(dryRun, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// legacyPairKey 已有数据的匹配对唯一键
+// 旧数据只有自己一方的关键词，同义词/模糊匹配出现之前双方关键词相同，与新匹配生成的键一致
+func legacyPairKey(pairKey *string, userID1, userID2 uint64, keyword, matchedTags string) string {
+	if pairKey != nil {
+		return *pairKey
+	}
+	tags := []string{keyword}
+	if matchedTags != "" {
+		tags = strings.Split(matchedTags, ",")
+	}
+	return models.MatchPairKey(userID1, userID2, tags)
+}
+
+// dedupRecords 碰撞记录按 (pair_key, user_id1) 去重，保留最早的一条，已加好友的状态优先
+// 包含软删除的记录（唯一索引同样覆盖它们），海底捞产生的记录不参与
+func dedupRecords(dryRun bool, stats *MatchDedupStats) error {
+	var records []models.CollisionRecord
+	if err := config.DB.Unscoped().Where("match_type != ?", "haidilao").Order("id ASC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	groups := make(map[string][]*models.CollisionRecord)
+	var order []string
+	for i := range records {
+		r := &records[i]
+		key := legacyPairKey(r.PairKey, uint64(r.UserID1), uint64(r.UserID2), r.Tag, r.MatchedTags)
+		groupKey := key + "|" + strconv.FormatUint(uint64(r.UserID1), 10)
+		if _, ok := groups[groupKey]; !ok {
+			order = append(order, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], r)
+		if r.PairKey == nil {
+			r.PairKey = &key
+			stats.KeysFilled++
+		}
+	}
+
+	for _, groupKey := range order {
+		group := groups[groupKey]
+		keep, duplicates := group[0], group[1:]
+		for _, dup := range duplicates {
+			if dup.Status == "friend_added" {
+				keep.Status = dup.Status
+			}
+			if dup.EmailSent && !keep.EmailSent {
+				keep.EmailSent, keep.EmailSentAt, keep.EmailStatus = true, dup.EmailSentAt, dup.EmailStatus
+			}
+		}
+		stats.RecordsRemoved += len(duplicates)
+		if dryRun {
+			continue
+		}
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			ids := make([]uint, 0, len(duplicates))
+			for _, dup := range duplicates {
+				ids = append(ids, dup.ID)
+			}
+			if len(ids) > 0 {
+				if err := tx.Unscoped().Delete(&models.CollisionRecord{}, ids).Error; err != nil {
+					return err
+				}
+			}
+			// UpdateColumns 不刷新 updated_at
+			return tx.Unscoped().Model(&models.CollisionRecord{}).Where("id = ?", keep.ID).
+				UpdateColumns(map[string]interface{}{
+					"pair_key":      *keep.PairKey,
+					"status":        keep.Status,
+					"email_sent":    keep.EmailSent,
+					"email_sent_at": keep.EmailSentAt,
+					"email_status":  keep.EmailStatus,
+				}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dedupResults 碰撞结果按 (pair_key, user_id) 去重，保留最早的一条并合并用户的备注、已知标记和邮件发送状态
+func dedupResults(dryRun bool, stats *MatchDedupStats) error {
+	var results []models.CollisionResult
+	if err := config.DB.Order("id ASC").Find(&results).Error; err != nil {
+		return err
+	}
+
+	groups := make(map[string][]*models.CollisionResult)
+	var order []string
+	for i := range results {
+		r := &results[i]
+		key := legacyPairKey(r.PairKey, r.UserID, r.MatchedUserID, r.Keyword, r.MatchedTags)
+		groupKey := key + "|" + strconv.FormatUint(r.UserID, 10)
+		if _, ok := groups[groupKey]; !ok {
+			order = append(order, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], r)
+		if r.PairKey == nil {
+			r.PairKey = &key
+			stats.KeysFilled++
+		}
+	}
+
+	for _, groupKey := range order {
+		group := groups[groupKey]
+		keep, duplicates := group[0], group[1:]
+		for _, dup := range duplicates {
+			if keep.CollisionListID == 0 {
+				keep.CollisionListID = dup.CollisionListID
+			}
+			if keep.MatchedEmail == "" {
+				keep.MatchedEmail = dup.MatchedEmail
+			}
+			if keep.Remark == "" {
+				keep.Remark = dup.Remark
+			}
+			keep.IsKnown = keep.IsKnown || dup.IsKnown
+			if dup.EmailSent && !keep.EmailSent {
+				keep.EmailSent, keep.EmailSentAt = true, dup.EmailSentAt
+			}
+		}
+		stats.ResultsRemoved += len(duplicates)
+		if dryRun {
+			continue
+		}
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			ids := make([]uint64, 0, len(duplicates))
+			for _, dup := range duplicates {
+				ids = append(ids, dup.ID)
+			}
+			if len(ids) > 0 {
+				if err := tx.Delete(&models.CollisionResult{}, ids).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&models.CollisionResult{}).Where("id = ?", keep.ID).
+				UpdateColumns(map[string]interface{}{
+					"pair_key":          *keep.PairKey,
+					"collision_list_id": keep.CollisionListID,
+					"matched_email":     keep.MatchedEmail,
+					"remark":            keep.Remark,
+					"is_known":          keep.IsKnown,
+					"email_sent":        keep.EmailSent,
+					"email_sent_at":     keep.EmailSentAt,
+				}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recountListMatches 碰撞列表的匹配数量 = 由该列表产生的碰撞结果数
+func recountListMatches(dryRun bool, stats *MatchDedupStats) error {
+	var rows []struct {
+		CollisionListID uint64
+		Total           int
+	}
+	if err := config.DB.Model(&models.CollisionResult{}).
+		Select("collision_list_id, COUNT(*) AS total").
+		Where("collision_list_id > 0").
+		Group("collision_list_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	counts := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		counts[row.CollisionListID] = row.Total
+	}
+
+	var lists []models.CollisionList
+	if err := config.DB.Select("id", "match_count").Find(&lists).Error; err != nil {
+		return err
+	}
+	for _, list := range lists {
+		if list.MatchCount == counts[list.ID] {
+			continue
+		}
+		stats.ListsRecounted++
+		if dryRun {
+			continue
+		}
+		if err := config.DB.Model(&models.CollisionList{}).Where("id = ?", list.ID).
+			UpdateColumn("match_count", counts[list.ID]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recountCodeMatches 碰撞码的匹配数量 = 发布之后由碰撞码（非列表）产生、关键词属于该碰撞码标签的碰撞结果数
+// 碰撞结果不记录来源碰撞码，同一用户有多个相同标签的碰撞码时会各自计入
+func recountCodeMatches(dryRun bool, stats *MatchDedupStats) error {
+	var codes []models.CollisionCode
+	return config.DB.Select("id", "user_id", "tag", "tags", "tag_canonical", "tags_canonical", "match_count", "created_at").
+		FindInBatches(&codes, 500, func(tx *gorm.DB, batch int) error {
+			for _, code := range codes {
+				var total int64
+				if err := config.DB.Model(&models.CollisionResult{}).
+					Where("user_id = ? AND collision_list_id = 0 AND keyword_canonical IN ? AND matched_at >= ?",
+						uint64(code.UserID), code.CanonicalTags(), code.CreatedAt).
+					Count(&total).Error; err != nil {
+					return err
+				}
+				if int64(code.MatchCount) == total {
+					continue
+				}
+				stats.CodesRecounted++
+				if dryRun {
+					continue
+				}
+				if err := config.DB.Model(&models.CollisionCode{}).Where("id = ?", code.ID).
+					UpdateColumn("match_count", total).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"collision-backend/geo"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 按距离匹配：
+// 碰撞码设置了 RadiusKm 时，对方碰撞码的发布位置必须在该距离内（双向检查，双方各自的距离范围都要满足），
+// 任一方没有坐标时无法判断距离，不匹配；没有设置距离的碰撞码仍按地区规则匹配。
+
+// MaxMatchRadiusKm 碰撞码可设置的最大匹配距离
+const MaxMatchRadiusKm = 500
+
+// codeDistance 两个碰撞码发布位置的距离（公里，保留两位小数），任一方没有坐标时返回 nil
+func codeDistance(code1, code2 *models.CollisionCode) *float64 {
+	lat1, lng1, ok1 := code1.Coordinates()
+	lat2, lng2, ok2 := code2.Coordinates()
+	if !ok1 || !ok2 {
+		return nil
+	}
+	distance := math.Round(geo.Distance(lat1, lng1, lat2, lng2)*100) / 100
+	return &distance
+}
+
+// withinRadius 双方设置的距离范围是否都包含对方
+func withinRadius(code1, code2 *models.CollisionCode, distance *float64) bool {
+	for _, code := range []*models.CollisionCode{code1, code2} {
+		if code.RadiusKm <= 0 {
+			continue
+		}
+		if distance == nil || *distance > code.RadiusKm {
+			return false
+		}
+	}
+	return true
+}
+
+// NearbyScope 按 geohash 前缀粗筛 (lat, lng) 附近 radiusKm 以内的碰撞码，结果需再用 WithinDistance 精确过滤
+func NearbyScope(lat, lng, radiusKm float64) func(*gorm.DB) *gorm.DB {
+	prefixes := geo.CoverPrefixes(lat, lng, radiusKm)
+	conds := make([]string, 0, len(prefixes))
+	args := make([]interface{}, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		conds = append(conds, "collision_codes.geohash LIKE ?")
+		args = append(args, prefix+"%")
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(strings.Join(conds, " OR "), args...)
+	}
+}
+
+// WithinDistance 保留距离 (lat, lng) 不超过 radiusKm 的碰撞码，按距离由近到远排序，同时返回各自的距离
+func WithinDistance(codes []models.CollisionCode, lat, lng, radiusKm float64) ([]models.CollisionCode, []float64) {
+	center := models.CollisionCode{Latitude: &lat, Longitude: &lng}
+	type nearby struct {
+		code     models.CollisionCode
+		distance float64
+	}
+	var found []nearby
+	for i := range codes {
+		distance := codeDistance(&center, &codes[i])
+		if distance != nil && *distance <= radiusKm {
+			found = append(found, nearby{codes[i], *distance})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+
+	result := make([]models.CollisionCode, len(found))
+	distances := make([]float64, len(found))
+	for i, n := range found {
+		result[i], distances[i] = n.code, n.distance
+	}
+	return result, distances
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+
+	"collision-backend/models"
+)
+
+func codeAt(lat, lng, radiusKm float64) *models.CollisionCode {
+	return &models.CollisionCode{Latitude: &lat, Longitude: &lng, RadiusKm: radiusKm}
+}
+
+func TestWithinRadius(t *testing.T) {
+	distance := func(d float64) *float64 { return &d }
+	tests := []struct {
+		name     string
+		radius1  float64
+		radius2  float64
+		distance *float64
+		want     bool
+	}{
+		{"双方都不限距离", 0, 0, nil, true},
+		{"不限距离时不需要坐标", 0, 0, distance(1000), true},
+		{"一方限距离且在范围内", 10, 0, distance(9.99), true},
+		{"恰好在边界上", 10, 0, distance(10), true},
+		{"一方限距离且超出", 10, 0, distance(10.01), false},
+		{"另一方限距离且超出", 0, 5, distance(6), false},
+		{"双方都限距离，只满足一方", 10, 5, distance(6), false},
+		{"双方都限距离且都满足", 10, 5, distance(4), true},
+		{"限距离但没有坐标", 10, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code1 := &models.CollisionCode{RadiusKm: tt.radius1}
+			code2 := &models.CollisionCode{RadiusKm: tt.radius2}
+			if got := withinRadius(code1, code2, tt.distance); got != tt.want {
+				t.Errorf("withinRadius = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeDistance(t *testing.T) {
+	if d := codeDistance(codeAt(0, 0, 0), &models.CollisionCode{}); d != nil {
+		t.Errorf("一方没有坐标时 codeDistance = %v, want nil", *d)
+	}
+	// 赤道上经度相差 1° 约 111.19 公里，保留两位小数
+	if d := codeDistance(codeAt(0, 0, 0), codeAt(0, 1, 0)); d == nil || *d != 111.19 {
+		t.Errorf("codeDistance = %v, want 111.19", d)
+	}
+}
+
+func TestWithinDistance(t *testing.T) {
+	codes := []models.CollisionCode{
+		*codeAt(0, 0.05, 0), // 约 5.56 公里
+		{},                  // 没有坐标
+		*codeAt(0, 0.2, 0),  // 约 22.24 公里
+		*codeAt(0, 0.01, 0), // 约 1.11 公里
+	}
+	for i := range codes {
+		codes[i].ID = uint(i + 1)
+	}
+
+	found, distances := WithinDistance(codes, 0, 0, 10)
+	if len(found) != 2 || len(distances) != 2 {
+		t.Fatalf("WithinDistance 返回 %d 个，want 2", len(found))
+	}
+	if found[0].ID != 4 || found[1].ID != 1 {
+		t.Errorf("WithinDistance 顺序 = [%d %d], want [4 1]", found[0].ID, found[1].ID)
+	}
+	if distances[0] != 1.11 || distances[1] != 5.56 {
+		t.Errorf("WithinDistance 距离 = %v, want [1.11 5.56]", distances)
+	}
+}
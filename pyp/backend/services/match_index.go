@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// indexEntry 倒排索引中的一条碰撞码记录
+type indexEntry struct {
+	CodeID uint
+	UserID uint
+}
+
+// TagIndex 标签（规范形式） -> 活跃碰撞码 的倒排索引
+// 组合碰撞码在它的每个标签下各有一条记录
+//
+// 索引只用于缩小候选范围，候选碰撞码仍会从数据库重新加载，
+// 因此索引中残留的已删除/已失效条目不会产生错误匹配。
+type TagIndex interface {
+	Add(tag string, codeID, userID uint) error
+	Remove(tag string, codeID uint) error
+	Lookup(tag string) ([]indexEntry, error)
+	Tags() ([]string, error)
+	Rebuild(codes []models.CollisionCode) error
+	Backend() string
+}
+
+var (
+	sharedIndex     TagIndex
+	sharedIndexOnce sync.Once
+)
+
+// matchIndex 获取进程内共享的倒排索引
+// Redis 可用时使用 Redis（多实例共享），否则退回进程内存
+func matchIndex() TagIndex {
+	sharedIndexOnce.Do(func() {
+		backend := config.Config.MatchIndexBackend
+		if backend != "memory" && config.Redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := config.Redis.Ping(ctx).Err()
+			cancel()
+			if err == nil {
+				sharedIndex = &redisTagIndex{client: config.Redis, prefix: "collision:tag_index:"}
+			} else if backend == "redis" {
+				log.Printf("⚠️ Redis不可用，碰撞码索引退回内存模式: %v", err)
+			}
+		}
+		if sharedIndex == nil {
+			sharedIndex = newMemoryTagIndex()
+		}
+		log.Printf("碰撞码倒排索引已启用，存储: %s", sharedIndex.Backend())
+	})
+	return sharedIndex
+}
+
+// isIndexable 判断碰撞码是否应进入倒排索引（待审核、审核拒绝的不进入，审核通过后重新加入）
+func isIndexable(code *models.CollisionCode) bool {
+	return code.TagCanonical != "" && code.Status != "invalid" && !code.DeletedAt.Valid && isAuditApproved(code)
+}
+
+// memoryTagIndex 进程内倒排索引
+type memoryTagIndex struct {
+	mu   sync.RWMutex
+	tags map[string]map[uint]uint // tag -> codeID -> userID
+}
+
+func newMemoryTagIndex() *memoryTagIndex {
+	return &memoryTagIndex{tags: make(map[string]map[uint]uint)}
+}
+
+func (idx *memoryTagIndex) Backend() string {
+	return "memory"
+}
+
+func (idx *memoryTagIndex) Add(tag string, codeID, userID uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	codes, ok := idx.tags[tag]
+	if !ok {
+		codes = make(map[uint]uint)
+		idx.tags[tag] = codes
+	}
+	codes[codeID] = userID
+	return nil
+}
+
+func (idx *memoryTagIndex) Remove(tag string, codeID uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if codes, ok := idx.tags[tag]; ok {
+		delete(codes, codeID)
+		if len(codes) == 0 {
+			delete(idx.tags, tag)
+		}
+	}
+	return nil
+}
+
+func (idx *memoryTagIndex) Lookup(tag string) ([]indexEntry, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	codes := idx.tags[tag]
+	entries := make([]indexEntry, 0, len(codes))
+	for codeID, userID := range codes {
+		entries = append(entries, indexEntry{CodeID: codeID, UserID: userID})
+	}
+	return entries, nil
+}
+
+func (idx *memoryTagIndex) Tags() ([]string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	tags := make([]string, 0, len(idx.tags))
+	for tag := range idx.tags {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (idx *memoryTagIndex) Rebuild(codes []models.CollisionCode) error {
+	tags := make(map[string]map[uint]uint)
+	for i := range codes {
+		if !isIndexable(&codes[i]) {
+			continue
+		}
+		for _, tag := range codes[i].CanonicalTags() {
+			if tags[tag] == nil {
+				tags[tag] = make(map[uint]uint)
+			}
+			tags[tag][codes[i].ID] = codes[i].UserID
+		}
+	}
+
+	idx.mu.Lock()
+	idx.tags = tags
+	idx.mu.Unlock()
+	return nil
+}
+
+// redisTagIndex 基于 Redis Hash 的倒排索引，每个标签一个 Hash（field=碰撞码ID, value=用户ID）
+type redisTagIndex struct {
+	client *redis.Client
+	prefix string
+}
+
+func (idx *redisTagIndex) Backend() string {
+	return "redis"
+}
+
+func (idx *redisTagIndex) key(tag string) string {
+	return idx.prefix + tag
+}
+
+func (idx *redisTagIndex) Add(tag string, codeID, userID uint) error {
+	return idx.client.HSet(context.Background(), idx.key(tag), strconv.FormatUint(uint64(codeID), 10), userID).Err()
+}
+
+func (idx *redisTagIndex) Remove(tag string, codeID uint) error {
+	return idx.client.HDel(context.Background(), idx.key(tag), strconv.FormatUint(uint64(codeID), 10)).Err()
+}
+
+func (idx *redisTagIndex) Lookup(tag string) ([]indexEntry, error) {
+	values, err := idx.client.HGetAll(context.Background(), idx.key(tag)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]indexEntry, 0, len(values))
+	for field, value := range values {
+		codeID, err1 := strconv.ParseUint(field, 10, 64)
+		userID, err2 := strconv.ParseUint(value, 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		entries = append(entries, indexEntry{CodeID: uint(codeID), UserID: uint(userID)})
+	}
+	return entries, nil
+}
+
+func (idx *redisTagIndex) Tags() ([]string, error) {
+	ctx := context.Background()
+
+	var tags []string
+	var cursor uint64
+	for {
+		keys, next, err := idx.client.Scan(ctx, cursor, idx.prefix+"*", 500).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			tags = append(tags, strings.TrimPrefix(key, idx.prefix))
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	return tags, nil
+}
+
+func (idx *redisTagIndex) Rebuild(codes []models.CollisionCode) error {
+	ctx := context.Background()
+
+	tags := make(map[string]map[string]interface{})
+	for i := range codes {
+		if !isIndexable(&codes[i]) {
+			continue
+		}
+		for _, tag := range codes[i].CanonicalTags() {
+			if tags[tag] == nil {
+				tags[tag] = make(map[string]interface{})
+			}
+			tags[tag][strconv.FormatUint(uint64(codes[i].ID), 10)] = codes[i].UserID
+		}
+	}
+
+	// 逐个标签原子替换，避免重建期间出现空索引
+	for tag, fields := range tags {
+		key := idx.key(tag)
+		if _, err := idx.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key, fields)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	// 删除已经没有活跃碰撞码的标签
+	var cursor uint64
+	for {
+		keys, next, err := idx.client.Scan(ctx, cursor, idx.prefix+"*", 500).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, ok := tags[strings.TrimPrefix(key, idx.prefix)]; !ok {
+				idx.client.Del(ctx, key)
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// 匹配模式：
+// 每个碰撞码、碰撞列表选择一种匹配模式（match_mode），由对应的匹配策略决定接受哪些标签关联类型、是否检查地区、
+// 是否必须按距离匹配；双方模式不同时两边的要求都要满足。小程序中不同的产品可以使用不同的碰撞语义，不需要修改匹配器。
+// 管理员可以启用/停用模式，停用只影响新的提交，已提交的碰撞码仍按原来的模式匹配。
+
+// MatchModesConfigKey 启用的匹配模式在 system_configs 中的配置键
+const MatchModesConfigKey = "match_modes"
+
+// 匹配模式
+const (
+	MatchModeExact            = "exact"             // 标签规范形式完全相同，不使用同义词和模糊匹配；地区双向匹配
+	MatchModeRegionReciprocal = "region_reciprocal" // 标签相同或同义（开启模糊匹配时包括模糊相近）；地区双向匹配
+	MatchModeFuzzy            = "fuzzy"             // 总是接受模糊相近的标签（不受模糊匹配开关影响）；地区双向匹配
+	MatchModeGeo              = "geo"               // 必须有发布位置并设置距离范围，按距离匹配，不检查地区
+)
+
+// DefaultMatchMode 未指定模式时使用，与引入匹配模式之前的行为相同，始终可用
+const DefaultMatchMode = MatchModeRegionReciprocal
+
+var (
+	ErrUnknownMatchMode  = errors.New("未知的匹配模式")
+	ErrMatchModeDisabled = errors.New("匹配模式未启用")
+)
+
+// MatchStrategy 匹配模式对应的匹配策略
+type MatchStrategy interface {
+	Name() string
+	Description() string
+	// MatchTypes 接受的标签关联类型（keyword/synonym/fuzzy）
+	MatchTypes(relations *TagRelations) []string
+	// ChecksRegion 地区规则是否检查该碰撞码的搜索区域
+	ChecksRegion() bool
+	// Validate 提交时检查碰撞码是否满足该模式的要求
+	Validate(code *models.CollisionCode) error
+	// Accept 匹配时该方对这次匹配的额外要求，distance 为双方发布位置的距离（任一方没有坐标时为 nil）
+	Accept(code *models.CollisionCode, distance *float64) bool
+}
+
+// matchStrategyRegistry 可用的匹配策略
+var matchStrategyRegistry = map[string]MatchStrategy{
+	MatchModeExact:            exactStrategy{},
+	MatchModeRegionReciprocal: regionReciprocalStrategy{},
+	MatchModeFuzzy:            fuzzyStrategy{},
+	MatchModeGeo:              geoStrategy{},
+}
+
+// matchModeOrder 匹配模式的展示顺序
+var matchModeOrder = []string{MatchModeExact, MatchModeRegionReciprocal, MatchModeFuzzy, MatchModeGeo}
+
+// AvailableMatchModes 返回所有已注册的匹配模式
+func AvailableMatchModes() []MatchStrategy {
+	strategies := make([]MatchStrategy, 0, len(matchStrategyRegistry))
+	for _, mode := range matchModeOrder {
+		if strategy, ok := matchStrategyRegistry[mode]; ok {
+			strategies = append(strategies, strategy)
+		}
+	}
+	return strategies
+}
+
+// NormalizeMatchMode 统一模式名写法（region-reciprocal 与 region_reciprocal 相同），为空时为默认模式
+func NormalizeMatchMode(mode string) string {
+	mode = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(mode)), "-", "_")
+	if mode == "" {
+		return DefaultMatchMode
+	}
+	return mode
+}
+
+// IsKnownMatchMode 是否为已注册的匹配模式
+func IsKnownMatchMode(mode string) bool {
+	_, ok := matchStrategyRegistry[NormalizeMatchMode(mode)]
+	return ok
+}
+
+// matchStrategy 碰撞码的匹配策略，未知或为空的模式按默认模式处理
+func matchStrategy(mode string) MatchStrategy {
+	if strategy, ok := matchStrategyRegistry[NormalizeMatchMode(mode)]; ok {
+		return strategy
+	}
+	return matchStrategyRegistry[DefaultMatchMode]
+}
+
+// EnabledMatchModes 读取系统配置中启用的匹配模式，未配置时启用全部模式；默认模式始终启用
+func EnabledMatchModes() []string {
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", MatchModesConfigKey).First(&cfg).Error; err != nil || cfg.GetValue("modes") == "" {
+		return append([]string{}, matchModeOrder...)
+	}
+
+	enabled := map[string]bool{DefaultMatchMode: true}
+	for _, mode := range strings.Split(cfg.GetValue("modes"), ",") {
+		enabled[NormalizeMatchMode(mode)] = true
+	}
+	modes := []string{}
+	for _, mode := range matchModeOrder {
+		if enabled[mode] {
+			modes = append(modes, mode)
+		}
+	}
+	return modes
+}
+
+// ResolveMatchMode 提交碰撞码/碰撞列表时检查匹配模式：必须是已注册且已启用的模式，并满足该模式的要求
+// code 只需要填写模式要求检查的字段（发布位置、距离范围），返回统一写法后的模式名
+func ResolveMatchMode(mode string, code *models.CollisionCode) (string, error) {
+	mode = NormalizeMatchMode(mode)
+	strategy, ok := matchStrategyRegistry[mode]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownMatchMode, mode)
+	}
+
+	enabled := false
+	for _, m := range EnabledMatchModes() {
+		if m == mode {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return "", fmt.Errorf("%w: %s", ErrMatchModeDisabled, mode)
+	}
+
+	if err := strategy.Validate(code); err != nil {
+		return "", err
+	}
+	return mode, nil
+}
+
+// pairMatchTypes 双方匹配模式都接受的标签关联类型
+func (s *matchSession) pairMatchTypes(code1, code2 *models.CollisionCode) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, t := range matchStrategy(code1.MatchMode).MatchTypes(s.relations) {
+		accepted[t] = true
+	}
+	types := make(map[string]bool, len(accepted))
+	for _, t := range matchStrategy(code2.MatchMode).MatchTypes(s.relations) {
+		if accepted[t] {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// overlap 按双方匹配模式都接受的关联类型计算标签重合
+func (s *matchSession) overlap(code1, code2 *models.CollisionCode) TagOverlap {
+	return s.relations.OverlapWith(code1, code2, s.pairMatchTypes(code1, code2))
+}
+
+// modesAccept 双方匹配模式的额外要求是否都满足
+func modesAccept(code1, code2 *models.CollisionCode, distance *float64) bool {
+	return matchStrategy(code1.MatchMode).Accept(code1, distance) && matchStrategy(code2.MatchMode).Accept(code2, distance)
+}
+
+// defaultMatchTypes 标签相同或同义，开启模糊匹配时包括模糊相近
+func defaultMatchTypes(relations *TagRelations) []string {
+	if relations.FuzzyEnabled() {
+		return []string{MatchTypeKeyword, MatchTypeSynonym, MatchTypeFuzzy}
+	}
+	return []string{MatchTypeKeyword, MatchTypeSynonym}
+}
+
+// exactStrategy 标签完全相同
+type exactStrategy struct{}
+
+func (exactStrategy) Name() string { return MatchModeExact }
+func (exactStrategy) Description() string {
+	return "标签完全相同才匹配，不使用同义词和模糊匹配"
+}
+
+func (exactStrategy) MatchTypes(*TagRelations) []string {
+	return []string{MatchTypeKeyword}
+}
+
+func (exactStrategy) ChecksRegion() bool                          { return true }
+func (exactStrategy) Validate(*models.CollisionCode) error        { return nil }
+func (exactStrategy) Accept(*models.CollisionCode, *float64) bool { return true }
+
+// regionReciprocalStrategy 默认模式：标签相同或同义，双方的搜索区域互相包含对方地址
+type regionReciprocalStrategy struct{}
+
+func (regionReciprocalStrategy) Name() string { return MatchModeRegionReciprocal }
+func (regionReciprocalStrategy) Description() string {
+	return "标签相同或同义（开启模糊匹配时包括模糊相近），双方的搜索地区互相包含对方地址"
+}
+
+func (regionReciprocalStrategy) MatchTypes(relations *TagRelations) []string {
+	return defaultMatchTypes(relations)
+}
+
+func (regionReciprocalStrategy) ChecksRegion() bool                          { return true }
+func (regionReciprocalStrategy) Validate(*models.CollisionCode) error        { return nil }
+func (regionReciprocalStrategy) Accept(*models.CollisionCode, *float64) bool { return true }
+
+// fuzzyStrategy 总是接受模糊相近的标签
+type fuzzyStrategy struct{}
+
+func (fuzzyStrategy) Name() string { return MatchModeFuzzy }
+func (fuzzyStrategy) Description() string {
+	return "标签相同、同义或模糊相近都匹配（不受模糊匹配开关影响，阈值使用模糊匹配设置）"
+}
+
+func (fuzzyStrategy) MatchTypes(*TagRelations) []string {
+	return []string{MatchTypeKeyword, MatchTypeSynonym, MatchTypeFuzzy}
+}
+
+func (fuzzyStrategy) ChecksRegion() bool                          { return true }
+func (fuzzyStrategy) Validate(*models.CollisionCode) error        { return nil }
+func (fuzzyStrategy) Accept(*models.CollisionCode, *float64) bool { return true }
+
+// geoStrategy 按距离匹配：必须有发布位置和距离范围，对方必须在范围内，不检查地区
+type geoStrategy struct{}
+
+func (geoStrategy) Name() string { return MatchModeGeo }
+func (geoStrategy) Description() string {
+	return "按发布位置的距离匹配，需要坐标和距离范围，对方没有坐标时不匹配，不检查地区"
+}
+
+func (geoStrategy) MatchTypes(relations *TagRelations) []string {
+	return defaultMatchTypes(relations)
+}
+
+func (geoStrategy) ChecksRegion() bool { return false }
+
+func (geoStrategy) Validate(code *models.CollisionCode) error {
+	if _, _, ok := code.Coordinates(); !ok || code.RadiusKm <= 0 {
+		return errors.New("按距离匹配模式需要发布位置坐标和距离范围")
+	}
+	return nil
+}
+
+func (geoStrategy) Accept(code *models.CollisionCode, distance *float64) bool {
+	return distance != nil && (code.RadiusKm <= 0 || *distance <= code.RadiusKm)
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"log"
+	"strings"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// MatchRulesConfigKey 匹配规则在 system_configs 中的配置键
+const MatchRulesConfigKey = "match_rules"
+
+// DefaultMatchRules 未配置时启用的匹配规则（按顺序执行）
+var DefaultMatchRules = []string{"keyword", "visibility", "gender", "age_range", "region", "block_list"}
+
+// MatchContext 一次匹配判断的上下文（双方碰撞码及发布者）
+type MatchContext struct {
+	Code1 *models.CollisionCode
+	Code2 *models.CollisionCode
+	User1 *models.User
+	User2 *models.User
+
+	// 双方标签的关联类型（keyword/synonym/fuzzy），由匹配器根据同义词表和模糊匹配设置预先计算
+	MatchType string
+
+	// 双方已保存的地址（UserLocation），由匹配器预先加载，地区规则会考虑其中每一个地址
+	Locations1 []models.UserLocation
+	Locations2 []models.UserLocation
+
+	// 地区规则通过时，各自一方产生匹配的地址标签（Label1 为 Code1 一方看到的），没有经过已保存地址时为空
+	LocationLabel1 string
+	LocationLabel2 string
+}
+
+// MatchRule 匹配规则，所有规则都通过才创建匹配
+type MatchRule interface {
+	Name() string
+	Check(ctx *MatchContext) bool
+}
+
+// matchRuleRegistry 可用的匹配规则
+var matchRuleRegistry = map[string]MatchRule{
+	"keyword":    keywordRule{},
+	"visibility": visibilityRule{},
+	"gender":     genderRule{},
+	"age_range":  ageRangeRule{},
+	"region":     regionRule{},
+	"block_list": blockListRule{},
+}
+
+// AvailableMatchRules 返回所有可配置的规则名
+func AvailableMatchRules() []string {
+	names := make([]string, 0, len(matchRuleRegistry))
+	for _, name := range DefaultMatchRules {
+		if _, ok := matchRuleRegistry[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MatchPipeline 按顺序执行的一组匹配规则
+type MatchPipeline struct {
+	rules []MatchRule
+}
+
+// NewMatchPipeline 根据规则名创建规则链，未知规则会被忽略
+func NewMatchPipeline(names []string) *MatchPipeline {
+	pipeline := &MatchPipeline{}
+	for _, name := range names {
+		rule, ok := matchRuleRegistry[strings.TrimSpace(name)]
+		if !ok {
+			log.Printf("⚠️ 未知的匹配规则: %s", name)
+			continue
+		}
+		pipeline.rules = append(pipeline.rules, rule)
+	}
+	return pipeline
+}
+
+// LoadMatchPipeline 从系统配置加载当前部署启用的规则链
+func LoadMatchPipeline() *MatchPipeline {
+	return NewMatchPipeline(EnabledMatchRules())
+}
+
+// EnabledMatchRules 读取系统配置中启用的规则名，未配置时使用默认规则
+func EnabledMatchRules() []string {
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", MatchRulesConfigKey).First(&cfg).Error; err != nil {
+		return DefaultMatchRules
+	}
+	value := cfg.GetValue("rules")
+	if value == "" {
+		return DefaultMatchRules
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RuleNames 规则链中的规则名
+func (p *MatchPipeline) RuleNames() []string {
+	names := make([]string, 0, len(p.rules))
+	for _, rule := range p.rules {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+// Evaluate 依次检查所有规则，返回通过的规则名；有任一规则不通过时返回 false
+func (p *MatchPipeline) Evaluate(ctx *MatchContext) ([]string, bool) {
+	passed := make([]string, 0, len(p.rules))
+	for _, rule := range p.rules {
+		if !rule.Check(ctx) {
+			return passed, false
+		}
+		passed = append(passed, rule.Name())
+	}
+	return passed, true
+}
+
+// keywordRule 标签规范形式相同，或通过同义词/模糊匹配关联
+type keywordRule struct{}
+
+func (keywordRule) Name() string { return "keyword" }
+
+func (keywordRule) Check(ctx *MatchContext) bool {
+	if ctx.MatchType != "" {
+		return true
+	}
+	return ctx.Code1.TagCanonical != "" && ctx.Code1.TagCanonical == ctx.Code2.TagCanonical
+}
+
+// visibilityRule 双方都允许地区被搜索
+type visibilityRule struct{}
+
+func (visibilityRule) Name() string { return "visibility" }
+
+func (visibilityRule) Check(ctx *MatchContext) bool {
+	return ctx.User1.LocationVisible && ctx.User2.LocationVisible
+}
+
+// genderRule 碰撞码指定了期望性别时，对方性别必须一致（双向检查）
+type genderRule struct{}
+
+func (genderRule) Name() string { return "gender" }
+
+func (genderRule) Check(ctx *MatchContext) bool {
+	return genderAccepts(ctx.Code1, ctx.User2) && genderAccepts(ctx.Code2, ctx.User1)
+}
+
+func genderAccepts(code *models.CollisionCode, user *models.User) bool {
+	// 0 表示不限；对方未填写性别时不做限制
+	if code.Gender <= 0 || user.Gender <= 0 {
+		return true
+	}
+	return code.Gender == user.Gender
+}
+
+// ageRangeRule 对方年龄必须在碰撞码的年龄范围内（双向检查）
+type ageRangeRule struct{}
+
+func (ageRangeRule) Name() string { return "age_range" }
+
+func (ageRangeRule) Check(ctx *MatchContext) bool {
+	return ageAccepts(ctx.Code1, ctx.User2) && ageAccepts(ctx.Code2, ctx.User1)
+}
+
+func ageAccepts(code *models.CollisionCode, user *models.User) bool {
+	// 未设置年龄范围或对方未填写年龄时不做限制
+	if code.AgeMin <= 0 || code.AgeMax <= 0 || user.Age <= 0 {
+		return true
+	}
+	return user.Age >= code.AgeMin && user.Age <= code.AgeMax
+}
+
+// regionRule 双向地区匹配：我的搜索区域包含对方地址，且对方的搜索区域包含我的地址
+// 对方的地址包括资料中的地址和所有已保存的地址，任一地址在搜索区域内即可
+type regionRule struct{}
+
+func (regionRule) Name() string { return "region" }
+
+func (regionRule) Check(ctx *MatchContext) bool {
+	label1, ok := regionMatch(ctx.Code1, ctx.Locations1, ctx.User2, ctx.Locations2)
+	if !ok {
+		return false
+	}
+	label2, ok := regionMatch(ctx.Code2, ctx.Locations2, ctx.User1, ctx.Locations1)
+	if !ok {
+		return false
+	}
+	ctx.LocationLabel1, ctx.LocationLabel2 = label1, label2
+	return true
+}
+
+// region 一个地区（搜索区域或地址），Label 为来自已保存地址时的地址标签
+type region struct {
+	Country, Province, City, District string
+	Label                             string
+}
+
+// searchRegions 碰撞码的搜索区域：按已保存地址匹配时为发布者对应标签的地址，否则为碰撞码填写的地区
+// 发布者没有对应标签的地址时退回碰撞码填写的地区
+func searchRegions(code *models.CollisionCode, locations []models.UserLocation) []region {
+	var regions []region
+	labels := code.TargetLabelList()
+	for _, location := range locations {
+		for _, label := range labels {
+			if label == models.LocationLabelAll || label == location.Label {
+				regions = append(regions, locationRegion(location))
+				break
+			}
+		}
+	}
+	if len(regions) == 0 {
+		regions = append(regions, region{Country: code.Country, Province: code.Province, City: code.City, District: code.District})
+	}
+	return regions
+}
+
+// addressRegions 用户的所有地址：已保存的地址在前（匹配时能带上地址标签），资料中的地址在后
+func addressRegions(user *models.User, locations []models.UserLocation) []region {
+	regions := make([]region, 0, len(locations)+1)
+	for _, location := range locations {
+		regions = append(regions, locationRegion(location))
+	}
+	return append(regions, region{Country: user.Country, Province: user.Province, City: user.City, District: user.District})
+}
+
+func locationRegion(location models.UserLocation) region {
+	return region{
+		Country:  location.Country,
+		Province: location.Province,
+		City:     location.City,
+		District: location.District,
+		Label:    location.Label,
+	}
+}
+
+// regionMatch 碰撞码的任一搜索区域是否包含用户的任一地址，返回产生匹配的地址标签（优先取搜索区域的标签）
+// 按距离匹配的碰撞码（设置了距离范围，或匹配模式不检查地区）由距离范围代替地区检查
+func regionMatch(code *models.CollisionCode, codeLocations []models.UserLocation, user *models.User, userLocations []models.UserLocation) (string, bool) {
+	if code.RadiusKm > 0 || !matchStrategy(code.MatchMode).ChecksRegion() {
+		return "", true
+	}
+	addresses := addressRegions(user, userLocations)
+	for _, search := range searchRegions(code, codeLocations) {
+		for _, address := range addresses {
+			if !regionCovers(search, address) {
+				continue
+			}
+			if search.Label != "" {
+				return search.Label, true
+			}
+			return address.Label, true
+		}
+	}
+	return "", false
+}
+
+// regionCovers 搜索区域是否包含地址，未填写的层级视为不限
+func regionCovers(search, address region) bool {
+	levels := [][2]string{
+		{search.Country, address.Country},
+		{search.Province, address.Province},
+		{search.City, address.City},
+		{search.District, address.District},
+	}
+	for _, level := range levels {
+		if level[0] == "" {
+			return true
+		}
+		if level[0] != level[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// blockListRule 任一方拉黑对方时不匹配
+type blockListRule struct{}
+
+func (blockListRule) Name() string { return "block_list" }
+
+func (blockListRule) Check(ctx *MatchContext) bool {
+	return !IsBlocked(ctx.User1.ID, ctx.User2.ID)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+
+	"collision-backend/models"
+)
+
+func TestRegionCovers(t *testing.T) {
+	address := region{Country: "中国", Province: "广东", City: "深圳", District: "南山"}
+	tests := []struct {
+		name    string
+		search  region
+		address region
+		want    bool
+	}{
+		{"不限地区", region{}, address, true},
+		{"只限国家", region{Country: "中国"}, address, true},
+		{"省相同", region{Country: "中国", Province: "广东"}, address, true},
+		{"区相同", region{Country: "中国", Province: "广东", City: "深圳", District: "南山"}, address, true},
+		{"国家不同", region{Country: "日本"}, address, false},
+		{"城市不同", region{Country: "中国", Province: "广东", City: "广州"}, address, false},
+		{"区不同", region{Country: "中国", Province: "广东", City: "深圳", District: "福田"}, address, false},
+		{"地址未填写城市", region{Country: "中国", Province: "广东", City: "深圳"}, region{Country: "中国", Province: "广东"}, false},
+		// 上级未填写时不再比较下级
+		{"跳过层级", region{Country: "中国", City: "深圳"}, address, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regionCovers(tt.search, tt.address); got != tt.want {
+				t.Errorf("regionCovers(%+v, %+v) = %v, want %v", tt.search, tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenderAccepts(t *testing.T) {
+	tests := []struct {
+		name       string
+		codeGender int
+		userGender int
+		want       bool
+	}{
+		{"不限", 0, 1, true},
+		{"对方未填写", 2, 0, true},
+		{"一致", 1, 1, true},
+		{"不一致", 1, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := &models.CollisionCode{Gender: tt.codeGender}
+			user := &models.User{Gender: tt.userGender}
+			if got := genderAccepts(code, user); got != tt.want {
+				t.Errorf("genderAccepts(%d, %d) = %v, want %v", tt.codeGender, tt.userGender, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeAccepts(t *testing.T) {
+	tests := []struct {
+		name           string
+		ageMin, ageMax int
+		age            int
+		want           bool
+	}{
+		{"未设置下限", 0, 30, 50, true},
+		{"未设置上限", 20, 0, 10, true},
+		{"对方未填写", 20, 30, 0, true},
+		{"下限", 20, 30, 20, true},
+		{"上限", 20, 30, 30, true},
+		{"低于下限", 20, 30, 19, false},
+		{"高于上限", 20, 30, 31, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := &models.CollisionCode{AgeMin: tt.ageMin, AgeMax: tt.ageMax}
+			user := &models.User{Age: tt.age}
+			if got := ageAccepts(code, user); got != tt.want {
+				t.Errorf("ageAccepts(%d-%d, %d) = %v, want %v", tt.ageMin, tt.ageMax, tt.age, got, tt.want)
+			}
+		})
+	}
+}
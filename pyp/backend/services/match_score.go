@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+)
+
+// 匹配得分（0-100）由四部分组成：共同关键词、地区接近程度、匹配时间、双方活跃度
+const (
+	scoreWeightKeywords = 40.0
+	scoreWeightRegion   = 25.0
+	scoreWeightRecency  = 20.0
+	scoreWeightActivity = 15.0
+
+	scoreKeywordCap      = 5                  // 共同关键词达到这个数量即得满分
+	scoreRecencyHalfLife = 7 * 24 * time.Hour // 匹配时间得分的半衰期
+	scoreActivityWindow  = 7 * 24 * time.Hour // 统计对方最近是否活跃的时间窗口
+)
+
+// ScoreResults 计算某个用户的一批碰撞结果的得分，写回 results 并保存有变化的得分
+func ScoreResults(userID uint64, results []models.CollisionResult) {
+	scores := scoreResults(userID, results, nil)
+	for i := range results {
+		r := &results[i]
+		if scores[i] != r.Score {
+			r.Score = scores[i]
+			// UpdateColumn 不刷新 updated_at
+			if err := config.DB.Model(&models.CollisionResult{}).Where("id = ?", r.ID).
+				UpdateColumn("score", r.Score).Error; err != nil {
+				log.Printf("保存碰撞结果#%d得分失败: %v", r.ID, err)
+			}
+		}
+	}
+}
+
+// scoreResults 计算一批碰撞结果的得分，不写入数据库
+// 所需的用户资料、共同关键词、活跃度都按对方用户批量查询；pending 为尚未写入的匹配与每个对方用户重合的标签，计入共同关键词
+func scoreResults(userID uint64, results []models.CollisionResult, pending map[uint64][]string) []float64 {
+	scores := make([]float64, len(results))
+	if len(results) == 0 {
+		return scores
+	}
+
+	partnerIDs := make([]uint64, 0, len(results))
+	seen := make(map[uint64]bool)
+	for _, r := range results {
+		if !seen[r.MatchedUserID] {
+			seen[r.MatchedUserID] = true
+			partnerIDs = append(partnerIDs, r.MatchedUserID)
+		}
+	}
+
+	var user models.User
+	config.DB.First(&user, userID)
+
+	var partners []models.User
+	config.DB.Where("id IN ?", partnerIDs).Find(&partners)
+	partnerMap := make(map[uint64]models.User, len(partners))
+	for _, p := range partners {
+		partnerMap[uint64(p.ID)] = p
+	}
+
+	shared := sharedKeywordCounts(userID, partnerIDs, pending)
+	active, engaged := partnerActivity(userID, partnerIDs)
+
+	now := time.Now()
+	for i := range results {
+		r := &results[i]
+		partnerID := r.MatchedUserID
+
+		keywords := float64(shared[partnerID])
+		if keywords > scoreKeywordCap {
+			keywords = scoreKeywordCap
+		}
+
+		region := 0.0
+		if partner, ok := partnerMap[partnerID]; ok {
+			region = regionProximity(&user, &partner)
+		}
+
+		recency := math.Pow(0.5, float64(now.Sub(r.MatchedAt))/float64(scoreRecencyHalfLife))
+
+		activity := 0.0
+		if active[partnerID] {
+			activity += 0.5
+		}
+		if engaged[partnerID] {
+			activity += 0.5
+		}
+
+		score := keywords/scoreKeywordCap*scoreWeightKeywords +
+			region*scoreWeightRegion +
+			recency*scoreWeightRecency +
+			activity*scoreWeightActivity
+		scores[i] = math.Round(score*10) / 10
+	}
+	return scores
+}
+
+// rescoreBatchSize 定期刷新得分时每批处理的用户数
+const rescoreBatchSize = 200
+
+// RescoreMatches 按用户重新计算所有碰撞结果的得分（匹配时间和对方活跃度随时间变化），只保存有变化的得分，返回处理的用户数
+func RescoreMatches(ctx context.Context) (int, error) {
+	var lastUserID uint64
+	processed := 0
+	for {
+		if ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+		var userIDs []uint64
+		if err := config.DB.Model(&models.CollisionResult{}).
+			Where("user_id > ?", lastUserID).
+			Distinct().Order("user_id ASC").Limit(rescoreBatchSize).
+			Pluck("user_id", &userIDs).Error; err != nil {
+			return processed, err
+		}
+		if len(userIDs) == 0 {
+			return processed, nil
+		}
+		for _, userID := range userIDs {
+			var results []models.CollisionResult
+			if err := config.DB.Where("user_id = ?", userID).Find(&results).Error; err != nil {
+				return processed, err
+			}
+			ScoreResults(userID, results)
+			processed++
+		}
+		lastUserID = userIDs[len(userIDs)-1]
+	}
+}
+
+// RefreshPairScores 重新计算两个用户之间所有碰撞结果的得分（新匹配产生后共同关键词会变化）
+func RefreshPairScores(userID1, userID2 uint64) {
+	for _, pair := range [][2]uint64{{userID1, userID2}, {userID2, userID1}} {
+		var results []models.CollisionResult
+		config.DB.Where("user_id = ? AND matched_user_id = ?", pair[0], pair[1]).Find(&results)
+		ScoreResults(pair[0], results)
+	}
+}
+
+// sharedKeywordCounts 用户与每个对方用户共同碰撞过的关键词数（按规范形式去重，组合碰撞码的每个重合标签都算）
+func sharedKeywordCounts(userID uint64, partnerIDs []uint64, pending map[uint64][]string) map[uint64]int {
+	var rows []models.CollisionResult
+	config.DB.Select("matched_user_id", "keyword", "matched_tags").
+		Where("user_id = ? AND matched_user_id IN ?", userID, partnerIDs).
+		Find(&rows)
+
+	keywords := make(map[uint64]map[string]bool)
+	for _, row := range rows {
+		if keywords[row.MatchedUserID] == nil {
+			keywords[row.MatchedUserID] = make(map[string]bool)
+		}
+		tags := []string{row.Keyword}
+		if row.MatchedTags != "" {
+			tags = strings.Split(row.MatchedTags, ",")
+		}
+		for _, tag := range tags {
+			keywords[row.MatchedUserID][tagnorm.Canonical(tag)] = true
+		}
+	}
+	for partnerID, tags := range pending {
+		if keywords[partnerID] == nil {
+			keywords[partnerID] = make(map[string]bool)
+		}
+		for _, tag := range tags {
+			keywords[partnerID][tagnorm.Canonical(tag)] = true
+		}
+	}
+
+	counts := make(map[uint64]int, len(keywords))
+	for partnerID, set := range keywords {
+		counts[partnerID] = len(set)
+	}
+	return counts
+}
+
+// partnerActivity 对方最近是否活跃（发布过碰撞码或碰撞列表），以及对方是否对这次碰撞有过回应（发邮件、备注、标记已知）
+func partnerActivity(userID uint64, partnerIDs []uint64) (map[uint64]bool, map[uint64]bool) {
+	since := time.Now().Add(-scoreActivityWindow)
+
+	var activeIDs []uint64
+	config.DB.Model(&models.CollisionCode{}).
+		Where("user_id IN ? AND created_at >= ?", partnerIDs, since).
+		Distinct().Pluck("user_id", &activeIDs)
+
+	var activeListIDs []uint64
+	config.DB.Model(&models.CollisionList{}).
+		Where("user_id IN ? AND updated_at >= ?", partnerIDs, since).
+		Distinct().Pluck("user_id", &activeListIDs)
+
+	var engagedIDs []uint64
+	config.DB.Model(&models.CollisionResult{}).
+		Where("user_id IN ? AND matched_user_id = ? AND (email_sent = ? OR is_known = ? OR remark != '')",
+			partnerIDs, userID, true, true).
+		Distinct().Pluck("user_id", &engagedIDs)
+
+	active := make(map[uint64]bool)
+	for _, id := range append(activeIDs, activeListIDs...) {
+		active[id] = true
+	}
+	engaged := make(map[uint64]bool)
+	for _, id := range engagedIDs {
+		engaged[id] = true
+	}
+	return active, engaged
+}
+
+// regionProximity 两个用户所在地区的接近程度：同区县 1，同城市 0.75，同省份 0.5，同国家 0.25
+func regionProximity(user1, user2 *models.User) float64 {
+	levels := [][2]string{
+		{user1.Country, user2.Country},
+		{user1.Province, user2.Province},
+		{user1.City, user2.City},
+		{user1.District, user2.District},
+	}
+	proximity := 0.0
+	for _, level := range levels {
+		if level[0] == "" || level[0] != level[1] {
+			break
+		}
+		proximity += 0.25
+	}
+	return proximity
+}
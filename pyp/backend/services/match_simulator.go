@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+)
+
+// 模拟匹配中候选未能匹配的原因
+const (
+	SimulateReasonOverlap        = "overlap"         // 标签没有关联，或重合数量达不到双方要求
+	SimulateReasonAudit          = "audit"           // 有一方待审核或审核被拒绝
+	SimulateReasonWindow         = "window"          // 双方有效期没有重叠
+	SimulateReasonDistance       = "distance"        // 不在碰撞码设置的距离范围内，或缺少坐标
+	SimulateReasonBlocked        = "blocked"         // 任一方拉黑了对方
+	SimulateReasonMode           = "mode"            // 不满足任一方匹配模式的要求
+	SimulateReasonAlreadyMatched = "already_matched" // 双方已经匹配过
+	SimulateReasonUserMissing    = "user_missing"    // 发布者不存在
+	SimulateReasonCapped         = "capped"          // 超过匹配上限，会进入待匹配队列
+	SimulateReasonRule           = "rule:"           // 未通过某条匹配规则，后接规则名
+)
+
+// SimulatedMatch 模拟匹配中一个候选的判断结果
+type SimulatedMatch struct {
+	UserID       uint     `json:"userId"`
+	Nickname     string   `json:"nickname"`
+	CodeID       uint     `json:"codeId"` // 对方碰撞码，对方为碰撞列表时为 0
+	ListID       uint64   `json:"listId"` // 对方碰撞列表
+	Tag          string   `json:"tag"`
+	MatchType    string   `json:"matchType"`
+	MatchedTags  []string `json:"matchedTags"`
+	OverlapCount int      `json:"overlapCount"`
+	WouldMatch   bool     `json:"wouldMatch"`
+	Reason       string   `json:"reason"` // 未能匹配的原因，见 SimulateReason*
+	PassedRules  []string `json:"passedRules"`
+	Score        float64  `json:"score"`      // 会匹配时的预估得分
+	DistanceKm   *float64 `json:"distanceKm"` // 双方发布位置的距离，任一方没有坐标时为空
+
+	LocationLabel string `json:"locationLabel"` // 会匹配时产生匹配的地址标签
+	MatchMode     string `json:"matchMode"`     // 对方的匹配模式
+}
+
+// MatchSimulation 模拟匹配的结果
+type MatchSimulation struct {
+	UserID         uint             `json:"userId"`
+	CodeID         uint             `json:"codeId"`
+	Tags           []string         `json:"tags"`
+	Rules          []string         `json:"rules"`
+	AlreadyMatched []uint           `json:"alreadyMatched"` // 在这些标签下已经匹配过、不再参与判断的用户
+	Candidates     []SimulatedMatch `json:"candidates"`
+}
+
+// SimulateRequest 模拟匹配的输入：已有碰撞码，或以某个用户的身份提交标签
+type SimulateRequest struct {
+	CodeID     uint
+	UserID     uint
+	Tags       []string
+	MinOverlap int
+	Latitude   *float64 // 发布位置，可选
+	Longitude  *float64
+	RadiusKm   float64  // 大于 0 时按距离匹配
+	Labels     []string // 按已保存地址匹配的地址标签，可选
+	MatchMode  string   // 匹配模式，为空时为默认模式
+	Rules      []string // 为空时使用当前启用的规则链
+}
+
+// SimulateMatches 走与真实匹配相同的查找和规则判断流程，返回谁会匹配、为什么不匹配，不写入任何数据
+func (cm *CollisionMatcher) SimulateMatches(req SimulateRequest) (*MatchSimulation, error) {
+	var code models.CollisionCode
+	if req.CodeID != 0 {
+		if err := config.DB.Preload("User").First(&code, req.CodeID).Error; err != nil {
+			return nil, errors.New("碰撞码不存在")
+		}
+	} else {
+		if req.UserID == 0 || len(req.Tags) == 0 {
+			return nil, errors.New("请提供碰撞码ID，或用户ID和标签")
+		}
+		if err := config.DB.First(&code.User, req.UserID).Error; err != nil {
+			return nil, errors.New("用户不存在")
+		}
+		code.UserID = req.UserID
+		code.Status = "active"
+		code.AuditStatus = "approved"
+		code.CreatedAt = time.Now()
+		code.ExpiresAt = code.CreatedAt.Add(24 * time.Hour) // 与提交碰撞码的有效期相同
+		code.MinOverlap = req.MinOverlap
+		code.Latitude, code.Longitude, code.RadiusKm = req.Latitude, req.Longitude, req.RadiusKm
+		code.TargetLabels = strings.Join(req.Labels, ",")
+		code.MatchMode = NormalizeMatchMode(req.MatchMode)
+		code.SetTags(req.Tags)
+		code.TagCanonical = tagnorm.Canonical(code.Tag) // 保存时由 BeforeSave 生成，这里不落库需要手动补上
+		if len(code.CanonicalTags()) == 0 {
+			return nil, errors.New("标签不能为空")
+		}
+	}
+
+	session := newMatchSession()
+	if len(req.Rules) > 0 {
+		session.pipeline = NewMatchPipeline(req.Rules)
+	}
+	session.simulation = &MatchSimulation{
+		UserID:         code.UserID,
+		CodeID:         code.ID,
+		Tags:           code.TagList(),
+		Rules:          session.pipeline.RuleNames(),
+		AlreadyMatched: []uint{},
+		Candidates:     []SimulatedMatch{},
+	}
+
+	ownTags := code.CanonicalTags()
+	tags := append(ownTags, cm.relatedTags(&code, session.relations)...)
+	partners := cm.matchedPartners(code.UserID, tags)
+	for userID := range partners {
+		session.simulation.AlreadyMatched = append(session.simulation.AlreadyMatched, userID)
+	}
+
+	cm.findAllMatchesWith(&code, session)
+
+	session.simulation.fillNicknames()
+	session.simulation.scoreCandidates()
+	return session.simulation, nil
+}
+
+// fillNicknames 补齐在加载发布者之前就被排除的候选（如标签重合不足）的昵称
+func (sim *MatchSimulation) fillNicknames() {
+	var userIDs []uint
+	for _, candidate := range sim.Candidates {
+		if candidate.Nickname == "" {
+			userIDs = append(userIDs, candidate.UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	var users []models.User
+	config.DB.Select("id", "nickname").Where("id IN ?", userIDs).Find(&users)
+	nicknames := make(map[uint]string, len(users))
+	for _, user := range users {
+		nicknames[user.ID] = user.Nickname
+	}
+	for i := range sim.Candidates {
+		if sim.Candidates[i].Nickname == "" {
+			sim.Candidates[i].Nickname = nicknames[sim.Candidates[i].UserID]
+		}
+	}
+}
+
+// observe 模拟匹配、补算匹配时记录一个候选的判断结果，reason 为空表示会匹配
+func (s *matchSession) observe(code1, code2 *models.CollisionCode, overlap TagOverlap, reason string, passedRules []string) {
+	if s.replay != nil {
+		s.replay.observe(code1, code2, reason)
+	}
+	if s.simulation == nil {
+		return
+	}
+	candidate := SimulatedMatch{
+		UserID:       code2.UserID,
+		Nickname:     code2.User.Nickname,
+		CodeID:       code2.ID,
+		ListID:       s.listID(code2),
+		Tag:          code2.Tag,
+		MatchType:    overlap.MatchType,
+		MatchedTags:  overlap.Tags2,
+		OverlapCount: overlap.Count(),
+		WouldMatch:   reason == "",
+		Reason:       reason,
+		PassedRules:  passedRules,
+		DistanceKm:   codeDistance(code1, code2),
+
+		MatchMode: matchStrategy(code2.MatchMode).Name(),
+	}
+	if code2.TagsCanonical != "" {
+		candidate.Tag = strings.Join(code2.TagList(), ",")
+	}
+	s.simulation.Candidates = append(s.simulation.Candidates, candidate)
+}
+
+// scoreCandidates 按匹配得分的规则为会匹配的候选预估得分（匹配时间按现在计算）
+func (sim *MatchSimulation) scoreCandidates() {
+	var results []models.CollisionResult
+	var indexes []int
+	pending := make(map[uint64][]string)
+	now := time.Now()
+	for i, candidate := range sim.Candidates {
+		if !candidate.WouldMatch {
+			continue
+		}
+		results = append(results, models.CollisionResult{MatchedUserID: uint64(candidate.UserID), MatchedAt: now})
+		indexes = append(indexes, i)
+		pending[uint64(candidate.UserID)] = candidate.MatchedTags
+	}
+
+	scores := scoreResults(uint64(sim.UserID), results, pending)
+	for i, index := range indexes {
+		sim.Candidates[index].Score = scores[i]
+	}
+}
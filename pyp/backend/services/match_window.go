@@ -0,0 +1,68 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+)
+
+// 匹配时间窗口：
+// 默认两个碰撞码的有效期（发布 ~ 过期/删除）有重叠才匹配，今天发布的碰撞码不会与几个月前就已过期的碰撞码碰撞；
+// 管理员可以为某个标签开启历史模式（HotTag.MatchHistorical），该标签下不检查有效期，与历史碰撞码也能匹配。
+// 待审核、审核拒绝的碰撞码任何模式下都不参与匹配。
+
+// LoadHistoricalTags 开启了历史匹配模式的标签（规范形式）
+func LoadHistoricalTags() map[string]bool {
+	var tags []string
+	if err := config.DB.Model(&models.HotTag{}).
+		Where("match_historical = ?", true).
+		Pluck("keyword_canonical", &tags).Error; err != nil {
+		log.Printf("读取历史匹配标签失败: %v", err)
+	}
+
+	historical := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		historical[tag] = true
+	}
+	return historical
+}
+
+// isAuditApproved 审核状态是否允许参与匹配（待审核、已拒绝的不参与）
+func isAuditApproved(code *models.CollisionCode) bool {
+	return code.AuditStatus != "pending" && code.AuditStatus != "rejected"
+}
+
+// activeInterval 碰撞码的有效期：发布时间到过期时间（提前删除时到删除时间），没有过期时间视为一直有效
+func activeInterval(code *models.CollisionCode) (time.Time, time.Time) {
+	end := code.ExpiresAt
+	if code.DeletedAt.Valid && (end.IsZero() || code.DeletedAt.Time.Before(end)) {
+		end = code.DeletedAt.Time
+	}
+	return code.CreatedAt, end
+}
+
+// intervalsOverlap 两个碰撞码的有效期是否有重叠（零值表示不限）
+func intervalsOverlap(code1, code2 *models.CollisionCode) bool {
+	start1, end1 := activeInterval(code1)
+	start2, end2 := activeInterval(code2)
+	if !end2.IsZero() && !start1.IsZero() && !start1.Before(end2) {
+		return false
+	}
+	if !end1.IsZero() && !start2.IsZero() && !start2.Before(end1) {
+		return false
+	}
+	return true
+}
+
+// inMatchWindow 两个碰撞码是否在匹配时间窗口内：重合的标签中任一开启了历史模式，或有效期有重叠
+func (s *matchSession) inMatchWindow(code1, code2 *models.CollisionCode, overlap TagOverlap) bool {
+	for _, tag := range append(overlap.Tags1, overlap.Tags2...) {
+		if s.historical[tagnorm.Canonical(tag)] {
+			return true
+		}
+	}
+	return intervalsOverlap(code1, code2)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// 匹配任务执行记录：
+// 每次定期匹配、提交/重新提交时的即时匹配、管理员手动触发的匹配结束后写入一条 matcher_runs，
+// 记录扫描数量、判断的候选对数、新增匹配数和错误，供管理后台绘制匹配任务图表。
+
+// 匹配任务来源
+const (
+	MatcherRunSourceTicker   = "ticker"   // 定期匹配
+	MatcherRunSourceSubmit   = "submit"   // 提交碰撞码、创建碰撞列表、审核通过时的即时匹配
+	MatcherRunSourceResubmit = "resubmit" // 修改、续期、重新提交碰撞码，续期或重新启用碰撞列表时的即时匹配
+	MatcherRunSourceManual   = "manual"   // 管理员手动触发的全量匹配
+)
+
+// MatcherRunSources 所有匹配任务来源
+var MatcherRunSources = []string{MatcherRunSourceTicker, MatcherRunSourceSubmit, MatcherRunSourceResubmit, MatcherRunSourceManual}
+
+// ErrMatcherRunning 已有整轮匹配正在执行
+var ErrMatcherRunning = errors.New("匹配任务正在执行")
+
+// matcherRunMu 同一实例上定期匹配和手动触发的整轮匹配不并发执行
+var (
+	matcherRunMu  sync.Mutex
+	matcherActive atomic.Bool
+)
+
+// MatcherRunning 当前实例是否正在执行整轮匹配
+func MatcherRunning() bool {
+	return matcherActive.Load()
+}
+
+// TriggerRun 在后台立即执行一次全量匹配（新的匹配实例首次运行即为全量对账），已有整轮匹配在执行时返回 ErrMatcherRunning
+func TriggerRun(source string) error {
+	if !matcherRunMu.TryLock() {
+		return ErrMatcherRunning
+	}
+	started := startBackground(func() {
+		defer matcherRunMu.Unlock()
+		NewCollisionMatcher().runMatcher(BackgroundContext(), source)
+	})
+	if !started {
+		matcherRunMu.Unlock()
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// recordError 记录匹配过程中的错误（计入本次匹配任务的错误数）
+func (s *matchSession) recordError(err error) {
+	s.errors++
+	s.lastError = err.Error()
+}
+
+// stats 补齐本次匹配过程中累计的候选对数、错误数和耗时
+func (s *matchSession) stats(stats MatchRunStats, startTime time.Time) MatchRunStats {
+	stats.PairsEvaluated = s.pairsEvaluated
+	stats.Errors = s.errors
+	stats.Elapsed = time.Since(startTime)
+	return stats
+}
+
+// saveMatcherRun 写入一次匹配任务的执行记录
+func saveMatcherRun(source string, startTime time.Time, stats MatchRunStats, session *matchSession) {
+	lastError := session.lastError
+	if r := []rune(lastError); len(r) > 500 {
+		lastError = string(r[:500])
+	}
+	run := models.MatcherRun{
+		Source:         source,
+		Mode:           stats.Mode,
+		InstanceID:     Leader().InstanceID(),
+		StartedAt:      startTime,
+		FinishedAt:     startTime.Add(stats.Elapsed),
+		DurationMs:     stats.Elapsed.Milliseconds(),
+		CodesScanned:   stats.CodesScanned,
+		ListsScanned:   stats.ListsScanned,
+		PairsEvaluated: stats.PairsEvaluated,
+		MatchesCreated: stats.MatchesCreated,
+		Deferred:       stats.Deferred,
+		Errors:         stats.Errors,
+		LastError:      lastError,
+	}
+	if err := config.DB.Create(&run).Error; err != nil {
+		log.Printf("写入匹配任务记录失败: %v", err)
+	}
+}
+
+// MatcherRunBucket 按时间段汇总的匹配任务
+type MatcherRunBucket struct {
+	Time           string  `json:"time"`
+	Runs           int64   `json:"runs"`
+	CodesScanned   int64   `json:"codesScanned"`
+	PairsEvaluated int64   `json:"pairsEvaluated"`
+	MatchesCreated int64   `json:"matchesCreated"`
+	Errors         int64   `json:"errors"`
+	AvgDurationMs  float64 `json:"avgDurationMs"`
+}
+
+// MatcherRunSeries 按小时（hourly 为 true）或按天汇总 since 之后的匹配任务，source 为空时包括所有来源
+func MatcherRunSeries(since time.Time, hourly bool, source string) ([]MatcherRunBucket, error) {
+	format := "%Y-%m-%d"
+	if hourly {
+		format = "%Y-%m-%d %H:00"
+	}
+
+	query := config.DB.Model(&models.MatcherRun{}).
+		Select("DATE_FORMAT(started_at, ?) AS time, COUNT(*) AS runs, SUM(codes_scanned) AS codes_scanned, "+
+			"SUM(pairs_evaluated) AS pairs_evaluated, SUM(matches_created) AS matches_created, "+
+			"SUM(errors) AS errors, AVG(duration_ms) AS avg_duration_ms", format).
+		Where("started_at >= ?", since)
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	buckets := []MatcherRunBucket{}
+	err := query.Group("time").Order("time ASC").Scan(&buckets).Error
+	return buckets, err
+}
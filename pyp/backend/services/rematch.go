@@ -0,0 +1,535 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 补算匹配：
+// 匹配规则、同义词、匹配模式修改后，按当前配置对某个时间范围或某些标签下的碰撞码、碰撞列表重新执行匹配判断
+// （已匹配过的用户对也重新判断，不受匹配上限限制），与已有的碰撞结果对比，列出会新增和会撤销的匹配。
+// 只有被重新判断过、且这次未通过的匹配才会撤销；没有被判断到（如对方已删除、碰撞列表已过期）的保持不变。
+// 用户已经处理过的匹配（已加好友、已付费发送邮件、已备注或标记认识）也保持不变，只列出供人工确认。
+// 按批处理，每批结束后把进度写入检查点，中断后使用相同的参数可以从检查点继续。
+
+// RematchCheckpointKey 补算匹配检查点在 system_configs 中的配置键
+const RematchCheckpointKey = "rematch_checkpoint"
+
+// 补算匹配的变更
+const (
+	RematchAdd     = "add"     // 会新增的匹配
+	RematchRetract = "retract" // 会撤销的匹配
+	RematchKeep    = "keep"    // 不再满足规则、但用户已处理过而保留的匹配
+)
+
+// rematchReasonReplaced 撤销原因：这对用户现在以其他关键词匹配
+const rematchReasonReplaced = "replaced"
+
+// errMatchInteracted 撤销时发现用户已处理过这个匹配
+var errMatchInteracted = errors.New("用户已处理过该匹配")
+
+// 补算匹配的阶段
+const (
+	rematchPhaseCodes = "codes"
+	rematchPhaseLists = "lists"
+)
+
+// ErrRematchScopeChanged 检查点与本次补算的范围不同
+var ErrRematchScopeChanged = errors.New("检查点的补算范围与本次参数不同")
+
+// RematchOptions 补算匹配的范围和方式
+type RematchOptions struct {
+	From      time.Time // 碰撞码、碰撞列表的创建时间 >= From，为零值时不限制
+	To        time.Time // 创建时间 < To，为零值时不限制
+	Tags      []string  // 只补算包含这些标签（按规范形式比较）的碰撞码和碰撞列表，为空时不限制
+	Apply     bool      // 为 false 时只列出变更，不写入数据
+	BatchSize int       // 每批处理的碰撞码/碰撞列表数量
+	Resume    bool      // 从上次中断的检查点继续
+}
+
+// RematchChange 补算匹配发现的一条变更
+type RematchChange struct {
+	Action    string // add, retract
+	PairKey   string
+	UserID1   uint
+	UserID2   uint
+	Keyword   string
+	MatchType string
+	Source    string // 会新增的匹配由哪一方发起
+	Reason    string // 撤销的原因（见 SimulateReason*）
+}
+
+// RematchStats 补算匹配统计
+type RematchStats struct {
+	CodesScanned   int
+	ListsScanned   int
+	PairsEvaluated int
+	Added          int
+	Retracted      int
+	Unverified     int // 范围内已有、但这次没有被重新判断或缺少匹配对唯一键的碰撞结果，以及用户已处理过的匹配，不撤销
+	Errors         int
+}
+
+// rematchCheckpoint 补算匹配的进度
+type rematchCheckpoint struct {
+	Scope  string
+	Phase  string
+	LastID uint64
+	Stats  RematchStats
+}
+
+// rematchReplay 一批补算中记录的判断结果
+type rematchReplay struct {
+	matches   map[string]rematchMatch // 匹配对唯一键 -> 会产生的匹配
+	order     []string
+	evaluated map[string]bool    // 被判断过的用户对和标签（见 rematchEvaluatedKey）
+	reasons   map[[2]uint]string // 用户对最近一次未通过的原因
+	users     map[uint]bool      // 本批的发起方用户
+	tags      map[string]bool    // 本批发起方的标签（规范形式）
+}
+
+// rematchMatch 补算时会产生的一次匹配
+type rematchMatch struct {
+	code1, code2 *models.CollisionCode
+	outcome      matchOutcome
+}
+
+func newRematchReplay() *rematchReplay {
+	return &rematchReplay{
+		matches:   make(map[string]rematchMatch),
+		evaluated: make(map[string]bool),
+		reasons:   make(map[[2]uint]string),
+		users:     make(map[uint]bool),
+		tags:      make(map[string]bool),
+	}
+}
+
+// rematchEvaluatedKey 用户对在某个标签（规范形式）下被判断过的标识
+func rematchEvaluatedKey(pair [2]uint, tag string) string {
+	return fmt.Sprintf("%d-%d-%s", pair[0], pair[1], tag)
+}
+
+// addSource 记录本批的发起方
+func (r *rematchReplay) addSource(code *models.CollisionCode) {
+	r.users[code.UserID] = true
+	for _, tag := range code.CanonicalTags() {
+		r.tags[tag] = true
+	}
+}
+
+// observe 记录一个候选对被判断过，reason 不为空时记录未通过的原因
+func (r *rematchReplay) observe(code1, code2 *models.CollisionCode, reason string) {
+	pair := userPair(code1.UserID, code2.UserID)
+	for _, tag := range append(code1.CanonicalTags(), code2.CanonicalTags()...) {
+		r.evaluated[rematchEvaluatedKey(pair, tag)] = true
+	}
+	if reason != "" {
+		r.reasons[pair] = reason
+	}
+}
+
+// accept 记录一次会产生的匹配，同一匹配对只记录第一次
+func (r *rematchReplay) accept(code1, code2 *models.CollisionCode, outcome matchOutcome) {
+	key := outcome.pairKey(code1, code2)
+	if _, ok := r.matches[key]; ok {
+		return
+	}
+	r.matches[key] = rematchMatch{code1: code1, code2: code2, outcome: outcome}
+	r.order = append(r.order, key)
+}
+
+// newRematchSession 补算使用当前的匹配配置，但不受匹配上限限制
+func newRematchSession() *matchSession {
+	session := newMatchSession()
+	session.caps.setting.PerCode, session.caps.setting.PerTag = 0, 0
+	session.replay = newRematchReplay()
+	return session
+}
+
+// Rematch 按当前匹配配置补算范围内的匹配，每发现一条变更调用一次 report
+func Rematch(opts RematchOptions, report func(RematchChange)) (RematchStats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 200
+	}
+	tags := rematchTags(opts.Tags)
+	checkpoint := rematchCheckpoint{Scope: rematchScope(opts, tags), Phase: rematchPhaseCodes}
+
+	if opts.Resume {
+		saved, ok := loadRematchCheckpoint()
+		if ok {
+			if saved.Scope != checkpoint.Scope {
+				return saved.Stats, fmt.Errorf("%w: %s", ErrRematchScopeChanged, saved.Scope)
+			}
+			checkpoint = saved
+			log.Printf("从检查点继续补算匹配 - 阶段: %s, 已处理到: #%d", checkpoint.Phase, checkpoint.LastID)
+		}
+	}
+
+	// 命令行进程中的内存索引是空的，先按数据库重建
+	cm := NewCollisionMatcher()
+	if cm.index.Backend() == "memory" {
+		var activeCodes []models.CollisionCode
+		if err := config.DB.Where("status != ?", "invalid").Find(&activeCodes).Error; err != nil {
+			return checkpoint.Stats, err
+		}
+		if err := cm.index.Rebuild(activeCodes); err != nil {
+			return checkpoint.Stats, err
+		}
+	}
+
+	// 同一匹配对在本次运行中只报告一次（发起方和候选方都在范围内时会被判断两次）
+	reported := make(map[string]bool)
+
+	for checkpoint.Phase != "" {
+		session := newRematchSession()
+		lastID, scanned := checkpoint.LastID, 0
+
+		switch checkpoint.Phase {
+		case rematchPhaseCodes:
+			var codes []models.CollisionCode
+			if err := rematchCodeScope(opts, tags).Where("id > ?", lastID).
+				Order("id ASC").Limit(opts.BatchSize).Preload("User").
+				Find(&codes).Error; err != nil {
+				return checkpoint.Stats, err
+			}
+			if len(codes) == 0 {
+				checkpoint.Phase, checkpoint.LastID = rematchPhaseLists, 0
+				break
+			}
+			for i := range codes {
+				scanned++
+				checkpoint.Stats.CodesScanned++
+				lastID = uint64(codes[i].ID)
+				if !isIndexable(&codes[i]) {
+					continue
+				}
+				session.replay.addSource(&codes[i])
+				cm.findAllMatchesWith(&codes[i], session)
+			}
+
+		case rematchPhaseLists:
+			var lists []models.CollisionList
+			if err := rematchListScope(opts, tags).Where("id > ?", lastID).
+				Order("id ASC").Limit(opts.BatchSize).
+				Find(&lists).Error; err != nil {
+				return checkpoint.Stats, err
+			}
+			if len(lists) == 0 {
+				checkpoint.Phase, checkpoint.LastID = "", 0
+				break
+			}
+			for i := range lists {
+				scanned++
+				checkpoint.Stats.ListsScanned++
+				lastID = lists[i].ID
+				if !isListMatchable(&lists[i]) {
+					continue
+				}
+				code := session.listCode(&lists[i])
+				session.replay.addSource(code)
+				cm.findAllMatchesWith(code, session)
+			}
+		}
+
+		if scanned > 0 {
+			checkpoint.Stats.PairsEvaluated += session.pairsEvaluated
+			checkpoint.Stats.Errors += session.errors
+			if err := cm.finishRematchBatch(session, opts.Apply, reported, &checkpoint.Stats, report); err != nil {
+				return checkpoint.Stats, err
+			}
+			checkpoint.LastID = lastID
+		}
+		if checkpoint.Phase == "" {
+			break
+		}
+		if err := saveRematchCheckpoint(checkpoint); err != nil {
+			return checkpoint.Stats, err
+		}
+	}
+
+	// 新增或撤销了匹配时重新统计碰撞码、碰撞列表的匹配数量
+	if opts.Apply && checkpoint.Stats.Added+checkpoint.Stats.Retracted > 0 {
+		var dedupStats MatchDedupStats
+		if err := recountListMatches(false, &dedupStats); err != nil {
+			return checkpoint.Stats, err
+		}
+		if err := recountCodeMatches(false, &dedupStats); err != nil {
+			return checkpoint.Stats, err
+		}
+	}
+	return checkpoint.Stats, clearRematchCheckpoint()
+}
+
+// finishRematchBatch 将一批补算的判断结果与已有的匹配对比，报告（并在 apply 时执行）新增和撤销
+func (cm *CollisionMatcher) finishRematchBatch(session *matchSession, apply bool, reported map[string]bool, stats *RematchStats, report func(RematchChange)) error {
+	replay := session.replay
+
+	// 会新增的匹配：碰撞记录中还没有这个匹配对（包括软删除的，唯一索引同样覆盖它们）
+	existing := make(map[string]bool)
+	if len(replay.order) > 0 {
+		var keys []string
+		if err := config.DB.Unscoped().Model(&models.CollisionRecord{}).
+			Where("pair_key IN ?", replay.order).
+			Distinct().Pluck("pair_key", &keys).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			existing[key] = true
+		}
+	}
+
+	for _, key := range replay.order {
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+		if existing[key] {
+			continue
+		}
+
+		m := replay.matches[key]
+		keyword, _ := m.outcome.keywords(m.code1, m.code2)
+		change := RematchChange{
+			Action:    RematchAdd,
+			PairKey:   key,
+			UserID1:   m.code1.UserID,
+			UserID2:   m.code2.UserID,
+			Keyword:   keyword,
+			MatchType: m.outcome.MatchType,
+			Source:    describeSource(m.code1, m.outcome.ListID1) + " -> " + describeSource(m.code2, m.outcome.ListID2),
+		}
+		if apply {
+			created, err := cm.createMatchRecord(m.code1, m.code2, m.outcome)
+			if err != nil {
+				stats.Errors++
+				continue
+			}
+			if !created {
+				continue // 已由正在运行的匹配任务创建
+			}
+		}
+		stats.Added++
+		report(change)
+	}
+
+	// 会撤销的匹配：本批发起方已有的碰撞结果中，被重新判断过但这次没有产生同一匹配对的
+	if len(replay.users) == 0 {
+		return nil
+	}
+	userIDs := make([]uint64, 0, len(replay.users))
+	for userID := range replay.users {
+		userIDs = append(userIDs, uint64(userID))
+	}
+	var results []models.CollisionResult
+	if err := config.DB.Where("user_id IN ?", userIDs).Order("id ASC").Find(&results).Error; err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		pair := userPair(uint(r.UserID), uint(r.MatchedUserID))
+		if !replay.evaluated[rematchEvaluatedKey(pair, r.KeywordCanonical)] || r.PairKey == nil {
+			// 发起方其他标签下的匹配不在本次范围内
+			resultKey := "result:" + strconv.FormatUint(r.ID, 10)
+			if replay.tags[r.KeywordCanonical] && !reported[resultKey] {
+				reported[resultKey] = true
+				stats.Unverified++
+			}
+			continue
+		}
+		key := *r.PairKey
+		if _, ok := replay.matches[key]; ok || reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		reason := replay.reasons[pair]
+		if reason == "" {
+			reason = rematchReasonReplaced
+		}
+		change := RematchChange{
+			Action:    RematchRetract,
+			PairKey:   key,
+			UserID1:   uint(r.UserID),
+			UserID2:   uint(r.MatchedUserID),
+			Keyword:   r.Keyword,
+			MatchType: r.MatchType,
+			Reason:    reason,
+		}
+
+		interacted, err := matchInteracted(config.DB, key)
+		if err == nil && !interacted && apply {
+			err = retractMatch(key)
+			if errors.Is(err, errMatchInteracted) {
+				interacted, err = true, nil
+			}
+		}
+		if err != nil {
+			log.Printf("撤销匹配失败(%s): %v", key, err)
+			stats.Errors++
+			continue
+		}
+		if interacted {
+			change.Action = RematchKeep
+			stats.Unverified++
+			report(change)
+			continue
+		}
+		stats.Retracted++
+		report(change)
+	}
+	return nil
+}
+
+// retractMatch 删除一个匹配对双方的碰撞记录和碰撞结果（硬删除，之后可以重新匹配）。
+// 用户已处理过该匹配时不删除，返回 errMatchInteracted
+func retractMatch(pairKey string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		interacted, err := matchInteracted(tx.Clauses(clause.Locking{Strength: "UPDATE"}), pairKey)
+		if err != nil {
+			return err
+		}
+		if interacted {
+			return errMatchInteracted
+		}
+		if err := tx.Unscoped().Where("pair_key = ?", pairKey).Delete(&models.CollisionRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("pair_key = ?", pairKey).Delete(&models.CollisionResult{}).Error
+	})
+}
+
+// matchInteracted 用户是否已处理过这个匹配：已加好友、已发送（付费）邮件、已备注或标记认识
+func matchInteracted(db *gorm.DB, pairKey string) (bool, error) {
+	var records int64
+	if err := db.Model(&models.CollisionRecord{}).
+		Where("pair_key = ? AND (status = ? OR email_sent = ?)", pairKey, "friend_added", true).
+		Count(&records).Error; err != nil {
+		return false, err
+	}
+	if records > 0 {
+		return true, nil
+	}
+
+	var results int64
+	if err := db.Model(&models.CollisionResult{}).
+		Where("pair_key = ? AND (remark <> '' OR is_known = ? OR email_sent = ?)", pairKey, true, true).
+		Count(&results).Error; err != nil {
+		return false, err
+	}
+	return results > 0, nil
+}
+
+// rematchTags 补算范围的标签：规范形式，去重排序
+func rematchTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var canonicals []string
+	for _, tag := range tags {
+		canonical := tagnorm.Canonical(tag)
+		if canonical != "" && !seen[canonical] {
+			seen[canonical] = true
+			canonicals = append(canonicals, canonical)
+		}
+	}
+	sort.Strings(canonicals)
+	return canonicals
+}
+
+// rematchScope 补算范围的标识，检查点只能在相同的范围和方式下继续
+func rematchScope(opts RematchOptions, tags []string) string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	return fmt.Sprintf("from=%s;to=%s;tags=%s;apply=%t", format(opts.From), format(opts.To), strings.Join(tags, ","), opts.Apply)
+}
+
+// rematchCodeScope 范围内的碰撞码
+func rematchCodeScope(opts RematchOptions, tags []string) *gorm.DB {
+	query := config.DB.Model(&models.CollisionCode{}).Where("status != ?", "invalid")
+	if !opts.From.IsZero() {
+		query = query.Where("created_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		query = query.Where("created_at < ?", opts.To)
+	}
+	if len(tags) > 0 {
+		// 组合碰撞码包含其中任一标签即可
+		cond := config.DB.Where("tag_canonical IN ?", tags)
+		for _, tag := range tags {
+			cond = cond.Or("FIND_IN_SET(?, tags_canonical) > 0", tag)
+		}
+		query = query.Where(cond)
+	}
+	return query
+}
+
+// rematchListScope 范围内的碰撞列表
+func rematchListScope(opts RematchOptions, tags []string) *gorm.DB {
+	query := config.DB.Model(&models.CollisionList{})
+	if !opts.From.IsZero() {
+		query = query.Where("created_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		query = query.Where("created_at < ?", opts.To)
+	}
+	if len(tags) > 0 {
+		query = query.Where("keyword_canonical IN ?", tags)
+	}
+	return query
+}
+
+// loadRematchCheckpoint 读取上次中断的补算进度
+func loadRematchCheckpoint() (rematchCheckpoint, bool) {
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", RematchCheckpointKey).First(&cfg).Error; err != nil {
+		return rematchCheckpoint{}, false
+	}
+
+	checkpoint := rematchCheckpoint{
+		Scope: cfg.GetValue("scope"),
+		Phase: cfg.GetValue("phase"),
+	}
+	checkpoint.LastID, _ = strconv.ParseUint(cfg.GetValue("last_id"), 10, 64)
+	if stats := cfg.GetValue("stats"); stats != "" {
+		json.Unmarshal([]byte(stats), &checkpoint.Stats)
+	}
+	return checkpoint, checkpoint.Phase != ""
+}
+
+// saveRematchCheckpoint 保存补算进度
+func saveRematchCheckpoint(checkpoint rematchCheckpoint) error {
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", RematchCheckpointKey).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: RematchCheckpointKey,
+		}
+	}
+	stats, _ := json.Marshal(checkpoint.Stats)
+	cfg.SetValues(map[string]string{
+		"scope":   checkpoint.Scope,
+		"phase":   checkpoint.Phase,
+		"last_id": strconv.FormatUint(checkpoint.LastID, 10),
+		"stats":   string(stats),
+	})
+	return config.DB.Save(&cfg).Error
+}
+
+// clearRematchCheckpoint 补算完成后删除检查点
+func clearRematchCheckpoint() error {
+	return config.DB.Where("config_key = ?", RematchCheckpointKey).Delete(&models.SystemConfig{}).Error
+}
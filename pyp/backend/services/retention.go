@@ -0,0 +1,576 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 数据保留与归档：
+// email_logs、collision_records、collision_results、consume_records 超过保留天数的行按批移到归档表（<表名>_archive，结构与原表相同）
+// 或写入本地的压缩文件（<ARCHIVE_DIR>/<表名>/<表名>-<时间>.ndjson.gz，每行一条 JSON），然后从原表删除。
+// 保留策略保存在 system_configs（retention:<表名>，days/mode），保留天数为 0 表示不归档；每张表一个后台任务（retention_<表名>），由调度器执行。
+// 仍在使用的行不会归档（待发送的邮件、还在加好友期限内的匹配、任一方仍有有效碰撞码或碰撞列表的碰撞结果），归档的数据可用 restore-archive 命令恢复到原表。
+
+// RetentionConfigKeyPrefix 保留策略在 system_configs 中的配置键前缀
+const RetentionConfigKeyPrefix = "retention:"
+
+// 归档方式
+const (
+	ArchiveModeTable = "table" // 移到归档表
+	ArchiveModeFile  = "file"  // 写入本地压缩文件
+)
+
+// ArchiveModes 可用的归档方式
+var ArchiveModes = []string{ArchiveModeTable, ArchiveModeFile}
+
+// archiveBatchSize 每批归档/恢复的行数
+const archiveBatchSize = 500
+
+var (
+	// ErrUnknownRetentionTable 不支持归档的表
+	ErrUnknownRetentionTable = errors.New("不支持归档的表")
+	// ErrRetentionTooShort 保留天数低于该表的下限
+	ErrRetentionTooShort = errors.New("保留天数低于下限")
+)
+
+// retentionTable 支持归档的表
+type retentionTable struct {
+	name        string
+	timeColumn  string // 按此时间列判断是否超过保留期
+	guard       string // 仍在使用、不能归档的行的排除条件
+	minDays     int    // 保留天数下限
+	defaultDays int
+	defaultMode string
+	defaultCron string
+}
+
+var retentionTables = []retentionTable{
+	{
+		name:        "email_logs",
+		timeColumn:  "created_at",
+		guard:       "status <> 'pending'",
+		minDays:     7,
+		defaultDays: 90,
+		defaultMode: ArchiveModeFile,
+		defaultCron: "0 3 * * *",
+	},
+	{
+		name:        "collision_records",
+		timeColumn:  "created_at",
+		guard:       "status <> 'matched'",
+		minDays:     30,
+		defaultMode: ArchiveModeTable,
+		defaultCron: "10 3 * * *",
+	},
+	{
+		name:        "collision_results",
+		timeColumn:  "matched_at",
+		guard:       collisionResultGuard,
+		minDays:     30,
+		defaultMode: ArchiveModeTable,
+		defaultCron: "20 3 * * *",
+	},
+	{
+		name:        "consume_records",
+		timeColumn:  "created_at",
+		minDays:     180,
+		defaultMode: ArchiveModeTable,
+		defaultCron: "30 3 * * *",
+	},
+}
+
+// collisionResultGuard 碰撞结果的排除条件：匹配对任一方仍有同一关键词的有效碰撞码或碰撞列表时不归档。
+// 匹配时只按原表判断是否已匹配，归档后双方仍有效会被重新匹配（重复计数和通知）
+const collisionResultGuard = "collision_list_id NOT IN (SELECT id FROM collision_lists WHERE status = 'active')" +
+	" AND NOT EXISTS (SELECT 1 FROM collision_codes c" +
+	" WHERE c.user_id IN (collision_results.user_id, collision_results.matched_user_id)" +
+	" AND c.status = 'active' AND c.deleted_at IS NULL" +
+	" AND (c.tag_canonical = collision_results.keyword_canonical OR FIND_IN_SET(collision_results.keyword_canonical, c.tags_canonical) > 0))" +
+	" AND NOT EXISTS (SELECT 1 FROM collision_lists l" +
+	" WHERE l.user_id IN (collision_results.user_id, collision_results.matched_user_id)" +
+	" AND l.status = 'active' AND l.keyword_canonical = collision_results.keyword_canonical)"
+
+// RetentionPolicy 一张表的保留策略
+type RetentionPolicy struct {
+	Table   string `json:"table"`
+	Days    int    `json:"days"` // 保留天数，0 表示不归档
+	Mode    string `json:"mode"` // table, file
+	MinDays int    `json:"min_days"`
+}
+
+// RetentionTables 支持归档的表名
+func RetentionTables() []string {
+	names := make([]string, len(retentionTables))
+	for i, table := range retentionTables {
+		names[i] = table.name
+	}
+	return names
+}
+
+func findRetentionTable(name string) (*retentionTable, error) {
+	for i := range retentionTables {
+		if retentionTables[i].name == name {
+			return &retentionTables[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownRetentionTable, name)
+}
+
+// LoadRetentionPolicies 从系统配置读取所有表的保留策略，没有配置的使用默认值
+func LoadRetentionPolicies() []RetentionPolicy {
+	var configs []models.SystemConfig
+	config.DB.Where("config_key LIKE ?", RetentionConfigKeyPrefix+"%").Find(&configs)
+	byKey := make(map[string]*models.SystemConfig, len(configs))
+	for i := range configs {
+		byKey[configs[i].ConfigKey] = &configs[i]
+	}
+
+	policies := make([]RetentionPolicy, len(retentionTables))
+	for i, table := range retentionTables {
+		policies[i] = table.policy(byKey[RetentionConfigKeyPrefix+table.name])
+	}
+	return policies
+}
+
+// LoadRetentionPolicy 读取一张表的保留策略
+func LoadRetentionPolicy(name string) (RetentionPolicy, error) {
+	table, err := findRetentionTable(name)
+	if err != nil {
+		return RetentionPolicy{}, err
+	}
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", RetentionConfigKeyPrefix+name).First(&cfg).Error; err != nil {
+		return table.policy(nil), nil
+	}
+	return table.policy(&cfg), nil
+}
+
+// policy 由配置得到保留策略，配置无效时使用默认值
+func (t *retentionTable) policy(cfg *models.SystemConfig) RetentionPolicy {
+	policy := RetentionPolicy{Table: t.name, Days: t.defaultDays, Mode: t.defaultMode, MinDays: t.minDays}
+	if cfg == nil {
+		return policy
+	}
+	if v, err := strconv.Atoi(cfg.GetValue("days")); err == nil && (v == 0 || v >= t.minDays) {
+		policy.Days = v
+	}
+	for _, mode := range ArchiveModes {
+		if cfg.GetValue("mode") == mode {
+			policy.Mode = mode
+		}
+	}
+	return policy
+}
+
+// SaveRetentionPolicy 保存一张表的保留策略，days 为 0 表示不归档
+func SaveRetentionPolicy(name string, days int, mode string) error {
+	table, err := findRetentionTable(name)
+	if err != nil {
+		return err
+	}
+	if days < 0 || (days > 0 && days < table.minDays) {
+		return fmt.Errorf("%w: %s 至少保留 %d 天", ErrRetentionTooShort, name, table.minDays)
+	}
+	valid := false
+	for _, m := range ArchiveModes {
+		if m == mode {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("未知的归档方式: %s", mode)
+	}
+
+	key := RetentionConfigKeyPrefix + name
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", key).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: key,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"days": strconv.Itoa(days),
+		"mode": mode,
+	})
+	return config.DB.Save(&cfg).Error
+}
+
+// ArchiveStats 一次归档的结果
+type ArchiveStats struct {
+	Table    string
+	Mode     string
+	Archived int
+	File     string // 文件归档时写入的文件
+}
+
+// ArchiveExpired 按保留策略归档一张表中超过保留期的行，ctx 取消时处理完当前批次后停止
+func ArchiveExpired(ctx context.Context, name string) (stats ArchiveStats, err error) {
+	table, err := findRetentionTable(name)
+	if err != nil {
+		return stats, err
+	}
+	policy, err := LoadRetentionPolicy(name)
+	if err != nil {
+		return stats, err
+	}
+	stats = ArchiveStats{Table: name, Mode: policy.Mode}
+	if policy.Days == 0 {
+		return stats, nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -policy.Days)
+	where := table.timeColumn + " < ?"
+	if table.guard != "" {
+		where += " AND " + table.guard
+	}
+
+	var sink archiveSink
+	if policy.Mode == ArchiveModeFile {
+		sink = &fileArchiveSink{table: name}
+	} else {
+		sink = &tableArchiveSink{table: name}
+	}
+	defer func() {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	var lastID uint64
+	for ctx.Err() == nil {
+		var ids []uint64
+		if err = config.DB.Table(name).
+			Where(where, cutoff).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(archiveBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return stats, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		lastID = ids[len(ids)-1]
+
+		if err = sink.Write(ids); err != nil {
+			return stats, err
+		}
+		stats.Archived += len(ids)
+	}
+
+	if f, ok := sink.(*fileArchiveSink); ok {
+		stats.File = f.path
+	}
+	if stats.Archived > 0 {
+		log.Printf("已归档 %s 中 %d 行（%s）", name, stats.Archived, policy.Mode)
+	}
+	return stats, nil
+}
+
+// archiveSink 归档目标：写入一批行并从原表删除
+type archiveSink interface {
+	Write(ids []uint64) error
+	Close() error
+}
+
+// tableArchiveSink 移到归档表，插入和删除在同一个事务中
+type tableArchiveSink struct {
+	table   string
+	columns []string
+}
+
+func (s *tableArchiveSink) Write(ids []uint64) error {
+	if s.columns == nil {
+		columns, err := ensureArchiveTable(s.table)
+		if err != nil {
+			return err
+		}
+		s.columns = columns
+	}
+
+	columns := strings.Join(s.columns, ", ")
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE id IN ?",
+			archiveTableName(s.table), columns, columns, s.table), ids).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", s.table), ids).Error
+	})
+}
+
+func (s *tableArchiveSink) Close() error {
+	return nil
+}
+
+// fileArchiveSink 写入本地压缩文件，每批写完并落盘后才从原表删除
+type fileArchiveSink struct {
+	table string
+	path  string
+	file  *os.File
+	gz    *gzip.Writer
+}
+
+func (s *fileArchiveSink) Write(ids []uint64) error {
+	if s.file == nil {
+		dir := filepath.Join(config.Config.ArchiveDir, s.table)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		s.path = filepath.Join(dir, fmt.Sprintf("%s-%s.ndjson.gz", s.table, time.Now().Format("20060102-150405")))
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = file
+		s.gz = gzip.NewWriter(file)
+	}
+
+	var rows []map[string]interface{}
+	if err := config.DB.Table(s.table).Where("id IN ?", ids).Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(s.gz)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := s.gz.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	return config.DB.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", s.table), ids).Error
+}
+
+func (s *fileArchiveSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	if err := s.gz.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// archiveTableName 归档表名
+func archiveTableName(table string) string {
+	return table + "_archive"
+}
+
+// ensureArchiveTable 创建归档表，并补齐原表后来新增的列，返回原表的列名
+func ensureArchiveTable(table string) ([]string, error) {
+	archive := archiveTableName(table)
+	if err := config.DB.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", archive, table)).Error; err != nil {
+		return nil, err
+	}
+
+	sourceColumns, err := config.DB.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, err
+	}
+	archiveColumns, err := config.DB.Migrator().ColumnTypes(archive)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(archiveColumns))
+	for _, column := range archiveColumns {
+		existing[column.Name()] = true
+	}
+
+	columns := make([]string, 0, len(sourceColumns))
+	for _, column := range sourceColumns {
+		columns = append(columns, column.Name())
+		if existing[column.Name()] {
+			continue
+		}
+		columnType, ok := column.ColumnType()
+		if !ok {
+			columnType = column.DatabaseTypeName()
+		}
+		if err := config.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s NULL", archive, column.Name(), columnType)).Error; err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
+
+// RestoreOptions 恢复归档的范围：File 不为空时从归档文件恢复，否则从归档表恢复 From（含）到 To（不含）之间的行
+type RestoreOptions struct {
+	File string
+	From time.Time
+	To   time.Time
+}
+
+// RestoreArchive 把归档的行恢复到原表，原表中已存在的行（相同 ID）跳过，返回恢复的行数
+func RestoreArchive(name string, opts RestoreOptions) (int, error) {
+	table, err := findRetentionTable(name)
+	if err != nil {
+		return 0, err
+	}
+	if opts.File != "" {
+		return restoreFromFile(table, opts.File)
+	}
+	return restoreFromTable(table, opts.From, opts.To)
+}
+
+// restoreFromTable 从归档表按时间范围恢复，插入原表和从归档表删除在同一个事务中
+func restoreFromTable(table *retentionTable, from, to time.Time) (int, error) {
+	archive := archiveTableName(table.name)
+	if !config.DB.Migrator().HasTable(archive) {
+		return 0, fmt.Errorf("归档表 %s 不存在", archive)
+	}
+	sourceColumns, err := config.DB.Migrator().ColumnTypes(table.name)
+	if err != nil {
+		return 0, err
+	}
+	archiveColumns, err := config.DB.Migrator().ColumnTypes(archive)
+	if err != nil {
+		return 0, err
+	}
+	inArchive := make(map[string]bool, len(archiveColumns))
+	for _, column := range archiveColumns {
+		inArchive[column.Name()] = true
+	}
+	var names []string
+	for _, column := range sourceColumns {
+		if inArchive[column.Name()] {
+			names = append(names, column.Name())
+		}
+	}
+	columns := strings.Join(names, ", ")
+
+	query := config.DB.Table(archive)
+	if !from.IsZero() {
+		query = query.Where(table.timeColumn+" >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where(table.timeColumn+" < ?", to)
+	}
+
+	restored := 0
+	var lastID uint64
+	for {
+		var ids []uint64
+		if err := query.Session(&gorm.Session{}).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(archiveBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return restored, err
+		}
+		if len(ids) == 0 {
+			return restored, nil
+		}
+		lastID = ids[len(ids)-1]
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Exec(fmt.Sprintf("INSERT IGNORE INTO %s (%s) SELECT %s FROM %s WHERE id IN ?",
+				table.name, columns, columns, archive), ids)
+			if result.Error != nil {
+				return result.Error
+			}
+			restored += int(result.RowsAffected)
+			return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", archive), ids).Error
+		})
+		if err != nil {
+			return restored, err
+		}
+	}
+}
+
+// restoreFromFile 从归档文件恢复，文件保留不删除（重复恢复时已存在的行会跳过）
+func restoreFromFile(table *retentionTable, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	// JSON 中的时间是字符串，按原表的列类型转换回时间
+	columnTypes, err := config.DB.Migrator().ColumnTypes(table.name)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(columnTypes))
+	timeColumns := make(map[string]bool)
+	for _, column := range columnTypes {
+		known[column.Name()] = true
+		switch strings.ToUpper(column.DatabaseTypeName()) {
+		case "DATETIME", "TIMESTAMP", "DATE":
+			timeColumns[column.Name()] = true
+		}
+	}
+
+	restored := 0
+	flush := func(rows []map[string]interface{}) error {
+		result := config.DB.Table(table.name).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+		restored += int(result.RowsAffected)
+		return result.Error
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(gz))
+	decoder.UseNumber()
+	var batch []map[string]interface{}
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return restored, fmt.Errorf("读取归档文件失败（已恢复 %d 行）: %v", restored, err)
+		}
+
+		for column, value := range row {
+			if !known[column] {
+				delete(row, column) // 原表已删除的列
+				continue
+			}
+			if s, ok := value.(string); ok && timeColumns[column] {
+				t, err := time.Parse(time.RFC3339Nano, s)
+				if err != nil {
+					return restored, fmt.Errorf("列 %s 的时间格式错误: %v", column, err)
+				}
+				row[column] = t
+			}
+		}
+		batch = append(batch, row)
+		if len(batch) >= archiveBatchSize {
+			if err := flush(batch); err != nil {
+				return restored, err
+			}
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/cronexpr"
+	"collision-backend/models"
+)
+
+// 后台任务调度：
+// 每个后台任务按 cron 表达式执行，表达式和暂停状态保存在 system_configs（job_schedule:<任务名>），管理员修改后所有实例一分钟内生效；
+// 多实例部署时到点执行和手动触发都只在持有该任务租约的实例上执行（见 LeaderElector），同一任务上一次还没执行完时跳过本次，不会重叠执行。
+// 服务关闭时停止调度，正在执行的任务收到取消的 ctx（见 Shutdown）。
+// 最近一次执行的时间、耗时、结果和下一次计划执行时间写入 scheduled_jobs。
+
+// SchedulerConfigKeyPrefix 任务执行计划在 system_configs 中的配置键前缀
+const SchedulerConfigKeyPrefix = "job_schedule:"
+
+// 任务执行结果
+const (
+	JobStatusSuccess = "success"
+	JobStatusFailed  = "failed"
+)
+
+// schedulerReloadInterval 重新读取执行计划配置的间隔（其他实例修改的配置在这个时间内生效）
+const schedulerReloadInterval = time.Minute
+
+var (
+	ErrUnknownJob = errors.New("未知的后台任务")
+	ErrJobRunning = errors.New("任务正在执行")
+)
+
+// NotLeaderError 手动触发时本实例没有持有任务的租约，Holder 为当前持有者（没有时为空）
+type NotLeaderError struct {
+	Job    string
+	Holder string
+}
+
+func (e *NotLeaderError) Error() string {
+	return fmt.Sprintf("本实例不是任务 %s 的执行者，当前执行实例: %s", e.Job, e.Holder)
+}
+
+// JobSpec 注册到调度器的后台任务
+type JobSpec struct {
+	Name        string // 同时作为选主的任务名（见 Job*）
+	Description string
+	DefaultCron string
+	RunOnStart  bool // 启动时立即执行一次（不受暂停状态影响）
+	// Run 执行任务，ctx 在服务关闭时取消，manual 为 true 表示管理员手动触发
+	Run func(ctx context.Context, manual bool)
+	// Follower 到点时未持有租约的实例执行（如刷新本地索引），可为空
+	Follower func()
+}
+
+// scheduledJob 调度器中的任务及其当前执行计划
+type scheduledJob struct {
+	spec     JobSpec
+	cron     string
+	schedule cronexpr.Schedule
+	paused   bool
+	next     time.Time
+	running  atomic.Bool
+}
+
+// JobInfo 任务的执行计划和状态（管理后台展示）
+type JobInfo struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Cron           string     `json:"cron"`
+	DefaultCron    string     `json:"defaultCron"`
+	Paused         bool       `json:"paused"`
+	Running        bool       `json:"running"` // 本实例是否正在执行
+	IsLeader       bool       `json:"isLeader"`
+	NextRunAt      *time.Time `json:"nextRunAt"`
+	LastRunAt      *time.Time `json:"lastRunAt"`
+	LastFinishedAt *time.Time `json:"lastFinishedAt"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastStatus     string     `json:"lastStatus"`
+	LastError      string     `json:"lastError"`
+	LastInstance   string     `json:"lastInstance"`
+}
+
+// Scheduler 后台任务调度器
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     map[string]*scheduledJob
+	order    []string
+	loadedAt time.Time
+}
+
+var sharedScheduler = &Scheduler{jobs: make(map[string]*scheduledJob)}
+
+// JobScheduler 获取进程内共享的调度器
+func JobScheduler() *Scheduler {
+	return sharedScheduler
+}
+
+// Register 注册后台任务（需在 Start 之前调用）
+func (s *Scheduler) Register(spec JobSpec) {
+	schedule, err := cronexpr.Parse(spec.DefaultCron)
+	if err != nil {
+		panic(fmt.Sprintf("任务 %s 的默认执行计划无效: %v", spec.Name, err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[spec.Name]; !ok {
+		s.order = append(s.order, spec.Name)
+	}
+	s.jobs[spec.Name] = &scheduledJob{spec: spec, cron: spec.DefaultCron, schedule: schedule}
+}
+
+// Start 读取执行计划、竞选各任务的租约并开始调度，服务关闭时停止
+func (s *Scheduler) Start() {
+	s.reload()
+
+	s.mu.Lock()
+	jobs := make([]*scheduledJob, 0, len(s.order))
+	for _, name := range s.order {
+		jobs = append(jobs, s.jobs[name])
+	}
+	s.mu.Unlock()
+
+	// 多实例部署时每个任务只由持有租约的实例执行
+	for _, job := range jobs {
+		Leader().Campaign(job.spec.Name)
+	}
+	for _, job := range jobs {
+		if job.spec.RunOnStart {
+			s.dispatch(job, false)
+		}
+	}
+	log.Printf("后台任务调度已启动，任务数: %d", len(jobs))
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-BackgroundContext().Done():
+				log.Println("后台任务调度已停止")
+				return
+			case now := <-ticker.C:
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+// tick 执行到点的任务
+func (s *Scheduler) tick(now time.Time) {
+	if now.Sub(s.loadedAt) >= schedulerReloadInterval {
+		s.reload()
+	}
+
+	var due []*scheduledJob
+	s.mu.Lock()
+	for _, name := range s.order {
+		job := s.jobs[name]
+		if job.paused || job.next.IsZero() || now.Before(job.next) {
+			continue
+		}
+		job.next = job.schedule.Next(now)
+		due = append(due, job)
+	}
+	s.mu.Unlock()
+
+	for _, job := range due {
+		if err := s.dispatch(job, false); errors.Is(err, ErrJobRunning) {
+			log.Printf("任务 %s 上一次执行尚未结束，跳过本次", job.spec.Name)
+		}
+	}
+}
+
+// dispatch 在后台执行任务，同一任务正在执行时返回 ErrJobRunning，服务关闭中返回 ErrShuttingDown
+func (s *Scheduler) dispatch(job *scheduledJob, manual bool) error {
+	if !job.running.CompareAndSwap(false, true) {
+		return ErrJobRunning
+	}
+	started := startBackground(func() {
+		defer job.running.Store(false)
+		s.execute(job, manual)
+	})
+	if !started {
+		job.running.Store(false)
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// execute 执行一次任务并记录结果；未持有租约的实例不执行，计划执行时只执行 Follower
+func (s *Scheduler) execute(job *scheduledJob, manual bool) {
+	name := job.spec.Name
+	if !Leader().IsLeader(name) {
+		if manual {
+			log.Printf("任务 %s 手动触发后本实例失去执行权，跳过", name)
+			return
+		}
+		if job.spec.Follower != nil {
+			job.spec.Follower()
+		}
+		return
+	}
+
+	startedAt := time.Now()
+	status, lastError := JobStatusSuccess, ""
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				status, lastError = JobStatusFailed, fmt.Sprint(r)
+				log.Printf("❌ 任务 %s 执行失败: %v\n%s", name, r, debug.Stack())
+			}
+		}()
+		job.spec.Run(BackgroundContext(), manual)
+	}()
+	finishedAt := time.Now()
+
+	if r := []rune(lastError); len(r) > 500 {
+		lastError = string(r[:500])
+	}
+	state := models.ScheduledJob{
+		Name:           name,
+		LastRunAt:      &startedAt,
+		LastFinishedAt: &finishedAt,
+		LastDurationMs: finishedAt.Sub(startedAt).Milliseconds(),
+		LastStatus:     status,
+		LastError:      lastError,
+		LastInstance:   Leader().InstanceID(),
+		NextRunAt:      s.nextRun(job),
+	}
+	if err := config.DB.Save(&state).Error; err != nil {
+		log.Printf("保存任务 %s 的执行状态失败: %v", name, err)
+	}
+}
+
+// nextRun 任务的下一次计划执行时间，暂停时为 nil
+func (s *Scheduler) nextRun(job *scheduledJob) *time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.paused || job.next.IsZero() {
+		return nil
+	}
+	next := job.next
+	return &next
+}
+
+// saveNextRun 执行计划变化后更新 scheduled_jobs 中的下一次执行时间
+func (s *Scheduler) saveNextRun(job *scheduledJob) {
+	state := models.ScheduledJob{Name: job.spec.Name}
+	if err := config.DB.Where(state).FirstOrCreate(&state).Error; err != nil {
+		log.Printf("保存任务 %s 的执行状态失败: %v", job.spec.Name, err)
+		return
+	}
+	if err := config.DB.Model(&state).Update("next_run_at", s.nextRun(job)).Error; err != nil {
+		log.Printf("保存任务 %s 的执行状态失败: %v", job.spec.Name, err)
+	}
+}
+
+// reload 重新读取各任务的执行计划和暂停状态，计划变化或恢复执行时重新计算下一次执行时间
+func (s *Scheduler) reload() {
+	s.loadedAt = time.Now()
+
+	var configs []models.SystemConfig
+	if err := config.DB.Where("config_key LIKE ?", SchedulerConfigKeyPrefix+"%").Find(&configs).Error; err != nil {
+		log.Printf("读取任务执行计划失败: %v", err)
+		return
+	}
+	byKey := make(map[string]*models.SystemConfig, len(configs))
+	for i := range configs {
+		byKey[configs[i].ConfigKey] = &configs[i]
+	}
+
+	var changed []*scheduledJob
+	s.mu.Lock()
+	for _, name := range s.order {
+		job := s.jobs[name]
+		cron, paused := job.spec.DefaultCron, false
+		if cfg, ok := byKey[SchedulerConfigKeyPrefix+name]; ok {
+			if v := cfg.GetValue("cron"); v != "" {
+				cron = v
+			}
+			paused = cfg.GetValue("paused") == "true"
+		}
+		if s.apply(job, cron, paused) {
+			changed = append(changed, job)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range changed {
+		s.saveNextRun(job)
+	}
+}
+
+// apply 更新任务的执行计划（调用方需持有 s.mu），返回下一次执行时间是否变化
+func (s *Scheduler) apply(job *scheduledJob, cron string, paused bool) bool {
+	if cron == job.cron && paused == job.paused && !job.next.IsZero() {
+		return false
+	}
+	schedule, err := cronexpr.Parse(cron)
+	if err != nil {
+		log.Printf("任务 %s 的执行计划无效，使用默认计划: %v", job.spec.Name, err)
+		cron = job.spec.DefaultCron
+		schedule, _ = cronexpr.Parse(cron)
+	}
+	job.cron, job.schedule, job.paused = cron, schedule, paused
+	job.next = schedule.Next(time.Now())
+	return true
+}
+
+// job 按名称查找任务
+func (s *Scheduler) job(name string) (*scheduledJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return job, nil
+}
+
+// Jobs 所有任务的执行计划和状态
+func (s *Scheduler) Jobs() []JobInfo {
+	var states []models.ScheduledJob
+	config.DB.Find(&states)
+	byName := make(map[string]models.ScheduledJob, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]JobInfo, 0, len(s.order))
+	for _, name := range s.order {
+		job := s.jobs[name]
+		state := byName[name]
+		info := JobInfo{
+			Name:           name,
+			Description:    job.spec.Description,
+			Cron:           job.cron,
+			DefaultCron:    job.spec.DefaultCron,
+			Paused:         job.paused,
+			Running:        job.running.Load(),
+			IsLeader:       Leader().IsLeader(name),
+			LastRunAt:      state.LastRunAt,
+			LastFinishedAt: state.LastFinishedAt,
+			LastDurationMs: state.LastDurationMs,
+			LastStatus:     state.LastStatus,
+			LastError:      state.LastError,
+			LastInstance:   state.LastInstance,
+		}
+		if !job.paused && !job.next.IsZero() {
+			next := job.next
+			info.NextRunAt = &next
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// SetCron 修改任务的执行计划，cron 为空时恢复默认计划；表达式无效或永远不会执行（如 2 月 31 日）时返回错误
+func (s *Scheduler) SetCron(name, cron string) error {
+	job, err := s.job(name)
+	if err != nil {
+		return err
+	}
+	if cron == "" {
+		cron = job.spec.DefaultCron
+	}
+	if _, err := cronexpr.Parse(cron); err != nil {
+		return err
+	}
+	return s.update(job, cron, job.paused)
+}
+
+// Pause 暂停任务的计划执行（仍可手动触发）
+func (s *Scheduler) Pause(name string) error {
+	job, err := s.job(name)
+	if err != nil {
+		return err
+	}
+	return s.update(job, job.cron, true)
+}
+
+// Resume 恢复任务的计划执行，从现在起按执行计划计算下一次执行时间
+func (s *Scheduler) Resume(name string) error {
+	job, err := s.job(name)
+	if err != nil {
+		return err
+	}
+	return s.update(job, job.cron, false)
+}
+
+// Trigger 在本实例立即执行一次任务（不受暂停限制）。只有持有该任务租约的实例可以执行，保证同一任务不会在多个实例上同时执行：
+// 本实例不是执行者时返回 *NotLeaderError，任务正在执行时返回 ErrJobRunning，服务关闭中返回 ErrShuttingDown
+func (s *Scheduler) Trigger(name string) error {
+	job, err := s.job(name)
+	if err != nil {
+		return err
+	}
+	if !Leader().IsLeader(name) {
+		holder, _, err := Leader().store.Holder(name)
+		if err != nil {
+			return err
+		}
+		return &NotLeaderError{Job: name, Holder: holder}
+	}
+	return s.dispatch(job, true)
+}
+
+// update 保存任务的执行计划和暂停状态并在本实例立即生效
+func (s *Scheduler) update(job *scheduledJob, cron string, paused bool) error {
+	key := SchedulerConfigKeyPrefix + job.spec.Name
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", key).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey: key,
+		}
+	}
+	cfg.SetValues(map[string]string{
+		"cron":   cron,
+		"paused": fmt.Sprint(paused),
+	})
+	if err := config.DB.Save(&cfg).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	job.next = time.Time{} // 恢复执行或修改计划时从现在起重新计算
+	s.apply(job, cron, paused)
+	s.mu.Unlock()
+	s.saveNextRun(job)
+	return nil
+}
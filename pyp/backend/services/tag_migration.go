@@ -0,0 +1,188 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+	"collision-backend/tagnorm"
+
+	"gorm.io/gorm"
+)
+
+// TagMigrationStats 标签规范化迁移统计
+type TagMigrationStats struct {
+	CodesUpdated   int
+	ListsUpdated   int
+	ResultsUpdated int
+	HotTagsUpdated int
+	HotTagsMerged  int
+}
+
+// CanonicalizeTags 重新计算已有数据的标签规范形式，并合并规范形式相同的热门标签
+// dryRun 为 true 时只统计不写入
+func CanonicalizeTags(dryRun bool) (TagMigrationStats, error) {
+	var stats TagMigrationStats
+
+	// 1. 碰撞码（包含已删除的，保证恢复后也能正确匹配）
+	var codes []models.CollisionCode
+	err := config.DB.Unscoped().Select("id", "tag", "tag_canonical").
+		FindInBatches(&codes, 500, func(tx *gorm.DB, batch int) error {
+			for _, code := range codes {
+				display, canonical := tagnorm.Display(code.Tag), tagnorm.Canonical(code.Tag)
+				if display == code.Tag && canonical == code.TagCanonical {
+					continue
+				}
+				stats.CodesUpdated++
+				if dryRun {
+					continue
+				}
+				// UpdateColumns 不触发钩子、不刷新 updated_at
+				if err := config.DB.Unscoped().Model(&models.CollisionCode{}).Where("id = ?", code.ID).
+					UpdateColumns(map[string]interface{}{"tag": display, "tag_canonical": canonical}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return stats, err
+	}
+
+	// 2. 碰撞列表
+	var lists []models.CollisionList
+	err = config.DB.Select("id", "keyword", "keyword_canonical").
+		FindInBatches(&lists, 500, func(tx *gorm.DB, batch int) error {
+			for _, list := range lists {
+				display, canonical := tagnorm.Display(list.Keyword), tagnorm.Canonical(list.Keyword)
+				if display == list.Keyword && canonical == list.KeywordCanonical {
+					continue
+				}
+				stats.ListsUpdated++
+				if dryRun {
+					continue
+				}
+				if err := config.DB.Model(&models.CollisionList{}).Where("id = ?", list.ID).
+					UpdateColumns(map[string]interface{}{"keyword": display, "keyword_canonical": canonical}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return stats, err
+	}
+
+	// 3. 碰撞结果（关键词保留原样，只补规范形式）
+	var results []models.CollisionResult
+	err = config.DB.Select("id", "keyword", "keyword_canonical").
+		FindInBatches(&results, 500, func(tx *gorm.DB, batch int) error {
+			for _, result := range results {
+				canonical := tagnorm.Canonical(result.Keyword)
+				if canonical == result.KeywordCanonical {
+					continue
+				}
+				stats.ResultsUpdated++
+				if dryRun {
+					continue
+				}
+				if err := config.DB.Model(&models.CollisionResult{}).Where("id = ?", result.ID).
+					UpdateColumn("keyword_canonical", canonical).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return stats, err
+	}
+
+	// 4. 热门标签：规范形式相同的合并为一条
+	if err := mergeHotTags(dryRun, &stats); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// mergeHotTags 合并规范形式相同的热门标签，计数累加，保留计数最高的一条的展示形式
+func mergeHotTags(dryRun bool, stats *TagMigrationStats) error {
+	var tags []models.HotTag
+	if err := config.DB.Order("count_total DESC, id ASC").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	groups := make(map[string][]models.HotTag)
+	var order []string
+	for _, tag := range tags {
+		canonical := tagnorm.Canonical(tag.Keyword)
+		if _, ok := groups[canonical]; !ok {
+			order = append(order, canonical)
+		}
+		groups[canonical] = append(groups[canonical], tag)
+	}
+
+	for _, canonical := range order {
+		group := groups[canonical]
+		primary := group[0]
+		updates := map[string]interface{}{}
+
+		display := tagnorm.Display(primary.Keyword)
+		if display != primary.Keyword {
+			updates["keyword"] = display
+		}
+		if canonical != primary.KeywordCanonical {
+			updates["keyword_canonical"] = canonical
+		}
+
+		if len(group) > 1 {
+			count24h, countTotal, submitCount := 0, 0, 0
+			status := primary.Status
+			lastSearchAt := primary.LastSearchAt
+			var duplicateIDs []uint64
+			for _, tag := range group {
+				count24h += tag.Count24h
+				countTotal += tag.CountTotal
+				submitCount += tag.SubmitCount
+				// 任一写法被设为黑洞时，合并后保持黑洞
+				if tag.Status == "blackhole" {
+					status = "blackhole"
+				}
+				if tag.LastSearchAt != nil && (lastSearchAt == nil || tag.LastSearchAt.After(*lastSearchAt)) {
+					lastSearchAt = tag.LastSearchAt
+				}
+				if tag.ID != primary.ID {
+					duplicateIDs = append(duplicateIDs, tag.ID)
+				}
+			}
+			updates["count_24h"] = count24h
+			updates["count_total"] = countTotal
+			updates["submit_count"] = submitCount
+			updates["status"] = status
+			updates["last_search_at"] = lastSearchAt
+			stats.HotTagsMerged += len(duplicateIDs)
+
+			log.Printf("合并热门标签 %q: 保留#%d, 合并 %d 条", display, primary.ID, len(duplicateIDs))
+			if !dryRun {
+				// 先删除重复行，避免展示形式更新时触发唯一索引冲突
+				if err := config.DB.Where("id IN ?", duplicateIDs).Delete(&models.HotTag{}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(updates) == 0 {
+			continue
+		}
+		stats.HotTagsUpdated++
+		if dryRun {
+			continue
+		}
+		updates["updated_at"] = time.Now()
+		if err := config.DB.Model(&models.HotTag{}).Where("id = ?", primary.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
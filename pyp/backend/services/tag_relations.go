@@ -0,0 +1,284 @@
+package services
+
+import (
+	"log"
+	"strconv"
+
+	"collision-backend/config"
+	"collision-backend/models"
+)
+
+// TagFuzzyConfigKey 模糊匹配在 system_configs 中的配置键
+const TagFuzzyConfigKey = "tag_fuzzy"
+
+// 匹配类型
+const (
+	MatchTypeKeyword = "keyword" // 标签规范形式相同
+	MatchTypeSynonym = "synonym" // 管理员配置的同义词/别名
+	MatchTypeFuzzy   = "fuzzy"   // 编辑距离相近
+)
+
+// FuzzySetting 模糊匹配配置
+type FuzzySetting struct {
+	Enabled       bool    `json:"enabled"`
+	MaxDistance   int     `json:"max_distance"`   // 允许的最大编辑距离
+	MinSimilarity float64 `json:"min_similarity"` // 最小相似度 = 1 - 编辑距离/较长标签长度
+}
+
+// DefaultFuzzySetting 未配置时的模糊匹配设置（默认关闭）
+var DefaultFuzzySetting = FuzzySetting{Enabled: false, MaxDistance: 2, MinSimilarity: 0.6}
+
+// LoadFuzzySetting 读取系统配置中的模糊匹配设置
+func LoadFuzzySetting() FuzzySetting {
+	setting := DefaultFuzzySetting
+
+	var cfg models.SystemConfig
+	if err := config.DB.Where("config_key = ?", TagFuzzyConfigKey).First(&cfg).Error; err != nil {
+		return setting
+	}
+	setting.Enabled = cfg.GetValue("enabled") == "true"
+	if v, err := strconv.Atoi(cfg.GetValue("max_distance")); err == nil && v > 0 {
+		setting.MaxDistance = v
+	}
+	if v, err := strconv.ParseFloat(cfg.GetValue("min_similarity"), 64); err == nil && v > 0 && v <= 1 {
+		setting.MinSimilarity = v
+	}
+	return setting
+}
+
+// TagRelations 标签之间的关联关系（同义词 + 模糊匹配），一次匹配过程中加载一次
+type TagRelations struct {
+	synonyms map[string]map[string]bool // 规范形式 -> 同义的规范形式
+	fuzzy    FuzzySetting
+}
+
+// LoadTagRelations 从数据库加载同义词表和模糊匹配设置
+func LoadTagRelations() *TagRelations {
+	relations := &TagRelations{
+		synonyms: make(map[string]map[string]bool),
+		fuzzy:    LoadFuzzySetting(),
+	}
+
+	var synonyms []models.TagSynonym
+	if err := config.DB.Find(&synonyms).Error; err != nil {
+		log.Printf("⚠️ 加载标签同义词失败: %v", err)
+		return relations
+	}
+
+	// 同一个关键词下的所有写法互为同义词
+	groups := make(map[string][]string)
+	for _, s := range synonyms {
+		if s.KeywordCanonical == "" || s.SynonymCanonical == "" {
+			continue
+		}
+		groups[s.KeywordCanonical] = append(groups[s.KeywordCanonical], s.SynonymCanonical)
+	}
+	for keyword, group := range groups {
+		members := append([]string{keyword}, group...)
+		for _, a := range members {
+			for _, b := range members {
+				if a != b {
+					relations.link(a, b)
+				}
+			}
+		}
+	}
+	return relations
+}
+
+func (r *TagRelations) link(a, b string) {
+	if r.synonyms[a] == nil {
+		r.synonyms[a] = make(map[string]bool)
+	}
+	r.synonyms[a][b] = true
+}
+
+// Relation 返回两个标签（规范形式）之间的匹配类型，不相关时返回空字符串
+func (r *TagRelations) Relation(a, b string) string {
+	return r.relation(a, b, r.FuzzyEnabled())
+}
+
+// relationIn 只考虑 types 中的关联类型（匹配模式接受的类型），其中包括 fuzzy 时不受模糊匹配开关影响
+func (r *TagRelations) relationIn(a, b string, types map[string]bool) string {
+	if t := r.relation(a, b, types[MatchTypeFuzzy]); types[t] {
+		return t
+	}
+	return ""
+}
+
+func (r *TagRelations) relation(a, b string, fuzzy bool) string {
+	if a == "" || b == "" {
+		return ""
+	}
+	if a == b {
+		return MatchTypeKeyword
+	}
+	if r == nil {
+		return ""
+	}
+	if r.synonyms[a][b] {
+		return MatchTypeSynonym
+	}
+	if fuzzy && r.fuzzyMatch(a, b) {
+		return MatchTypeFuzzy
+	}
+	return ""
+}
+
+// FuzzyEnabled 是否开启了模糊匹配
+func (r *TagRelations) FuzzyEnabled() bool {
+	return r != nil && r.fuzzy.Enabled
+}
+
+// Synonyms 标签在同义词表中的所有同义词（规范形式）
+func (r *TagRelations) Synonyms(tag string) []string {
+	synonyms := []string{}
+	if r == nil {
+		return synonyms
+	}
+	for synonym := range r.synonyms[tag] {
+		synonyms = append(synonyms, synonym)
+	}
+	return synonyms
+}
+
+// Related 从候选标签中找出与 tag 相关（同义或模糊）的标签，不包含 tag 本身
+func (r *TagRelations) Related(tag string, candidates []string) []string {
+	related := []string{}
+	if r == nil {
+		return related
+	}
+	for _, candidate := range candidates {
+		if candidate != tag && r.Relation(tag, candidate) != "" {
+			related = append(related, candidate)
+		}
+	}
+	return related
+}
+
+// relatedIn 从候选标签中找出与 tag 以 types 中的关联类型相关的标签，不包含 tag 本身
+func (r *TagRelations) relatedIn(tag string, candidates []string, types map[string]bool) []string {
+	related := []string{}
+	if r == nil {
+		return related
+	}
+	for _, candidate := range candidates {
+		if candidate != tag && r.relationIn(tag, candidate, types) != "" {
+			related = append(related, candidate)
+		}
+	}
+	return related
+}
+
+// fuzzyMatch 编辑距离和相似度同时满足配置时视为模糊匹配
+func (r *TagRelations) fuzzyMatch(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	longer := len(ra)
+	if len(rb) > longer {
+		longer = len(rb)
+	}
+	// 长度差已超过允许距离时无需计算
+	if diff := len(ra) - len(rb); diff > r.fuzzy.MaxDistance || -diff > r.fuzzy.MaxDistance {
+		return false
+	}
+
+	distance := levenshtein(ra, rb)
+	if distance > r.fuzzy.MaxDistance {
+		return false
+	}
+	return 1-float64(distance)/float64(longer) >= r.fuzzy.MinSimilarity
+}
+
+// levenshtein 按字符（rune）计算编辑距离
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// TagOverlap 两个碰撞码标签集合的重合情况
+type TagOverlap struct {
+	MatchType string   // 重合标签中最弱的关联类型（keyword 强于 synonym 强于 fuzzy）
+	Tags1     []string // 第一个碰撞码中重合的标签（展示形式）
+	Tags2     []string // 第二个碰撞码中与之对应的标签
+}
+
+// Count 重合的标签数
+func (o TagOverlap) Count() int {
+	return len(o.Tags1)
+}
+
+// matchTypeRank 关联类型的强弱，数值越小越强
+var matchTypeRank = map[string]int{MatchTypeKeyword: 1, MatchTypeSynonym: 2, MatchTypeFuzzy: 3}
+
+// Overlap 逐个为 code1 的标签在 code2 中寻找关联最强、且尚未被占用的标签
+// 单标签碰撞码视为只有一个标签的集合
+func (r *TagRelations) Overlap(code1, code2 *models.CollisionCode) TagOverlap {
+	return r.OverlapWith(code1, code2, nil)
+}
+
+// OverlapWith 与 Overlap 相同，但只考虑 types 中的关联类型（双方匹配模式都接受的类型），types 为 nil 时不限制
+func (r *TagRelations) OverlapWith(code1, code2 *models.CollisionCode, types map[string]bool) TagOverlap {
+	display1, canonical1 := code1.TagList(), code1.CanonicalTags()
+	display2, canonical2 := code2.TagList(), code2.CanonicalTags()
+
+	var overlap TagOverlap
+	used := make([]bool, len(canonical2))
+	for i, a := range canonical1 {
+		best, bestType := -1, ""
+		for j, b := range canonical2 {
+			if used[j] {
+				continue
+			}
+			t := r.Relation(a, b)
+			if types != nil {
+				t = r.relationIn(a, b, types)
+			}
+			if t != "" && (bestType == "" || matchTypeRank[t] < matchTypeRank[bestType]) {
+				best, bestType = j, t
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		overlap.Tags1 = append(overlap.Tags1, tagAt(display1, i, a))
+		overlap.Tags2 = append(overlap.Tags2, tagAt(display2, best, canonical2[best]))
+		if matchTypeRank[bestType] > matchTypeRank[overlap.MatchType] {
+			overlap.MatchType = bestType
+		}
+	}
+	return overlap
+}
+
+// tagAt 取展示形式的标签，数据不一致时退回规范形式
+func tagAt(tags []string, i int, fallback string) string {
+	if i < len(tags) {
+		return tags[i]
+	}
+	return fallback
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 需要数据库的测试连接环境变量指定的测试库，未设置时跳过：
+//   TEST_MYSQL_DSN  例如 root:@tcp(127.0.0.1:3306)/collision_test?charset=utf8mb4&parseTime=True&loc=Local
+//   TEST_REDIS_ADDR 例如 127.0.0.1:6379
+// 测试会清空用到的表和 Redis 中测试前缀下的键，不要指向正式环境。
+
+// useTestDB 连接测试库并替换 config.DB，建好 tables 对应的表并清空，测试结束后恢复
+func useTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过需要 MySQL 的测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			t.Fatalf("解析表名失败: %v", err)
+		}
+		if err := db.Exec("DELETE FROM " + stmt.Schema.Table).Error; err != nil {
+			t.Fatalf("清空 %s 失败: %v", stmt.Schema.Table, err)
+		}
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// useTestRedis 连接测试 Redis，返回本测试专用的键前缀，测试结束后删除该前缀下的键
+func useTestRedis(t *testing.T) (*redis.Client, string) {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("未设置 TEST_REDIS_ADDR，跳过需要 Redis 的测试")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("连接测试 Redis 失败: %v", err)
+	}
+
+	prefix := fmt.Sprintf("collision:test:%s:%d:", t.Name(), os.Getpid())
+	t.Cleanup(func() {
+		if keys, err := client.Keys(ctx, prefix+"*").Result(); err == nil && len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+		client.Close()
+	})
+	return client, prefix
+}
+
+// testUserSeq 测试用户的序号，用于生成不重复的 OpenID
+var testUserSeq int
+
+// createTestUser 创建一个余额为 coins 的用户（不写流水）
+func createTestUser(t *testing.T, db *gorm.DB, coins int) *models.User {
+	t.Helper()
+	testUserSeq++
+	user := &models.User{OpenID: fmt.Sprintf("test-user-%d", testUserSeq)}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := db.Model(user).UpdateColumn("coins", coins).Error; err != nil {
+		t.Fatalf("设置余额失败: %v", err)
+	}
+	user.Coins = coins
+	return user
+}
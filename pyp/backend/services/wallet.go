@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"collision-backend/config"
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 金币钱包：
+// 所有余额变动都通过 Debit / Credit / SetBalance 完成。扣除时按 coins >= amount 条件原子更新，并发请求不会透支；
+// 每次变动在同一事务中写入一条流水（wallet_ledgers，记录变动后的余额和关联的业务对象），扣除和增加同时写入消费记录。
+// 启用钱包时为已有用户写入期初余额流水，此后每个用户的 coins 应等于其流水合计，对账任务定期检查并标记不一致的用户。
+
+// walletOpeningConfigKey 期初余额已写入的标记（system_configs），保证只写入一次
+const walletOpeningConfigKey = "wallet_opening_balances"
+
+// 流水类型（其余与消费记录类型一致）
+const (
+	LedgerTypeOpening     = "opening"      // 期初余额
+	LedgerTypeAdminAdjust = "admin_adjust" // 管理员修改余额
+)
+
+// 流水关联的业务对象类型
+const (
+	RefCollisionCode   = "collision_code"
+	RefCollisionList   = "collision_list"
+	RefCollisionRecord = "collision_record"
+	RefCollisionResult = "collision_result"
+	RefRechargeRecord  = "recharge_record"
+	RefUser            = "user" // 海底捞捞到的用户
+	RefAdmin           = "admin"
+)
+
+var (
+	// ErrInsufficientCoins 金币不足
+	ErrInsufficientCoins = errors.New("金币不足")
+	// ErrInvalidAmount 金币数量必须为正数
+	ErrInvalidAmount = errors.New("金币数量必须为正数")
+)
+
+// LedgerEntry 一次余额变动对应的业务信息
+type LedgerEntry struct {
+	Type    string // 消费记录类型：collision, force_add, haidilao, refund, recharge ...
+	Reason  string
+	RefType string // 关联的业务对象（Ref*），没有时为空
+	RefID   uint64
+}
+
+// Debit 余额足够时扣除 amount 金币并写入流水和消费记录，返回扣除后的余额；余额不足时返回 ErrInsufficientCoins。
+// db 可以是调用方的事务，扣除随调用方事务一起提交或回滚
+func Debit(db *gorm.DB, userID uint, amount int, entry LedgerEntry) (balance int, err error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND coins >= ?", userID, amount).
+			UpdateColumn("coins", gorm.Expr("coins - ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientCoins
+		}
+		if balance, err = walletBalance(tx, userID); err != nil {
+			return err
+		}
+		return writeLedger(tx, userID, -amount, balance, entry, true)
+	})
+	return balance, err
+}
+
+// Credit 增加 amount 金币并写入流水和消费记录，返回增加后的余额
+func Credit(db *gorm.DB, userID uint, amount int, entry LedgerEntry) (balance int, err error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			UpdateColumn("coins", gorm.Expr("coins + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if balance, err = walletBalance(tx, userID); err != nil {
+			return err
+		}
+		return writeLedger(tx, userID, amount, balance, entry, true)
+	})
+	return balance, err
+}
+
+// SetBalance 将余额直接改为 coins（管理员修改），按差额写入流水，不写消费记录
+func SetBalance(db *gorm.DB, userID uint, coins int, entry LedgerEntry) error {
+	if coins < 0 {
+		return ErrInvalidAmount
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "coins").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.Coins == coins {
+			return nil
+		}
+		if err := tx.Model(&user).UpdateColumn("coins", coins).Error; err != nil {
+			return err
+		}
+		return writeLedger(tx, userID, coins-user.Coins, coins, entry, false)
+	})
+}
+
+// walletBalance 读取当前余额（在扣除/增加的同一事务中读取，即变动后的余额）
+func walletBalance(tx *gorm.DB, userID uint) (int, error) {
+	var user models.User
+	if err := tx.Select("coins").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	return user.Coins, nil
+}
+
+// writeLedger 写入一条流水，consume 为 true 时同时写入消费记录
+func writeLedger(tx *gorm.DB, userID uint, amount, balance int, entry LedgerEntry, consume bool) error {
+	reason := entry.Reason
+	if r := []rune(reason); len(r) > 100 {
+		reason = string(r[:100])
+	}
+	if err := tx.Create(&models.WalletLedger{
+		UserID:       userID,
+		Amount:       amount,
+		BalanceAfter: balance,
+		Type:         entry.Type,
+		Reason:       reason,
+		RefType:      entry.RefType,
+		RefID:        entry.RefID,
+	}).Error; err != nil {
+		return err
+	}
+	if !consume {
+		return nil
+	}
+	if amount < 0 {
+		amount = -amount
+	}
+	return tx.Create(&models.ConsumeRecord{
+		UserID: userID,
+		Coins:  amount,
+		Type:   entry.Type,
+		Reason: reason,
+	}).Error
+}
+
+// InitWalletLedger 首次启用钱包时为余额不为 0 的用户写入期初余额流水，已写入过时直接返回
+func InitWalletLedger() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		marker := models.SystemConfig{
+			ConfigKey:   walletOpeningConfigKey,
+			ConfigValue: time.Now().Format(time.RFC3339),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&marker)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		result = tx.Exec(`INSERT INTO wallet_ledgers (user_id, amount, balance_after, type, reason, created_at)
+			SELECT id, coins, coins, ?, ?, ? FROM users
+			WHERE deleted_at IS NULL AND coins <> 0`,
+			LedgerTypeOpening, "Opening balance", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		log.Printf("已为 %d 个用户写入期初余额流水", result.RowsAffected)
+		return nil
+	})
+}
+
+// ReconcileWallets 对账：比较每个用户的 coins 和流水合计，更新不一致用户列表，返回不一致的用户数
+func ReconcileWallets() (int, error) {
+	var rows []struct {
+		UserID    uint
+		Coins     int
+		LedgerSum int
+	}
+	err := config.DB.Raw(`SELECT u.id AS user_id, u.coins AS coins, COALESCE(SUM(l.amount), 0) AS ledger_sum
+		FROM users u LEFT JOIN wallet_ledgers l ON l.user_id = u.id
+		WHERE u.deleted_at IS NULL
+		GROUP BY u.id, u.coins
+		HAVING u.coins <> COALESCE(SUM(l.amount), 0)`).Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 保留仍不一致用户的首次发现时间，已恢复一致的用户从列表中移除
+		var existing []models.WalletDiscrepancy
+		if err := tx.Find(&existing).Error; err != nil {
+			return err
+		}
+		detectedAt := make(map[uint]time.Time, len(existing))
+		for _, d := range existing {
+			detectedAt[d.UserID] = d.DetectedAt
+		}
+		if err := tx.Where("1 = 1").Delete(&models.WalletDiscrepancy{}).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			discrepancy := models.WalletDiscrepancy{
+				UserID:     row.UserID,
+				Coins:      row.Coins,
+				LedgerSum:  row.LedgerSum,
+				DetectedAt: now,
+				CheckedAt:  now,
+			}
+			if t, ok := detectedAt[row.UserID]; ok {
+				discrepancy.DetectedAt = t
+			}
+			if err := tx.Create(&discrepancy).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		log.Printf("⚠️ 金币对账不一致: user_id=%d coins=%d 流水合计=%d", row.UserID, row.Coins, row.LedgerSum)
+	}
+	return len(rows), nil
+}
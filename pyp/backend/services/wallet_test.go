@@ -0,0 +1,263 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"collision-backend/models"
+
+	"gorm.io/gorm"
+)
+
+var walletTables = []interface{}{&models.User{}, &models.WalletLedger{}, &models.WalletDiscrepancy{}, &models.ConsumeRecord{}, &models.SystemConfig{}}
+
+// userCoins 数据库中用户的当前余额
+func userCoins(t *testing.T, db *gorm.DB, userID uint) int {
+	t.Helper()
+	var user models.User
+	if err := db.Select("coins").First(&user, userID).Error; err != nil {
+		t.Fatalf("读取余额失败: %v", err)
+	}
+	return user.Coins
+}
+
+// userLedger 用户的全部流水（按写入顺序）
+func userLedger(t *testing.T, db *gorm.DB, userID uint) []models.WalletLedger {
+	t.Helper()
+	var entries []models.WalletLedger
+	if err := db.Where("user_id = ?", userID).Order("id ASC").Find(&entries).Error; err != nil {
+		t.Fatalf("读取流水失败: %v", err)
+	}
+	return entries
+}
+
+func TestDebitConcurrent(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	user := createTestUser(t, db, 100)
+
+	// 30 个请求并发扣除 10 金币，只有 10 个能成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, insufficient := 0, 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Debit(db, user.ID, 10, LedgerEntry{Type: "collision", Reason: "并发扣除"})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrInsufficientCoins):
+				insufficient++
+			default:
+				t.Errorf("Debit: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 10 || insufficient != 20 {
+		t.Errorf("成功 %d 次、余额不足 %d 次，want 10 和 20", succeeded, insufficient)
+	}
+	if coins := userCoins(t, db, user.ID); coins != 0 {
+		t.Errorf("余额 = %d, want 0", coins)
+	}
+	if entries := userLedger(t, db, user.ID); len(entries) != 10 {
+		t.Errorf("流水 %d 条，want 10", len(entries))
+	}
+}
+
+func TestDebitInsufficient(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	user := createTestUser(t, db, 5)
+
+	if _, err := Debit(db, user.ID, 10, LedgerEntry{Type: "collision"}); !errors.Is(err, ErrInsufficientCoins) {
+		t.Fatalf("Debit = %v, want ErrInsufficientCoins", err)
+	}
+	if coins := userCoins(t, db, user.ID); coins != 5 {
+		t.Errorf("余额不足时余额变为 %d, want 5", coins)
+	}
+	if entries := userLedger(t, db, user.ID); len(entries) != 0 {
+		t.Errorf("余额不足时写入了 %d 条流水", len(entries))
+	}
+	for _, amount := range []int{0, -1} {
+		if _, err := Debit(db, user.ID, amount, LedgerEntry{Type: "collision"}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Debit(%d) = %v, want ErrInvalidAmount", amount, err)
+		}
+		if _, err := Credit(db, user.ID, amount, LedgerEntry{Type: "refund"}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Credit(%d) = %v, want ErrInvalidAmount", amount, err)
+		}
+	}
+}
+
+func TestWalletRollbackWithCallerTransaction(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	user := createTestUser(t, db, 50)
+
+	errRollback := errors.New("业务失败")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := Debit(tx, user.ID, 20, LedgerEntry{Type: "collision"}); err != nil {
+			return err
+		}
+		if _, err := Credit(tx, user.ID, 5, LedgerEntry{Type: "refund"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction = %v, want %v", err, errRollback)
+	}
+
+	if coins := userCoins(t, db, user.ID); coins != 50 {
+		t.Errorf("回滚后余额 = %d, want 50", coins)
+	}
+	if entries := userLedger(t, db, user.ID); len(entries) != 0 {
+		t.Errorf("回滚后仍有 %d 条流水", len(entries))
+	}
+	var consumed int64
+	db.Model(&models.ConsumeRecord{}).Where("user_id = ?", user.ID).Count(&consumed)
+	if consumed != 0 {
+		t.Errorf("回滚后仍有 %d 条消费记录", consumed)
+	}
+}
+
+func TestLedgerBalanceAfter(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	user := createTestUser(t, db, 0)
+
+	steps := []struct {
+		name   string
+		change func() (int, error)
+		want   int
+	}{
+		{"充值", func() (int, error) { return Credit(db, user.ID, 100, LedgerEntry{Type: "recharge"}) }, 100},
+		{"扣除", func() (int, error) { return Debit(db, user.ID, 30, LedgerEntry{Type: "collision"}) }, 70},
+		{"退款", func() (int, error) { return Credit(db, user.ID, 10, LedgerEntry{Type: "refund"}) }, 80},
+		{"管理员修改", func() (int, error) {
+			return 25, SetBalance(db, user.ID, 25, LedgerEntry{Type: LedgerTypeAdminAdjust})
+		}, 25},
+		{"修改为相同余额", func() (int, error) {
+			return 25, SetBalance(db, user.ID, 25, LedgerEntry{Type: LedgerTypeAdminAdjust})
+		}, 25},
+	}
+
+	for _, step := range steps {
+		balance, err := step.change()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		coins := userCoins(t, db, user.ID)
+		if balance != step.want || coins != step.want {
+			t.Errorf("%s后返回余额 %d、users.coins %d，want %d", step.name, balance, coins, step.want)
+		}
+		entries := userLedger(t, db, user.ID)
+		if last := entries[len(entries)-1]; last.BalanceAfter != coins {
+			t.Errorf("%s后最后一条流水 balance_after = %d, want %d", step.name, last.BalanceAfter, coins)
+		}
+	}
+
+	// 余额未变时不写流水；流水合计等于余额，每条的 balance_after 为累计值
+	entries := userLedger(t, db, user.ID)
+	if len(entries) != 4 {
+		t.Errorf("流水 %d 条，want 4", len(entries))
+	}
+	sum := 0
+	for _, entry := range entries {
+		sum += entry.Amount
+		if entry.BalanceAfter != sum {
+			t.Errorf("流水 #%d balance_after = %d, 累计 %d", entry.ID, entry.BalanceAfter, sum)
+		}
+	}
+	if sum != 25 {
+		t.Errorf("流水合计 = %d, want 25", sum)
+	}
+}
+
+func TestInitWalletLedgerIdempotent(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	rich := createTestUser(t, db, 50)
+	createTestUser(t, db, 0)
+	deleted := createTestUser(t, db, 30)
+	db.Delete(deleted)
+
+	if err := InitWalletLedger(); err != nil {
+		t.Fatalf("InitWalletLedger: %v", err)
+	}
+	var count int64
+	db.Model(&models.WalletLedger{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("第一次写入 %d 条期初流水，want 1（余额为 0 和已删除的用户不写）", count)
+	}
+	entries := userLedger(t, db, rich.ID)
+	if len(entries) != 1 || entries[0].Type != LedgerTypeOpening || entries[0].Amount != 50 || entries[0].BalanceAfter != 50 {
+		t.Errorf("期初流水 = %+v", entries)
+	}
+
+	// 再次调用（例如重启）不再写入
+	if err := InitWalletLedger(); err != nil {
+		t.Fatalf("第二次 InitWalletLedger: %v", err)
+	}
+	db.Model(&models.WalletLedger{}).Count(&count)
+	if count != 1 {
+		t.Errorf("第二次调用后共 %d 条期初流水，want 1", count)
+	}
+
+	if mismatched, err := ReconcileWallets(); err != nil || mismatched != 0 {
+		t.Errorf("期初余额写入后 ReconcileWallets = %d, %v, want 0", mismatched, err)
+	}
+}
+
+func TestReconcileWallets(t *testing.T) {
+	db := useTestDB(t, walletTables...)
+	consistent := createTestUser(t, db, 0)
+	drifted := createTestUser(t, db, 0)
+	for _, user := range []*models.User{consistent, drifted} {
+		if _, err := Credit(db, user.ID, 100, LedgerEntry{Type: "recharge"}); err != nil {
+			t.Fatalf("Credit: %v", err)
+		}
+	}
+
+	// 绕过钱包直接修改余额
+	db.Model(&models.User{}).Where("id = ?", drifted.ID).UpdateColumn("coins", 80)
+	if mismatched, err := ReconcileWallets(); err != nil || mismatched != 1 {
+		t.Fatalf("ReconcileWallets = %d, %v, want 1", mismatched, err)
+	}
+	var discrepancy models.WalletDiscrepancy
+	if err := db.First(&discrepancy, "user_id = ?", drifted.ID).Error; err != nil {
+		t.Fatalf("没有记录不一致的用户: %v", err)
+	}
+	if discrepancy.Coins != 80 || discrepancy.LedgerSum != 100 {
+		t.Errorf("不一致记录 = %+v, want coins 80 ledger_sum 100", discrepancy)
+	}
+
+	// 仍不一致时保留首次发现时间，更新对账时间
+	detectedAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	db.Model(&models.WalletDiscrepancy{}).Where("user_id = ?", drifted.ID).UpdateColumn("detected_at", detectedAt)
+	if mismatched, err := ReconcileWallets(); err != nil || mismatched != 1 {
+		t.Fatalf("第二次 ReconcileWallets = %d, %v, want 1", mismatched, err)
+	}
+	if err := db.First(&discrepancy, "user_id = ?", drifted.ID).Error; err != nil {
+		t.Fatalf("读取不一致记录失败: %v", err)
+	}
+	if !discrepancy.DetectedAt.Equal(detectedAt) {
+		t.Errorf("DetectedAt = %v, want 保留 %v", discrepancy.DetectedAt, detectedAt)
+	}
+	if !discrepancy.CheckedAt.After(detectedAt) {
+		t.Errorf("CheckedAt = %v, 没有更新", discrepancy.CheckedAt)
+	}
+
+	// 恢复一致后从列表中移除
+	db.Model(&models.User{}).Where("id = ?", drifted.ID).UpdateColumn("coins", 100)
+	if mismatched, err := ReconcileWallets(); err != nil || mismatched != 0 {
+		t.Fatalf("恢复后 ReconcileWallets = %d, %v, want 0", mismatched, err)
+	}
+	var count int64
+	db.Model(&models.WalletDiscrepancy{}).Count(&count)
+	if count != 0 {
+		t.Errorf("恢复一致后仍有 %d 条不一致记录", count)
+	}
+}
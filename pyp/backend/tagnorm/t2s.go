@@ -0,0 +1,101 @@
+package tagnorm
+
+// traditionalPairs 常用繁体字 -> 简体字对照表，每两个字符一组（繁体在前）
+// 只收录一对一的常用字，一繁多简的歧义字（如 乾、著）不做转换
+const traditionalPairs = "" +
+	"萬万 與与 醜丑 專专 業业 叢丛 東东 絲丝 丟丢 兩两 嚴严 喪丧 個个 豐丰 臨临 為为 麗丽 舉举 麼么 義义 " +
+	"烏乌 樂乐 喬乔 習习 鄉乡 書书 買买 亂乱 爭争 於于 虧亏 雲云 亞亚 產产 畝亩 親亲 褻亵 億亿 僅仅 從从 " +
+	"侖仑 倉仓 儀仪 們们 價价 眾众 優优 夥伙 會会 傘伞 偉伟 傳传 傷伤 倫伦 偽伪 體体 餘余 傭佣 僉佥 俠侠 " +
+	"侶侣 僥侥 偵侦 側侧 僑侨 儈侩 儕侪 儂侬 俁俣 儔俦 儼俨 倆俩 儷俪 儉俭 債债 傾倾 僂偻 僨偾 償偿 儻傥 " +
+	"儐傧 儲储 儺傩 兒儿 兌兑 黨党 蘭兰 關关 興兴 茲兹 養养 獸兽 內内 岡冈 冊册 寫写 軍军 農农 馮冯 衝冲 " +
+	"決决 況况 凍冻 淨净 涼凉 減减 湊凑 凜凛 幾几 鳳凤 憑凭 凱凯 擊击 鑿凿 芻刍 劃划 劉刘 則则 剛刚 創创 " +
+	"刪删 別别 剗刬 剄刭 劊刽 劌刿 劑剂 剮剐 劍剑 剝剥 劇剧 勸劝 辦办 務务 勱劢 動动 勵励 勁劲 勞劳 勢势 " +
+	"勳勋 勩勚 勻匀 匭匦 匱匮 區区 醫医 華华 協协 單单 賣卖 盧卢 鹵卤 臥卧 衛卫 卻却 廠厂 廳厅 曆历 歷历 " +
+	"厲厉 壓压 厭厌 厙厍 廁厕 廂厢 厴厣 廈厦 廚厨 廄厩 廝厮 縣县 參参 雙双 發发 變变 敘叙 疊叠 葉叶 號号 " +
+	"嘆叹 嘰叽 籲吁 後后 嚇吓 呂吕 嗎吗 唚吣 噸吨 聽听 啟启 吳吴 嘸呒 囈呓 嘔呕 嚦呖 唄呗 員员 咼呙 嗆呛 " +
+	"嗚呜 詠咏 嚨咙 嚀咛 噝咝 響响 啞哑 噠哒 嘵哓 嗶哔 噦哕 嘩哗 噲哙 嚌哜 噥哝 喲哟 嘜唛 嗊唝 嘮唠 啢唡 " +
+	"嗩唢 喚唤 嘖啧 嗇啬 囀啭 齧啮 嘯啸 噴喷 嘍喽 嚳喾 囁嗫 噯嗳 噓嘘 嚶嘤 囑嘱 嚕噜 團团 園园 圍围 圖图 " +
+	"圓圆 聖圣 場场 壞坏 塊块 堅坚 壇坛 壢坜 壩坝 塢坞 墳坟 墜坠 壟垄 壘垒 墾垦 堊垩 墊垫 塏垲 塒埘 塤埙 " +
+	"堝埚 塹堑 墮堕 壪塆 牆墙 壯壮 聲声 殼壳 壺壶 處处 備备 復复 夠够 頭头 誇夸 夾夹 奪夺 奩奁 奐奂 奮奋 " +
+	"獎奖 奧奥 妝妆 婦妇 媽妈 嫵妩 嫗妪 姍姗 薑姜 婁娄 婭娅 嬈娆 嬌娇 孌娈 娛娱 媧娲 嫻娴 嫿婳 嬰婴 嬋婵 " +
+	"嬸婶 媼媪 嬡嫒 嬪嫔 嬙嫱 嬤嬷 孫孙 學学 孿孪 寧宁 寶宝 實实 寵宠 審审 憲宪 宮宫 寬宽 賓宾 寢寝 對对 " +
+	"尋寻 導导 壽寿 將将 爾尔 塵尘 嘗尝 堯尧 尷尴 屍尸 盡尽 層层 屆届 屬属 屢屡 屨屦 嶼屿 歲岁 豈岂 嶇岖 " +
+	"崗岗 峴岘 嵐岚 島岛 嶺岭 嶽岳 崠岽 巋岿 嶨峃 嶧峄 峽峡 嶢峣 嶠峤 崢峥 巒峦 嶗崂 崍崃 嶮崄 嶄崭 嶸嵘 " +
+	"嶔嵚 嶁嵝 巔巅 鞏巩 巰巯 幣币 帥帅 師师 幃帏 帳帐 簾帘 幟帜 帶带 幀帧 幫帮 幬帱 幘帻 幗帼 冪幂 莊庄 " +
+	"慶庆 廬庐 廡庑 庫库 應应 廟庙 龐庞 廢废 廩廪 開开 異异 棄弃 張张 彌弥 彎弯 彈弹 強强 歸归 當当 錄录 " +
+	"彥彦 徹彻 徑径 徠徕 憶忆 懺忏 憂忧 愾忾 懷怀 態态 慫怂 憮怃 慪怄 悵怅 愴怆 憐怜 總总 懟怼 懌怿 戀恋 " +
+	"懇恳 惡恶 慟恸 懨恹 愷恺 惻恻 惱恼 惲恽 悅悦 懸悬 慳悭 憫悯 驚惊 懼惧 慘惨 懲惩 憊惫 愜惬 慚惭 憚惮 " +
+	"慣惯 慍愠 憤愤 憒愦 願愿 懾慑 懣懑 懶懒 戇戆 戔戋 戲戏 戧戗 戰战 戩戬 戶户 紮扎 撲扑 託托 執执 擴扩 " +
+	"捫扪 掃扫 揚扬 擾扰 撫抚 拋抛 摶抟 摳抠 掄抡 搶抢 護护 報报 擔担 擬拟 攏拢 揀拣 擁拥 攔拦 擰拧 撥拨 " +
+	"擇择 掛挂 摯挚 攣挛 撾挝 撻挞 挾挟 撓挠 擋挡 撟挢 掙挣 擠挤 揮挥 撏挦 撈捞 損损 撿捡 換换 搗捣 據据 " +
+	"擄掳 摑掴 擲掷 撣掸 摻掺 摜掼 攬揽 搵揾 攙搀 擱搁 摟搂 攪搅 攜携 攝摄 攄摅 擺摆 搖摇 擯摈 攤摊 攖撄 " +
+	"撐撑 攆撵 擷撷 擼撸 攛撺 擻擞 敵敌 斂敛 數数 齋斋 斕斓 鬥斗 斬斩 斷断 無无 舊旧 時时 曠旷 暘旸 曇昙 " +
+	"晝昼 顯显 晉晋 曬晒 曉晓 曄晔 暈晕 暉晖 暫暂 曖暧 術术 機机 殺杀 雜杂 權权 條条 來来 楊杨 傑杰 極极 " +
+	"構构 樅枞 樞枢 棗枣 櫪枥 梘枧 棖枨 槍枪 楓枫 梟枭 櫃柜 檸柠 檉柽 梔栀 柵栅 標标 棧栈 櫛栉 櫳栊 棟栋 " +
+	"櫨栌 櫟栎 欄栏 樹树 棲栖 樣样 欒栾 椏桠 橈桡 楨桢 檔档 榿桤 橋桥 樺桦 檜桧 槳桨 樁桩 夢梦 檢检 欞棂 " +
+	"槨椁 櫝椟 槧椠 槓杠 欏椤 橢椭 樓楼 欖榄 櫬榇 櫚榈 櫸榉 檟槚 檻槛 檳槟 櫧槠 橫横 檣樯 櫻樱 櫫橥 櫥橱 " +
+	"櫓橹 櫞橼 檁檩 歡欢 歟欤 歐欧 殲歼 歿殁 殤殇 殘残 殞殒 殮殓 殫殚 殯殡 毆殴 毀毁 轂毂 畢毕 斃毙 氈毡 " +
+	"毿毵 氌氇 氣气 氫氢 氬氩 氳氲 匯汇 漢汉 湯汤 洶汹 溝沟 沒没 灃沣 漚沤 瀝沥 淪沦 滄沧 溈沩 滬沪 濘泞 " +
+	"淚泪 澩泶 瀧泷 瀘泸 濼泺 瀉泻 潑泼 澤泽 涇泾 潔洁 灑洒 窪洼 浹浃 淺浅 漿浆 澆浇 湞浈 濁浊 測测 澮浍 " +
+	"濟济 瀏浏 渾浑 滸浒 濃浓 潯浔 濤涛 澇涝 淶涞 漣涟 潿涠 渦涡 渙涣 滌涤 潤润 澗涧 漲涨 澀涩 滲渗 溫温 " +
+	"灣湾 濕湿 潰溃 濺溅 漵溆 滯滞 灄滠 滿满 瀅滢 濾滤 濫滥 灤滦 濱滨 灘滩 澦滪 灧滟 瀟潇 瀾澜 瀲潋 灕漓 " +
+	"滅灭 燈灯 靈灵 災灾 燦灿 煬炀 爐炉 燉炖 煒炜 熗炝 點点 煉炼 熾炽 爍烁 爛烂 烴烃 燭烛 煙烟 煩烦 燒烧 " +
+	"燁烨 燴烩 燙烫 燼烬 熱热 煥焕 燜焖 燾焘 愛爱 爺爷 牘牍 犛牦 牽牵 犧牺 犢犊 狀状 獷犷 獁犸 猶犹 狽狈 " +
+	"獮狝 獰狞 獨独 狹狭 獅狮 獪狯 猙狰 獄狱 猻狲 獫猃 獵猎 獼猕 玀猡 豬猪 貓猫 蝟猬 獻献 獺獭 璣玑 瑪玛 " +
+	"瑋玮 環环 現现 瑲玱 璽玺 琺珐 瓏珑 璫珰 琿珲 璉琏 瑣琐 瓊琼 瑤瑶 瓔璎 瓚瓒 甌瓯 電电 畫画 暢畅 疇畴 " +
+	"癤疖 療疗 瘧疟 癘疠 瘍疡 瘡疮 瘋疯 皰疱 痙痉 癰痈 痺痹 瘂痖 瘞瘗 瘻瘘 癆痨 瘓痪 癇痫 癢痒 瘲疭 瘮瘆 " +
+	"癟瘪 癱瘫 癮瘾 癭瘿 癩癞 癬癣 癲癫 皚皑 皺皱 皸皲 盞盏 鹽盐 監监 蓋盖 盜盗 盤盘 瞘眍 眥眦 矚瞩 瞼睑 " +
+	"瞞瞒 矯矫 磯矶 礬矾 礦矿 碭砀 碼码 磚砖 硨砗 硯砚 碸砜 礪砺 礱砻 礫砾 礎础 硜硁 碩硕 硤硖 磽硗 磑硙 " +
+	"礄硚 確确 鹼碱 礙碍 磧碛 磣碜 禮礼 禕祎 禰祢 禎祯 禱祷 禍祸 稟禀 祿禄 禪禅 離离 禿秃 稈秆 種种 積积 " +
+	"稱称 穢秽 穠秾 穩稳 穫获 窮穷 竊窃 竅窍 窯窑 竄窜 窩窝 窺窥 竇窦 豎竖 競竞 筆笔 筍笋 箋笺 籠笼 箏筝 " +
+	"節节 範范 築筑 篋箧 篤笃 篩筛 簡简 籃篮 籌筹 簽签 簫箫 簞箪 簍篓 籬篱 籮箩 類类 糧粮 糲粝 糶粜 糞粪 " +
+	"糾纠 紀纪 紂纣 約约 紅红 紆纡 紇纥 紈纨 紉纫 紋纹 納纳 紐纽 紓纾 純纯 紕纰 紗纱 紙纸 級级 紛纷 紜纭 " +
+	"紡纺 紱绂 紳绅 紹绍 紺绀 紼绋 絀绌 終终 組组 絆绊 絎绗 結结 絕绝 絛绦 絝绔 絞绞 絡络 絢绚 給给 絨绒 " +
+	"統统 絹绢 綁绑 綃绡 綆绠 綈绨 綏绥 經经 綜综 綞缍 綠绿 綢绸 綣绻 綬绶 維维 綰绾 網网 綱纲 綴缀 綸纶 " +
+	"綹绺 綺绮 綻绽 綽绰 綾绫 緄绲 緇缁 緊紧 緋绯 緒绪 緘缄 線线 緝缉 緞缎 締缔 緣缘 編编 緩缓 緬缅 緯纬 " +
+	"練练 緶缏 緹缇 緻致 縈萦 縉缙 縊缢 縋缒 縐绉 縑缣 縛缚 縝缜 縞缟 縟缛 縫缝 縮缩 縱纵 縲缧 縵缦 縷缕 " +
+	"縹缥 績绩 繃绷 繅缫 繆缪 繒缯 織织 繕缮 繚缭 繞绕 繡绣 繩绳 繪绘 繫系 繭茧 繳缴 繹绎 繼继 纈缬 纏缠 " +
+	"續续 纖纤 纜缆 缽钵 罈坛 罌罂 罰罚 罵骂 罷罢 羅罗 羆罴 羈羁 羋芈 羥羟 羨羡 翹翘 耬耧 聳耸 恥耻 聶聂 " +
+	"聾聋 職职 聯联 聵聩 聰聪 肅肃 腸肠 膚肤 腎肾 腫肿 脹胀 脅胁 膽胆 勝胜 朧胧 腖胨 臚胪 脛胫 膠胶 脈脉 " +
+	"膾脍 臍脐 腦脑 膿脓 臠脔 腳脚 脫脱 腡脶 臉脸 臘腊 醃腌 膩腻 騰腾 臏膑 臢臜 輿舆 艤舣 艦舰 艙舱 艫舻 " +
+	"艱艰 豔艳 藝艺 蘇苏 蘋苹 莖茎 蔦茑 蘢茏 蔥葱 薦荐 莢荚 蕘荛 蓽荜 葒荭 蕁荨 藥药 蒔莳 萊莱 蓮莲 萵莴 " +
+	"獲获 瑩莹 鶯莺 蒓莼 蘿萝 螢萤 營营 蕭萧 薩萨 蔣蒋 蔞蒌 藍蓝 薊蓟 蘆芦 蕓芸 蕩荡 蔭荫 虜虏 慮虑 虛虚 " +
+	"蟲虫 蝦虾 雖虽 螞蚂 蠶蚕 蠔蚝 蟻蚁 蠅蝇 蠍蝎 蠟蜡 蠻蛮 蠣蛎 蠐蛴 蝸蜗 蟬蝉 蠑蝾 螻蝼 蟄蛰 衊蔑 銜衔 " +
+	"補补 襯衬 袞衮 襖袄 裊袅 褲裤 裝装 襠裆 褳裢 褸褛 襝裣 製制 複复 襪袜 襲袭 見见 觀观 規规 覓觅 視视 " +
+	"覘觇 覽览 覺觉 覬觊 覡觋 覿觌 覥觍 覦觎 覲觐 覷觑 觸触 觴觞 訂订 計计 訊讯 討讨 訓训 記记 訛讹 訝讶 " +
+	"訟讼 訣诀 訪访 設设 許许 訴诉 診诊 註注 詐诈 評评 詞词 詢询 試试 詩诗 詭诡 詮诠 話话 該该 詳详 誅诛 " +
+	"認认 誕诞 誘诱 語语 誠诚 誡诫 誣诬 誤误 說说 誰谁 課课 誼谊 調调 談谈 請请 諒谅 論论 諸诸 諾诺 謀谋 " +
+	"謁谒 謂谓 謊谎 謎谜 謙谦 講讲 謝谢 謠谣 謹谨 證证 識识 譜谱 譯译 議议 讀读 讓让 讚赞 貝贝 貞贞 負负 " +
+	"財财 貢贡 貧贫 貨货 販贩 貪贪 貫贯 責责 貯贮 貴贵 貶贬 貸贷 費费 貼贴 貿贸 賀贺 賂赂 賃赁 賄贿 資资 " +
+	"賈贾 賊贼 賑赈 賒赊 賜赐 賞赏 賠赔 賢贤 賤贱 賦赋 質质 賬账 賭赌 賴赖 賺赚 購购 賽赛 贈赠 贊赞 贏赢 " +
+	"趕赶 趙赵 趨趋 躍跃 踐践 蹤踪 軀躯 車车 軌轨 軒轩 軟软 軸轴 較较 載载 輔辅 輕轻 輛辆 輝辉 輩辈 輪轮 " +
+	"輯辑 輸输 轉转 轎轿 轟轰 辭辞 邊边 遼辽 達达 遷迁 過过 邁迈 運运 還还 這这 進进 遠远 違违 連连 遲迟 " +
+	"適适 選选 遺遗 郵邮 鄰邻 鄭郑 醬酱 釀酿 釋释 裡里 裏里 鑒鉴 針针 釘钉 釣钓 鈍钝 鈔钞 鈴铃 鉛铅 銀银 " +
+	"銅铜 銘铭 鋁铝 鋒锋 鋪铺 鋼钢 錢钱 錦锦 錫锡 錯错 鍋锅 鍵键 鍾钟 鐘钟 鎖锁 鎮镇 鏡镜 鐵铁 鑰钥 鑽钻 " +
+	"長长 門门 閃闪 閉闭 問问 閑闲 閒闲 間间 閣阁 閱阅 闆板 闊阔 闖闯 闡阐 闢辟 陽阳 陰阴 陣阵 階阶 際际 " +
+	"陸陆 隊队 隨随 險险 隱隐 隻只 雞鸡 難难 雛雏 霧雾 靜静 韓韩 頁页 頂顶 項项 順顺 須须 預预 領领 頻频 " +
+	"顆颗 題题 額额 顏颜 顧顾 風风 飛飞 飯饭 飲饮 飽饱 飾饰 餅饼 館馆 饅馒 馬马 駐驻 駕驾 駛驶 騎骑 騙骗 " +
+	"驗验 驢驴 髮发 鬆松 鬧闹 魚鱼 鮮鲜 鯨鲸 鳥鸟 鳴鸣 鴨鸭 鴻鸿 鵝鹅 鷹鹰 麥麦 黃黄 齊齐 齒齿 龍龙 龜龟 " +
+	"臺台 颱台 檯台 麵面 遊游 釁衅 鬱郁 髒脏 靂雳 靄霭 韻韵 頓顿 頌颂 頒颁 頗颇 頸颈 頰颊 頹颓 顛颠 顫颤 " +
+	"颳刮 颶飓 飄飘 飢饥 餓饿 餞饯 餡馅 饑饥 饒饶 饗飨 駁驳 駝驼 駱骆 駿骏 騷骚 驅驱 驕骄 驛驿 驟骤 骯肮 " +
+	"髏髅 鬍胡 鬢鬓 魯鲁 鯉鲤 鯊鲨 鰻鳗 鱷鳄 鳩鸠 鴉鸦 鴿鸽 鵬鹏 鶴鹤 鷗鸥 鸚鹦 黴霉 鼴鼹 齡龄 龕龛 貳贰 " +
+	"啓启 綫线 衆众 傢家 佈布 週周 彙汇 樸朴 嚮向 鬚须 餵喂 兇凶"
+
+// traditionalToSimplified 繁体字 -> 简体字映射
+var traditionalToSimplified = buildTraditionalMap(traditionalPairs)
+
+func buildTraditionalMap(pairs string) map[rune]rune {
+	table := make(map[rune]rune)
+	var pending []rune
+	for _, r := range pairs {
+		if r == ' ' {
+			continue
+		}
+		pending = append(pending, r)
+		if len(pending) == 2 {
+			table[pending[0]] = pending[1]
+			pending = pending[:0]
+		}
+	}
+	return table
+}
@@ -0,0 +1,66 @@
+// Package tagnorm 标签规范化
+//
+// 用户输入的标签保留原样用于展示（Display），比较、匹配和统计统一使用规范形式（Canonical）：
+// 全角转半角、大写转小写、繁体转简体，并去掉空白和标点。
+// 例如 "Python"、"python "、"ｐｙｔｈｏｎ" 的规范形式都是 "python"。
+package tagnorm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// keptPunct 有实际含义、不能去掉的符号（如 C#、R&B）
+const keptPunct = "#&"
+
+// Display 展示形式：去掉首尾空白并合并连续空白，其余保持用户输入
+func Display(tag string) string {
+	return strings.Join(strings.Fields(tag), " ")
+}
+
+// Canonical 规范形式，用于比较、匹配和热门标签统计
+func Canonical(tag string) string {
+	folded := fold(tag)
+
+	var b strings.Builder
+	b.Grow(len(folded))
+	for _, r := range folded {
+		if unicode.IsSpace(r) || (unicode.IsPunct(r) && !strings.ContainsRune(keptPunct, r)) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	// 全部由标点组成的标签只合并空白，避免规范形式为空
+	if b.Len() == 0 {
+		return Display(folded)
+	}
+	return b.String()
+}
+
+// Equal 两个标签的规范形式是否相同
+func Equal(a, b string) bool {
+	return Canonical(a) == Canonical(b)
+}
+
+// fold 逐字符做全角转半角、大小写和繁简转换
+func fold(tag string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(foldWidth(r))
+		if simplified, ok := traditionalToSimplified[r]; ok {
+			return simplified
+		}
+		return r
+	}, tag)
+}
+
+// foldWidth 全角字符转半角
+func foldWidth(r rune) rune {
+	switch {
+	case r == '　':
+		return ' '
+	case r >= '！' && r <= '～':
+		return r - 0xFEE0
+	}
+	return r
+}
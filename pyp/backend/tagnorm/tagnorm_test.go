@@ -0,0 +1,66 @@
+package tagnorm
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"全角转半角", "ｐｙｔｈｏｎ", "python"},
+		{"全角空格", "机器　学习", "机器学习"},
+		{"大小写", "PyThOn", "python"},
+		{"首尾和中间空白", "  machine   learning ", "machinelearning"},
+		{"繁体转简体", "機器學習", "机器学习"},
+		{"繁体全角混合", "ＲＥＤ　與　黑", "red与黑"},
+		{"去掉标点", "rock'n'roll!", "rocknroll"},
+		{"去掉中文标点", "你好，世界。", "你好世界"},
+		{"保留 #", "C#", "c#"},
+		{"保留全角 #", "Ｃ＃", "c#"},
+		{"保留 &", "R&B", "r&b"},
+		{"全部为标点", " ... ", "..."},
+		{"空标签", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Canonical(tt.tag); got != tt.want {
+				t.Errorf("Canonical(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalIdempotent(t *testing.T) {
+	tags := []string{"ｐｙｔｈｏｎ", "機器學習", "C#", "Ｒ＆Ｂ", "rock'n'roll!", " ... ", "臺灣 旅遊"}
+	for _, tag := range tags {
+		once := Canonical(tag)
+		if twice := Canonical(once); twice != once {
+			t.Errorf("Canonical(Canonical(%q)) = %q, want %q", tag, twice, once)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal("Python", " ｐｙｔｈｏｎ ") {
+		t.Error(`Equal("Python", " ｐｙｔｈｏｎ ") = false, want true`)
+	}
+	if Equal("C#", "C") {
+		t.Error(`Equal("C#", "C") = true, want false`)
+	}
+}
+
+func TestTraditionalPairs(t *testing.T) {
+	var count int
+	for _, r := range traditionalPairs {
+		if r != ' ' {
+			count++
+		}
+	}
+	if count%2 != 0 {
+		t.Fatalf("traditionalPairs 有 %d 个字符，不能两两成对", count)
+	}
+	if got := len(traditionalToSimplified); got != count/2 {
+		t.Errorf("traditionalToSimplified 有 %d 项，want %d（繁体字重复）", got, count/2)
+	}
+}